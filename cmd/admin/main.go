@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"karma8"
+	"karma8/internal/auth"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+)
+
+type client struct {
+	client *http.Client
+	url    string
+	// apiKey authenticates requests, admin API requires principal with admin permission.
+	apiKey string
+}
+
+func NewClient(url string, apiKey string) *client {
+	return &client{
+		client: http.DefaultClient,
+		url:    url,
+		apiKey: apiKey,
+	}
+}
+
+func (m *client) do(ctx context.Context, method string, elem ...string) (*http.Response, error) {
+	baseURL, err := url.Parse(m.url)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL.Path = path.Join(append([]string{baseURL.Path}, elem...)...)
+
+	req, err := http.NewRequestWithContext(ctx, method, baseURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if m.apiKey != "" {
+		req.Header.Set(auth.HeaderAPIKey, m.apiKey)
+	}
+
+	return m.client.Do(req)
+}
+
+func checkStatusCode(resp *http.Response, expected int) error {
+	if resp.StatusCode == expected {
+		return nil
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, body)
+}
+
+func (m *client) StartEvacuation(ctx context.Context, storageURL string) error {
+	resp, err := m.do(ctx, http.MethodPost, "admin", "evacuation", storageURL)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	return checkStatusCode(resp, http.StatusAccepted)
+}
+
+func (m *client) GetEvacuationProgress(ctx context.Context, storageURL string) (*karma8.EvacuationProgress, error) {
+	resp, err := m.do(ctx, http.MethodGet, "admin", "evacuation", storageURL)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkStatusCode(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	progress := &karma8.EvacuationProgress{}
+	if err := json.NewDecoder(resp.Body).Decode(progress); err != nil {
+		return nil, fmt.Errorf("can't decode progress: %w", err)
+	}
+
+	return progress, nil
+}
+
+func printProgress(progress *karma8.EvacuationProgress) {
+	fmt.Printf(
+		"storage=%s state=%s moved_parts=%d moved_bytes=%d failures=%d\n",
+		progress.StorageURL,
+		progress.State,
+		progress.MovedParts,
+		progress.MovedBytes,
+		len(progress.Failures),
+	)
+}
+
+func printFailures(progress *karma8.EvacuationProgress) {
+	for _, failure := range progress.Failures {
+		fmt.Printf(
+			"failed: bucket=%s file=%s deleted_file_id=%d part=%d error=%s\n",
+			failure.Bucket,
+			failure.Filename,
+			failure.DeletedFileID,
+			failure.PartIndex,
+			failure.Error,
+		)
+	}
+	if progress.Error != "" {
+		fmt.Println("error:", progress.Error)
+	}
+}
+
+func evacuate(c *client, storageURL string, wait bool, pollInterval time.Duration) error {
+	ctx := context.Background()
+
+	if err := c.StartEvacuation(ctx, storageURL); err != nil {
+		return fmt.Errorf("can't start evacuation: %w", err)
+	}
+
+	if !wait {
+		return nil
+	}
+
+	return status(c, storageURL, true, pollInterval)
+}
+
+func status(c *client, storageURL string, wait bool, pollInterval time.Duration) error {
+	ctx := context.Background()
+
+	var progress *karma8.EvacuationProgress
+	for {
+		var err error
+		progress, err = c.GetEvacuationProgress(ctx, storageURL)
+		if err != nil {
+			return fmt.Errorf("can't get evacuation progress: %w", err)
+		}
+
+		printProgress(progress)
+
+		if progress.State != karma8.EvacuationStateRunning || !wait {
+			break
+		}
+
+		time.Sleep(pollInterval)
+	}
+
+	printFailures(progress)
+
+	if progress.State == karma8.EvacuationStateRunning {
+		return nil
+	}
+	if progress.State != karma8.EvacuationStateDone || len(progress.Failures) > 0 {
+		return fmt.Errorf("evacuation finished with state %s and %d failures", progress.State, len(progress.Failures))
+	}
+	return nil
+}
+
+func usage() {
+	_, _ = fmt.Fprintf(os.Stderr, "Usage: %s [flags] evacuate|status <storage>\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	// NOTE: Admin API is served on a private address, so the CLI is run on the same host or inside the container.
+	endpointURL := flag.String("host", "http://localhost:8081", "admin endpoint url")
+	apiKey := flag.String("api-key", os.Getenv("KARMA8_API_KEY"), "api key of principal with admin permission")
+	wait := flag.Bool("wait", false, "wait until evacuation is finished")
+	pollInterval := flag.Duration("poll-interval", time.Second, "interval between progress requests")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	c := NewClient(*endpointURL, *apiKey)
+	command, storageURL := flag.Arg(0), flag.Arg(1)
+
+	var err error
+	switch command {
+	case "evacuate":
+		err = evacuate(c, storageURL, *wait, *pollInterval)
+	case "status":
+		err = status(c, storageURL, *wait, *pollInterval)
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
@@ -42,9 +42,10 @@ type client struct {
 	client *http.Client
 	url    string
 	debug  bool
+	apiKey string
 }
 
-func NewClient(url string, debug bool) *client {
+func NewClient(url string, debug bool, apiKey string) *client {
 	c := http.DefaultClient
 	if debug {
 		c = &http.Client{
@@ -56,6 +57,13 @@ func NewClient(url string, debug bool) *client {
 		client: c,
 		url:    url,
 		debug:  debug,
+		apiKey: apiKey,
+	}
+}
+
+func (m *client) authorize(req *http.Request) {
+	if m.apiKey != "" {
+		req.Header.Set("X-API-Key", m.apiKey)
 	}
 }
 
@@ -72,6 +80,8 @@ func (m *client) Put(ctx context.Context, filename string, data []byte) error {
 		return err
 	}
 
+	m.authorize(req)
+
 	resp, err := m.client.Do(req)
 	if resp != nil {
 		defer resp.Body.Close()
@@ -100,6 +110,8 @@ func (m *client) Get(ctx context.Context, filename string) ([]byte, error) {
 		return nil, err
 	}
 
+	m.authorize(req)
+
 	resp, err := m.client.Do(req)
 	if resp != nil {
 		defer resp.Body.Close()
@@ -115,8 +127,8 @@ func (m *client) Get(ctx context.Context, filename string) ([]byte, error) {
 	return io.ReadAll(resp.Body)
 }
 
-func test(endpointURL string, filepath string, debug bool) error {
-	c := NewClient(endpointURL, debug)
+func test(endpointURL string, filepath string, debug bool, apiKey string) error {
+	c := NewClient(endpointURL, debug, apiKey)
 
 	f, err := os.Open(filepath)
 	if err != nil {
@@ -154,9 +166,10 @@ func main() {
 	endpointURL := flag.String("host", "http://localhost:8080", "endpoint url")
 	filepath := flag.String("filepath", "cmd/tester/testdata", "file to upload and return")
 	needDumpHTTP := flag.Bool("debug", false, "need to dump http request and response or not")
+	apiKey := flag.String("api-key", "", "api key used if authentication is enabled")
 	flag.Parse()
 
-	err := test(*endpointURL, *filepath, *needDumpHTTP)
+	err := test(*endpointURL, *filepath, *needDumpHTTP, *apiKey)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, err.Error())
 		os.Exit(1)
@@ -1,21 +1,150 @@
 CREATE TYPE file_part AS (
     storage_url VARCHAR(128),
     file_path VARCHAR(1024),
-    content_length BIGINT
+    content_length BIGINT,
+    checksum VARCHAR(64),
+    replicas VARCHAR(128)[],
+    shared BOOLEAN,
+    codec VARCHAR(16),
+    stored_length BIGINT
     );
 
+CREATE TABLE bucket
+(
+    name               VARCHAR(63) PRIMARY KEY,
+    replication_factor INT DEFAULT 0,
+    quota_bytes        BIGINT DEFAULT 0,
+    retention_seconds  BIGINT DEFAULT 0,
+    allowed_hosts      VARCHAR(128)[] DEFAULT '{}',
+    dedup              BOOLEAN DEFAULT FALSE,
+    compression        VARCHAR(16) DEFAULT '',
+    used_bytes         BIGINT DEFAULT 0,
+    create_datetime    TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO bucket (name) VALUES ('default');
+
 CREATE TABLE file
 (
-    name            VARCHAR(1024) PRIMARY KEY,
+    bucket          VARCHAR(63) REFERENCES bucket (name),
+    name            VARCHAR(1024),
+    tenant          VARCHAR(128),
     parts           file_part[],
     content_length  BIGINT,
-    create_datetime TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    create_datetime TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expire_datetime TIMESTAMP WITH TIME ZONE,
+    legal_hold      BOOLEAN DEFAULT FALSE,
+    retain_until    TIMESTAMP WITH TIME ZONE,
+    master_key_id   VARCHAR(64),
+    wrapped_key     BYTEA,
+    key_fingerprint VARCHAR(64),
+    PRIMARY KEY (bucket, name)
 );
 
+CREATE INDEX file_expire_datetime_idx ON file (expire_datetime) WHERE expire_datetime IS NOT NULL;
+CREATE INDEX file_master_key_id_idx ON file (master_key_id) WHERE master_key_id IS NOT NULL;
+
 CREATE TABLE processing_file
 (
-    name            VARCHAR(1024) PRIMARY KEY,
+    bucket          VARCHAR(63) REFERENCES bucket (name),
+    name            VARCHAR(1024),
+    tenant          VARCHAR(128),
     parts           file_part[],
     content_length  BIGINT,
-    create_datetime TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    create_datetime TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expire_datetime TIMESTAMP WITH TIME ZONE,
+    legal_hold      BOOLEAN DEFAULT FALSE,
+    retain_until    TIMESTAMP WITH TIME ZONE,
+    master_key_id   VARCHAR(64),
+    wrapped_key     BYTEA,
+    key_fingerprint VARCHAR(64),
+    PRIMARY KEY (bucket, name)
+);
+
+CREATE TABLE deleted_file
+(
+    id              BIGSERIAL PRIMARY KEY,
+    bucket          VARCHAR(63),
+    name            VARCHAR(1024),
+    tenant          VARCHAR(128),
+    parts           file_part[],
+    content_length  BIGINT,
+    create_datetime TIMESTAMP WITH TIME ZONE,
+    expire_datetime TIMESTAMP WITH TIME ZONE,
+    delete_datetime TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    master_key_id   VARCHAR(64),
+    wrapped_key     BYTEA,
+    key_fingerprint VARCHAR(64)
+);
+
+CREATE INDEX deleted_file_bucket_idx ON deleted_file (bucket, delete_datetime);
+CREATE INDEX deleted_file_delete_datetime_idx ON deleted_file (delete_datetime);
+CREATE INDEX deleted_file_master_key_id_idx ON deleted_file (master_key_id) WHERE master_key_id IS NOT NULL;
+
+CREATE TABLE blob
+(
+    bucket          VARCHAR(63),
+    checksum        VARCHAR(64),
+    part            file_part,
+    ref_count       BIGINT DEFAULT 0,
+    update_datetime TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (bucket, checksum)
+);
+
+CREATE INDEX blob_garbage_idx ON blob (update_datetime) WHERE ref_count = 0;
+
+CREATE TABLE tenant_usage
+(
+    tenant          VARCHAR(128) PRIMARY KEY,
+    used_bytes      BIGINT,
+    update_datetime TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE job_cursor
+(
+    name            VARCHAR(128) PRIMARY KEY,
+    last_key        VARCHAR(1088),
+    update_datetime TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE damaged_file_part
+(
+    bucket          VARCHAR(63),
+    name            VARCHAR(1024),
+    part_index      INT,
+    storage_url     VARCHAR(128),
+    reason          VARCHAR(1024),
+    repaired        BOOLEAN DEFAULT FALSE,
+    detect_datetime TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (bucket, name, part_index, storage_url)
+);
+
+CREATE TABLE evacuation
+(
+    storage_url     VARCHAR(128) PRIMARY KEY,
+    state           VARCHAR(16),
+    moved_parts     INT DEFAULT 0,
+    moved_bytes     BIGINT DEFAULT 0,
+    error           VARCHAR(1024) DEFAULT '',
+    start_datetime  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    finish_datetime TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE evacuation_failure
+(
+    storage_url     VARCHAR(128),
+    bucket          VARCHAR(63),
+    name            VARCHAR(1024),
+    deleted_file_id BIGINT DEFAULT 0,
+    part_index      INT,
+    error           VARCHAR(1024),
+    PRIMARY KEY (storage_url, bucket, name, deleted_file_id, part_index)
+);
+
+CREATE TABLE orphan_file_part
+(
+    storage_url     VARCHAR(128),
+    file_path       VARCHAR(1024),
+    create_datetime TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (storage_url, file_path)
 );
@@ -1 +1,25 @@
 package karma8
+
+import "errors"
+
+var (
+	ErrFileNotFound           = errors.New("file not found")
+	ErrFileAlreadyExists      = errors.New("file already exists")
+	ErrUploadAborted          = errors.New("upload was aborted")
+	ErrDeletedFileNotFound    = errors.New("deleted file not found")
+	ErrFileLocked             = errors.New("file is locked")
+	ErrBlobNotFound           = errors.New("blob not found")
+	ErrFileEncryptionNotFound = errors.New("file encryption not found")
+	ErrCustomerKeyRequired    = errors.New("file is encrypted with customer key")
+	ErrCustomerKeyMismatch    = errors.New("customer key doesn't match")
+	ErrRangeNotSatisfiable    = errors.New("range is out of the file")
+	ErrRetentionShortened     = errors.New("retention of locked file can't be shortened")
+	ErrBucketNotFound         = errors.New("bucket not found")
+	ErrBucketQuotaExceeded    = errors.New("bucket quota exceeded")
+	ErrTenantQuotaExceeded    = errors.New("tenant quota exceeded")
+	ErrFileTooLarge           = errors.New("file is larger than the whole quota")
+	ErrFilePartNotFound       = errors.New("file part not found")
+	ErrFilePartMoved          = errors.New("file part was moved by someone else")
+	ErrEvacuationInProgress   = errors.New("evacuation is already in progress")
+	ErrEvacuationNotFound     = errors.New("evacuation not found")
+)
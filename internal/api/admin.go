@@ -0,0 +1,43 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/auth"
+	"karma8/internal/metrics"
+	"karma8/internal/tracing"
+	"net/http"
+)
+
+// NewAdminMux returns handler for maintenance operations, it should be served on a private address.
+// Maintenance operations require principal with admin permission, metrics are served without authentication.
+func NewAdminMux(
+	authenticator auth.Authenticator,
+	evacuator karma8.Evacuator,
+	damageStorage karma8.DamageStorage,
+	bucketStorage karma8.BucketStorage,
+	trashStorage karma8.TrashStorage,
+	fileMetaStorage karma8.FileMetaStorage,
+	logger *zap.Logger,
+) http.Handler {
+	r := mux.NewRouter()
+	r.Use(NewRequestMiddleware(logger), metrics.NewHTTPMiddleware(), tracing.NewHTTPMiddleware())
+	r.Handle("/metrics", metrics.NewHandler()).Methods(http.MethodGet)
+
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(auth.NewMiddleware(authenticator, logger), auth.NewPermissionMiddleware(auth.PermissionAdmin, logger))
+	admin.HandleFunc("/evacuation/{storage}", NewStartEvacuationHandler(evacuator, logger)).Methods(http.MethodPost)
+	admin.HandleFunc("/evacuation/{storage}", NewGetEvacuationHandler(evacuator, logger)).Methods(http.MethodGet)
+	admin.HandleFunc("/damaged-parts", NewListDamagedFilePartsHandler(damageStorage, logger)).Methods(http.MethodGet)
+	admin.HandleFunc("/buckets", NewListBucketsHandler(bucketStorage, logger)).Methods(http.MethodGet)
+	admin.HandleFunc("/buckets/{bucket}", NewGetBucketHandler(bucketStorage, logger)).Methods(http.MethodGet)
+	admin.HandleFunc("/buckets/{bucket}", NewPutBucketHandler(bucketStorage, logger)).Methods(http.MethodPut)
+	admin.HandleFunc("/buckets/{bucket}/deleted-files", NewListDeletedFilesHandler(trashStorage, logger)).
+		Methods(http.MethodGet)
+	admin.HandleFunc("/deleted-files/{id}/restore", NewRestoreDeletedFileHandler(trashStorage, logger)).
+		Methods(http.MethodPost)
+	admin.HandleFunc("/buckets/{bucket}/files/{filename}/lock", NewPutFileLockHandler(fileMetaStorage, logger)).
+		Methods(http.MethodPut)
+	return r
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/compression"
+	"karma8/internal/logging"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// bucketNamePattern doesn't allow slash, bucket is the first segment of file key.
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+
+type bucketSettings struct {
+	Name              string   `json:"name"`
+	ReplicationFactor int      `json:"replication_factor"`
+	QuotaBytes        int64    `json:"quota_bytes"`
+	RetentionSeconds  int64    `json:"retention_seconds"`
+	AllowedHosts      []string `json:"allowed_hosts"`
+	Dedup             bool     `json:"dedup"`
+	Compression       string   `json:"compression"`
+}
+
+func convertBucket(bucket *karma8.Bucket) *bucketSettings {
+	allowedHosts := bucket.AllowedHosts
+	if allowedHosts == nil {
+		allowedHosts = []string{}
+	}
+
+	return &bucketSettings{
+		Name:              bucket.Name,
+		ReplicationFactor: bucket.ReplicationFactor,
+		QuotaBytes:        bucket.QuotaBytes,
+		RetentionSeconds:  int64(bucket.Retention / time.Second),
+		AllowedHosts:      allowedHosts,
+		Dedup:             bucket.Dedup,
+		Compression:       bucket.Compression,
+	}
+}
+
+func (m *bucketSettings) validate() error {
+	if !bucketNamePattern.MatchString(m.Name) {
+		return fmt.Errorf("bad bucket name: %s", m.Name)
+	}
+	if m.ReplicationFactor < 0 || m.QuotaBytes < 0 || m.RetentionSeconds < 0 {
+		return errors.New("settings must not be negative")
+	}
+	if len(m.AllowedHosts) > 0 && m.ReplicationFactor > len(m.AllowedHosts) {
+		return errors.New("replication factor exceeds amount of allowed hosts")
+	}
+	if !compression.IsKnown(m.Compression) {
+		return fmt.Errorf("%w: %s", compression.ErrUnknownCodec, m.Compression)
+	}
+	return nil
+}
+
+func NewListBucketsHandler(bucketStorage karma8.BucketStorage, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		buckets, err := bucketStorage.ListBuckets(request.Context())
+		if err != nil {
+			logger.Error("can't list buckets", zap.Error(err))
+			writePlainInternalErr(writer, err, logger)
+			return
+		}
+
+		result := make([]*bucketSettings, 0, len(buckets))
+		for _, bucket := range buckets {
+			result = append(result, convertBucket(bucket))
+		}
+		writeJSON(writer, result, http.StatusOK, logger)
+	}
+}
+
+func NewGetBucketHandler(bucketStorage karma8.BucketStorage, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		bucket, err := bucketStorage.GetBucket(request.Context(), mux.Vars(request)["bucket"])
+		if err != nil {
+			if errors.Is(err, karma8.ErrBucketNotFound) {
+				writePlainErr(writer, err, http.StatusNotFound, logger)
+				return
+			}
+			logger.Error("can't get bucket", zap.Error(err))
+			writePlainInternalErr(writer, err, logger)
+			return
+		}
+
+		writeJSON(writer, convertBucket(bucket), http.StatusOK, logger)
+	}
+}
+
+// NewPutBucketHandler creates bucket or replaces its settings, settings are applied to new uploads only.
+func NewPutBucketHandler(bucketStorage karma8.BucketStorage, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		settings := &bucketSettings{}
+		if err := json.NewDecoder(request.Body).Decode(settings); err != nil {
+			writePlainErr(writer, fmt.Errorf("can't decode settings: %w", err), http.StatusBadRequest, logger)
+			return
+		}
+		settings.Name = mux.Vars(request)["bucket"]
+		if err := settings.validate(); err != nil {
+			writePlainErr(writer, err, http.StatusBadRequest, logger)
+			return
+		}
+
+		bucket := &karma8.Bucket{
+			Name:              settings.Name,
+			ReplicationFactor: settings.ReplicationFactor,
+			QuotaBytes:        settings.QuotaBytes,
+			Retention:         time.Duration(settings.RetentionSeconds) * time.Second,
+			AllowedHosts:      settings.AllowedHosts,
+			Dedup:             settings.Dedup,
+			Compression:       settings.Compression,
+		}
+		if err := bucketStorage.PutBucket(request.Context(), bucket); err != nil {
+			logger.Error("can't put bucket", zap.Error(err))
+			writePlainInternalErr(writer, err, logger)
+			return
+		}
+
+		writeJSON(writer, convertBucket(bucket), http.StatusOK, logger)
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+	"net/http"
+)
+
+const queryAll = "all"
+
+// NewListDamagedFilePartsHandler returns report of the scrubber, repaired parts are included only with all=true.
+func NewListDamagedFilePartsHandler(damageStorage karma8.DamageStorage, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		onlyActive := request.URL.Query().Get(queryAll) != "true"
+
+		parts, err := damageStorage.ListDamagedFileParts(request.Context(), onlyActive)
+		if err != nil {
+			logger.Error("can't list damaged file parts", zap.Error(err))
+			writePlainInternalErr(writer, err, logger)
+			return
+		}
+
+		if parts == nil {
+			parts = []*karma8.DamagedFilePart{}
+		}
+
+		writeJSON(writer, parts, http.StatusOK, logger)
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+	"net/http"
+)
+
+const (
+	headerContentType = "Content-Type"
+
+	contentTypeJSON = "application/json"
+)
+
+func writeJSON(w http.ResponseWriter, value interface{}, status int, logger *zap.Logger) {
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logger.Error("can't write response", zap.Error(err))
+	}
+}
+
+func NewStartEvacuationHandler(evacuator karma8.Evacuator, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		storageURL := mux.Vars(request)["storage"]
+
+		if err := evacuator.StartEvacuation(request.Context(), storageURL); err != nil {
+			logger.Error("can't start evacuation", zap.String("storage_url", storageURL), zap.Error(err))
+			if errors.Is(err, karma8.ErrEvacuationInProgress) {
+				writePlainErr(writer, err, http.StatusConflict, logger)
+				return
+			}
+			writePlainInternalErr(writer, err, logger)
+			return
+		}
+
+		writer.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func NewGetEvacuationHandler(evacuator karma8.Evacuator, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		storageURL := mux.Vars(request)["storage"]
+
+		progress, err := evacuator.GetEvacuationProgress(request.Context(), storageURL)
+		if err != nil {
+			if errors.Is(err, karma8.ErrEvacuationNotFound) {
+				writePlainErr(writer, err, http.StatusNotFound, logger)
+				return
+			}
+			logger.Error("can't get evacuation progress", zap.String("storage_url", storageURL), zap.Error(err))
+			writePlainInternalErr(writer, err, logger)
+			return
+		}
+
+		writeJSON(writer, progress, http.StatusOK, logger)
+	}
+}
@@ -1,20 +1,110 @@
 package api
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"io"
 	"karma8"
+	"karma8/internal/auth"
+	"karma8/internal/balancer"
+	"karma8/internal/logging"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	headerContentLength = "Content-Length"
+	headerRange         = "Range"
+	headerContentRange  = "Content-Range"
+	headerAcceptRanges  = "Accept-Ranges"
+	rangeUnit           = "bytes"
+	// headerTTL is lifetime of uploaded file in seconds, file is deleted after it by the expirer.
+	headerTTL = "X-TTL"
+	// headerLegalHold set to true locks uploaded file until the hold is released by admin,
+	// it's honoured only for principals with admin permission.
+	headerLegalHold = "X-Legal-Hold"
+	// headerRetainUntil is RFC 3339 time, uploaded file is locked until it. Like headerLegalHold it requires admin.
+	headerRetainUntil = "X-Retain-Until"
+	// headerEncryptionKey is base64 encoded 256-bit key provided by the client, the same key is required to get the file.
+	headerEncryptionKey = "X-Encryption-Key"
+	customerKeySize     = 32
+
+	// DefaultBucket is used by routes without bucket.
+	DefaultBucket = "default"
+)
+
+var (
+	errUnknownContentLength = errors.New("unknown Content-Length")
+	errForbidden            = errors.New("forbidden")
+	errInvalidTTL           = errors.New("invalid " + headerTTL)
+	errInvalidLegalHold     = errors.New("invalid " + headerLegalHold)
+	errInvalidRetainUntil   = errors.New("invalid " + headerRetainUntil)
+	errLockForbidden        = errors.New("lock of file requires admin permission")
+	errInvalidEncryptionKey = errors.New("invalid " + headerEncryptionKey)
 )
 
-var errUnknownContentLength = errors.New("unknown Content-Length")
+// expireTimeOf returns end of TTL requested by the client, nil if there is no TTL.
+func expireTimeOf(request *http.Request, now time.Time) (*time.Time, error) {
+	rawTTL := request.Header.Get(headerTTL)
+	if rawTTL == "" {
+		return nil, nil
+	}
+
+	ttl, err := strconv.ParseInt(rawTTL, 10, 64)
+	if err != nil || ttl <= 0 {
+		return nil, errInvalidTTL
+	}
+
+	expireTime := now.Add(time.Duration(ttl) * time.Second)
+	return &expireTime, nil
+}
+
+// fileKeyOf returns requested file, default bucket is used for routes without bucket.
+func fileKeyOf(request *http.Request) karma8.FileKey {
+	vars := mux.Vars(request)
+	bucket, ok := vars["bucket"]
+	if !ok {
+		bucket = DefaultBucket
+	}
+	return karma8.FileKey{Bucket: bucket, Name: vars["filename"]}
+}
+
+// authorized checks that principal of the request is permitted to do action with the file.
+func authorized(request *http.Request, permission auth.Permission, key karma8.FileKey) bool {
+	principal := auth.PrincipalFromContext(request.Context())
+	return principal != nil && principal.Allows(permission, key)
+}
+
+// writeServiceErr maps errors of file service to status codes.
+func writeServiceErr(w http.ResponseWriter, err error, logger *zap.Logger) {
+	switch {
+	case errors.Is(err, karma8.ErrFileNotFound), errors.Is(err, karma8.ErrBucketNotFound):
+		writePlainErr(w, err, http.StatusNotFound, logger)
+	case errors.Is(err, karma8.ErrCustomerKeyRequired):
+		writePlainErr(w, err, http.StatusBadRequest, logger)
+	case errors.Is(err, karma8.ErrCustomerKeyMismatch):
+		writePlainErr(w, err, http.StatusForbidden, logger)
+	case errors.Is(err, karma8.ErrFileLocked),
+		errors.Is(err, karma8.ErrFileAlreadyExists),
+		errors.Is(err, karma8.ErrUploadAborted):
+		writePlainErr(w, err, http.StatusConflict, logger)
+	case errors.Is(err, karma8.ErrRangeNotSatisfiable):
+		writePlainErr(w, err, http.StatusRequestedRangeNotSatisfiable, logger)
+	case errors.Is(err, karma8.ErrFileTooLarge):
+		writePlainErr(w, err, http.StatusRequestEntityTooLarge, logger)
+	case errors.Is(err, karma8.ErrBucketQuotaExceeded),
+		errors.Is(err, karma8.ErrTenantQuotaExceeded),
+		errors.Is(err, balancer.ErrNotEnoughHosts):
+		writePlainErr(w, err, http.StatusInsufficientStorage, logger)
+	default:
+		writePlainInternalErr(w, err, logger)
+	}
+}
 
 func writePlainErr(w http.ResponseWriter, err error, status int, logger *zap.Logger) {
 	w.WriteHeader(status)
@@ -28,26 +118,146 @@ func writePlainInternalErr(w http.ResponseWriter, err error, logger *zap.Logger)
 	writePlainErr(w, err, http.StatusInternalServerError, logger)
 }
 
+// customerKeyOf returns key provided by the client to encrypt the file, it's nil if there is no key.
+func customerKeyOf(request *http.Request) ([]byte, error) {
+	rawKey := request.Header.Get(headerEncryptionKey)
+	if rawKey == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(rawKey)
+	if err != nil || len(key) != customerKeySize {
+		return nil, errInvalidEncryptionKey
+	}
+	return key, nil
+}
+
+// byteRangeOf returns range requested by the client, it's nil if the whole file is requested.
+// Malformed and multiple ranges are ignored, so the whole file is sent for them as HTTP allows.
+func byteRangeOf(request *http.Request) *karma8.ByteRange {
+	rawRange := request.Header.Get(headerRange)
+	if !strings.HasPrefix(rawRange, rangeUnit+"=") || strings.Contains(rawRange, ",") {
+		return nil
+	}
+
+	spec := strings.TrimPrefix(rawRange, rangeUnit+"=")
+	dash := strings.IndexByte(spec, '-')
+	if dash < 0 {
+		return nil
+	}
+	rawFirst, rawLast := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+	if rawFirst == "" {
+		suffixLength, err := strconv.ParseInt(rawLast, 10, 64)
+		if err != nil || suffixLength <= 0 {
+			return nil
+		}
+		return &karma8.ByteRange{SuffixLength: suffixLength}
+	}
+
+	first, err := strconv.ParseInt(rawFirst, 10, 64)
+	if err != nil || first < 0 {
+		return nil
+	}
+	last := int64(-1)
+	if rawLast != "" {
+		last, err = strconv.ParseInt(rawLast, 10, 64)
+		if err != nil || last < first {
+			return nil
+		}
+	}
+	return &karma8.ByteRange{First: first, Last: last}
+}
+
+// lockOf returns WORM lock requested by the client.
+func lockOf(request *http.Request, now time.Time) (karma8.FileLock, error) {
+	var lock karma8.FileLock
+
+	if rawLegalHold := request.Header.Get(headerLegalHold); rawLegalHold != "" {
+		legalHold, err := strconv.ParseBool(rawLegalHold)
+		if err != nil {
+			return lock, errInvalidLegalHold
+		}
+		lock.LegalHold = legalHold
+	}
+
+	if rawRetainUntil := request.Header.Get(headerRetainUntil); rawRetainUntil != "" {
+		retainUntil, err := time.Parse(time.RFC3339, rawRetainUntil)
+		if err != nil || !retainUntil.After(now) {
+			return lock, errInvalidRetainUntil
+		}
+		lock.RetainUntil = &retainUntil
+	}
+
+	return lock, nil
+}
+
+// canLock checks that principal of the request may lock uploaded file. Locks are released only by admin,
+// so other writers can't make files undeletable. Presigned URLs never lock files, their holder isn't the issuer.
+func canLock(request *http.Request) bool {
+	if auth.IsPresigned(request.URL.Query()) {
+		return false
+	}
+
+	principal := auth.PrincipalFromContext(request.Context())
+	return principal != nil && principal.Has(auth.PermissionAdmin)
+}
+
 func NewPutFileHandler(service karma8.FileService, logger *zap.Logger) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
-		filename := mux.Vars(request)["filename"]
+		logger := logging.FromContext(request.Context(), logger)
+
+		key := fileKeyOf(request)
+
+		if !authorized(request, auth.PermissionWrite, key) {
+			writePlainErr(writer, errForbidden, http.StatusForbidden, logger)
+			return
+		}
 
 		if request.ContentLength == -1 {
 			writePlainErr(writer, errUnknownContentLength, http.StatusBadRequest, logger)
 			return
 		}
 
+		now := time.Now()
+		expireTime, err := expireTimeOf(request, now)
+		if err != nil {
+			writePlainErr(writer, err, http.StatusBadRequest, logger)
+			return
+		}
+		lock, err := lockOf(request, now)
+		if err != nil {
+			writePlainErr(writer, err, http.StatusBadRequest, logger)
+			return
+		}
+		if (lock.LegalHold || lock.RetainUntil != nil) && !canLock(request) {
+			logger.Warn("lock of uploaded file rejected")
+			writePlainErr(writer, errLockForbidden, http.StatusForbidden, logger)
+			return
+		}
+
+		customerKey, err := customerKeyOf(request)
+		if err != nil {
+			writePlainErr(writer, err, http.StatusBadRequest, logger)
+			return
+		}
+
 		file := &karma8.File{
 			Meta: &karma8.FileMeta{
-				Name:          filename,
+				Bucket:        key.Bucket,
+				Name:          key.Name,
+				Tenant:        auth.PrincipalFromContext(request.Context()).Name,
 				ContentLength: request.ContentLength,
+				ExpireTime:    expireTime,
+				Lock:          lock,
 			},
-			Body: request.Body,
+			Body:        request.Body,
+			CustomerKey: customerKey,
 		}
 
 		if err := service.PutFile(request.Context(), file); err != nil {
 			logger.Error("can't put file", zap.Error(err))
-			writePlainInternalErr(writer, err, logger)
+			writeServiceErr(writer, err, logger)
 			return
 		}
 	}
@@ -55,22 +265,63 @@ func NewPutFileHandler(service karma8.FileService, logger *zap.Logger) http.Hand
 
 func NewGetFileHandler(service karma8.FileService, logger *zap.Logger) http.HandlerFunc {
 	return func(writer http.ResponseWriter, request *http.Request) {
-		filename := mux.Vars(request)["filename"]
+		logger := logging.FromContext(request.Context(), logger)
+
+		key := fileKeyOf(request)
+
+		if !authorized(request, auth.PermissionRead, key) {
+			writePlainErr(writer, errForbidden, http.StatusForbidden, logger)
+			return
+		}
 
-		file, err := service.GetFile(request.Context(), filename)
+		customerKey, err := customerKeyOf(request)
+		if err != nil {
+			writePlainErr(writer, err, http.StatusBadRequest, logger)
+			return
+		}
+
+		byteRange := byteRangeOf(request)
+		file, err := service.GetFile(request.Context(), key.Bucket, key.Name, customerKey, byteRange)
 		if err != nil {
 			logger.Error("can't get file", zap.Error(err))
-			writePlainInternalErr(writer, err, logger)
+			writeServiceErr(writer, err, logger)
 			return
 		}
 
 		defer file.Body.Close()
 
-		writer.Header().Set(headerContentLength, strconv.FormatInt(file.Meta.ContentLength, 10))
+		writer.Header().Set(headerAcceptRanges, rangeUnit)
+		writer.Header().Set(headerContentLength, strconv.FormatInt(file.Length, 10))
+		if byteRange != nil {
+			writer.Header().Set(
+				headerContentRange,
+				fmt.Sprintf("%s %d-%d/%d", rangeUnit, file.Offset, file.Offset+file.Length-1, file.Meta.ContentLength),
+			)
+			writer.WriteHeader(http.StatusPartialContent)
+		}
 
 		if _, err = io.Copy(writer, file.Body); err != nil {
+			// NOTE: Status and part of the body are already sent, so the response can only be aborted.
 			logger.Error("can't write file body", zap.Error(err))
-			writePlainInternalErr(writer, err, logger)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+func NewDeleteFileHandler(service karma8.FileService, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		key := fileKeyOf(request)
+
+		if !authorized(request, auth.PermissionDelete, key) {
+			writePlainErr(writer, errForbidden, http.StatusForbidden, logger)
+			return
+		}
+
+		if err := service.DeleteFile(request.Context(), key.Bucket, key.Name); err != nil {
+			logger.Error("can't delete file", zap.Error(err))
+			writeServiceErr(writer, err, logger)
 			return
 		}
 	}
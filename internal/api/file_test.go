@@ -0,0 +1,46 @@
+package api
+
+import (
+	"karma8"
+	"net/http"
+	"testing"
+)
+
+func TestByteRangeOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawRange string
+		want     *karma8.ByteRange
+	}{
+		{name: "no range", rawRange: "", want: nil},
+		{name: "closed range", rawRange: "bytes=10-19", want: &karma8.ByteRange{First: 10, Last: 19}},
+		{name: "single byte", rawRange: "bytes=5-5", want: &karma8.ByteRange{First: 5, Last: 5}},
+		{name: "open range", rawRange: "bytes=10-", want: &karma8.ByteRange{First: 10, Last: -1}},
+		{name: "suffix range", rawRange: "bytes=-100", want: &karma8.ByteRange{SuffixLength: 100}},
+		{name: "spaces around offsets", rawRange: "bytes= 10 - 19 ", want: &karma8.ByteRange{First: 10, Last: 19}},
+		{name: "another unit", rawRange: "items=10-19", want: nil},
+		{name: "multiple ranges", rawRange: "bytes=0-9,20-29", want: nil},
+		{name: "no dash", rawRange: "bytes=10", want: nil},
+		{name: "last before first", rawRange: "bytes=20-10", want: nil},
+		{name: "zero suffix", rawRange: "bytes=-0", want: nil},
+		{name: "negative first", rawRange: "bytes=-5-10", want: nil},
+		{name: "not a number", rawRange: "bytes=a-b", want: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, "/bucket/file", nil)
+			if err != nil {
+				t.Fatalf("can't create request: %v", err)
+			}
+			if test.rawRange != "" {
+				request.Header.Set(headerRange, test.rawRange)
+			}
+
+			got := byteRangeOf(request)
+			if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+				t.Fatalf("range of %q is %+v, want %+v", test.rawRange, got, test.want)
+			}
+		})
+	}
+}
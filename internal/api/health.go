@@ -0,0 +1,28 @@
+package api
+
+import (
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+	"net/http"
+)
+
+// NewLivenessHandler reports that process is alive, it doesn't check dependencies,
+// otherwise their outage would restart all instances.
+func NewLivenessHandler() http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}
+}
+
+func NewReadinessHandler(checker karma8.ReadinessChecker, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		if err := checker.CheckReadiness(request.Context()); err != nil {
+			writePlainErr(writer, err, http.StatusServiceUnavailable, logger)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"karma8/internal/auth"
+	"karma8/internal/logging"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	headerForwardedFor = "X-Forwarded-For"
+
+	// limiterIdleTimeout is how long limiter of inactive client is kept.
+	limiterIdleTimeout = 10 * time.Minute
+)
+
+var (
+	errRateLimited      = errors.New("rate limit exceeded")
+	errTooManyUploads   = errors.New("too many concurrent uploads")
+	errObjectTooLarge   = errors.New("object exceeds max size")
+	errMissingPrincipal = errors.New("request isn't authenticated")
+)
+
+type LimitOptions struct {
+	// MaxObjectSize limits Content-Length of uploads, zero means unlimited.
+	MaxObjectSize int64
+	// MaxConcurrentUploads limits simultaneous uploads of every principal, zero means unlimited.
+	// Anonymous uploads are limited per client IP.
+	MaxConcurrentUploads int
+	// RateLimit is allowed requests per second from every IP, zero disables rate limiting.
+	RateLimit float64
+	RateBurst int
+	// TrustForwardedFor takes client IP from X-Forwarded-For, it should be enabled only behind trusted proxy.
+	TrustForwardedFor bool
+}
+
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// ipRateLimiter keeps token bucket per client IP, limiters of inactive clients are removed.
+type ipRateLimiter struct {
+	limit     rate.Limit
+	burst     int
+	limiters  map[string]*ipLimiter
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+func (m *ipRateLimiter) allow(ip string, now time.Time) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if now.Sub(m.lastSweep) > limiterIdleTimeout {
+		for key, limiter := range m.limiters {
+			if now.Sub(limiter.lastSeen) > limiterIdleTimeout {
+				delete(m.limiters, key)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	limiter, ok := m.limiters[ip]
+	if !ok {
+		limiter = &ipLimiter{limiter: rate.NewLimiter(m.limit, m.burst)}
+		m.limiters[ip] = limiter
+	}
+	limiter.lastSeen = now
+
+	return limiter.limiter.AllowN(now, 1)
+}
+
+func clientIP(request *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwarded := request.Header.Get(headerForwardedFor); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// NewRateLimitMiddleware rejects requests exceeding rate limit of the client IP with 429.
+func NewRateLimitMiddleware(options LimitOptions, logger *zap.Logger) mux.MiddlewareFunc {
+	limiter := &ipRateLimiter{
+		limit:    rate.Limit(options.RateLimit),
+		burst:    options.RateBurst,
+		limiters: map[string]*ipLimiter{},
+	}
+	if limiter.burst < 1 {
+		limiter.burst = 1
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			ip := clientIP(request, options.TrustForwardedFor)
+			if !limiter.allow(ip, time.Now()) {
+				requestLogger := logging.FromContext(request.Context(), logger)
+				requestLogger.Warn("request is rate limited", zap.String("client_ip", ip))
+				writePlainErr(writer, errRateLimited, http.StatusTooManyRequests, requestLogger)
+				return
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// uploadLimiter counts uploads in progress of every key.
+type uploadLimiter struct {
+	max      int
+	inFlight map[string]int
+	mutex    sync.Mutex
+}
+
+func (m *uploadLimiter) acquire(key string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.inFlight[key] >= m.max {
+		return false
+	}
+	m.inFlight[key]++
+	return true
+}
+
+func (m *uploadLimiter) release(key string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.inFlight[key]--
+	if m.inFlight[key] == 0 {
+		delete(m.inFlight, key)
+	}
+}
+
+// uploadLimitKey identifies whose uploads are counted, all clients share anonymous principal,
+// so they are told apart by IP.
+func uploadLimitKey(request *http.Request, principal *auth.Principal, trustForwardedFor bool) string {
+	if principal == auth.Anonymous {
+		return principal.Name + "/" + clientIP(request, trustForwardedFor)
+	}
+	return principal.Name
+}
+
+// NewUploadLimitMiddleware checks upload size and concurrency of the principal before the upload starts,
+// so rejected requests don't touch balancer and meta storage. It must be applied after authentication.
+func NewUploadLimitMiddleware(options LimitOptions, logger *zap.Logger) mux.MiddlewareFunc {
+	limiter := &uploadLimiter{
+		max:      options.MaxConcurrentUploads,
+		inFlight: map[string]int{},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			requestLogger := logging.FromContext(request.Context(), logger)
+
+			if options.MaxObjectSize > 0 {
+				if request.ContentLength > options.MaxObjectSize {
+					writePlainErr(writer, errObjectTooLarge, http.StatusRequestEntityTooLarge, requestLogger)
+					return
+				}
+				request.Body = http.MaxBytesReader(writer, request.Body, options.MaxObjectSize)
+			}
+
+			if options.MaxConcurrentUploads > 0 {
+				principal := auth.PrincipalFromContext(request.Context())
+				if principal == nil {
+					writePlainInternalErr(writer, errMissingPrincipal, requestLogger)
+					return
+				}
+
+				key := uploadLimitKey(request, principal, options.TrustForwardedFor)
+				if !limiter.acquire(key) {
+					requestLogger.Warn("too many concurrent uploads", zap.String("key", key))
+					writePlainErr(writer, errTooManyUploads, http.StatusTooManyRequests, requestLogger)
+					return
+				}
+				defer limiter.release(key)
+			}
+
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+	"net/http"
+	"time"
+)
+
+type fileLock struct {
+	LegalHold   bool       `json:"legal_hold"`
+	RetainUntil *time.Time `json:"retain_until,omitempty"`
+}
+
+// NewPutFileLockHandler places, extends or releases WORM lock of the existing file.
+// Legal hold can be released at any time, but active retention can only be extended.
+func NewPutFileLockHandler(fileMetaStorage karma8.FileMetaStorage, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		vars := mux.Vars(request)
+		key := karma8.FileKey{Bucket: vars["bucket"], Name: vars["filename"]}
+
+		body := &fileLock{}
+		if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+			writePlainErr(writer, fmt.Errorf("can't decode request: %w", err), http.StatusBadRequest, logger)
+			return
+		}
+
+		lock := karma8.FileLock{LegalHold: body.LegalHold, RetainUntil: body.RetainUntil}
+		if err := fileMetaStorage.SetFileLock(request.Context(), key, lock); err != nil {
+			logger.Error("can't set file lock", zap.Error(err))
+			switch {
+			case errors.Is(err, karma8.ErrFileNotFound):
+				writePlainErr(writer, err, http.StatusNotFound, logger)
+			case errors.Is(err, karma8.ErrRetentionShortened):
+				writePlainErr(writer, err, http.StatusConflict, logger)
+			default:
+				writePlainInternalErr(writer, err, logger)
+			}
+			return
+		}
+
+		logger.Info("file lock changed", zap.Bool("legal_hold", lock.LegalHold))
+		writeJSON(writer, body, http.StatusOK, logger)
+	}
+}
@@ -4,12 +4,55 @@ import (
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"karma8"
+	"karma8/internal/auth"
+	"karma8/internal/metrics"
+	"karma8/internal/tracing"
 	"net/http"
 )
 
-func NewMux(fileService karma8.FileService, logger *zap.Logger) http.Handler {
+func NewMux(
+	fileService karma8.FileService,
+	readinessChecker karma8.ReadinessChecker,
+	authenticator auth.Authenticator,
+	signer *auth.URLSigner,
+	presignOptions PresignOptions,
+	limitOptions LimitOptions,
+	logger *zap.Logger,
+) http.Handler {
 	r := mux.NewRouter()
-	r.HandleFunc("/file/{filename}", NewPutFileHandler(fileService, logger)).Methods(http.MethodPut)
-	r.HandleFunc("/file/{filename}", NewGetFileHandler(fileService, logger)).Methods(http.MethodGet)
+	r.Use(NewRequestMiddleware(logger), metrics.NewHTTPMiddleware(), tracing.NewHTTPMiddleware())
+	r.HandleFunc("/healthz", NewLivenessHandler()).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", NewReadinessHandler(readinessChecker, logger)).Methods(http.MethodGet)
+
+	authenticate := auth.NewMiddleware(authenticator, logger)
+	// NOTE: Limiters are shared by all routes, so middlewares are created once.
+	limitRate := mux.MiddlewareFunc(func(handler http.Handler) http.Handler {
+		return handler
+	})
+	if limitOptions.RateLimit > 0 {
+		limitRate = NewRateLimitMiddleware(limitOptions, logger)
+	}
+	// NOTE: Middlewares are applied in reverse order, rate limit goes first, so rejected requests are cheap.
+	protect := func(handler http.Handler) http.Handler {
+		handler = authenticate(handler)
+		// NOTE: Presigned URLs are disabled if there is no signer.
+		if signer != nil {
+			handler = NewPresignedURLMiddleware(signer, logger)(handler)
+		}
+		return limitRate(handler)
+	}
+	limitUpload := NewUploadLimitMiddleware(limitOptions, logger)
+
+	if signer != nil {
+		presign := NewPresignHandler(signer, presignOptions, logger)
+		r.Handle("/presign", limitRate(authenticate(presign))).Methods(http.MethodPost)
+	}
+
+	// NOTE: Routes without bucket are kept for old clients, they work with DefaultBucket.
+	for _, template := range []string{"/bucket/{bucket}/file/{filename}", "/file/{filename}"} {
+		r.Handle(template, protect(limitUpload(NewPutFileHandler(fileService, logger)))).Methods(http.MethodPut)
+		r.Handle(template, protect(NewGetFileHandler(fileService, logger))).Methods(http.MethodGet)
+		r.Handle(template, protect(NewDeleteFileHandler(fileService, logger))).Methods(http.MethodDelete)
+	}
 	return r
 }
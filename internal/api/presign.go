@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"karma8/internal/auth"
+	"karma8/internal/logging"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+var errPayloadTooLarge = errors.New("payload exceeds max size of presigned url")
+
+type PresignOptions struct {
+	// BaseURL is prepended to issued URLs, they are relative if it's empty.
+	BaseURL   string
+	MaxExpiry time.Duration
+}
+
+type presignRequest struct {
+	Method string `json:"method"`
+	// Bucket is DefaultBucket if it's empty.
+	Bucket   string `json:"bucket"`
+	Filename string `json:"filename"`
+	// ExpiresIn is lifetime of URL in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+	MaxSize   int64 `json:"max_size,omitempty"`
+}
+
+type presignResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (m *presignRequest) validate(maxExpiry time.Duration) error {
+	if m.Method != http.MethodGet && m.Method != http.MethodPut {
+		return fmt.Errorf("unsupported method: %s", m.Method)
+	}
+	if m.Filename == "" {
+		return errors.New("empty filename")
+	}
+	if m.ExpiresIn <= 0 {
+		return errors.New("expires_in must be positive")
+	}
+	if maxExpiry > 0 && time.Duration(m.ExpiresIn)*time.Second > maxExpiry {
+		return fmt.Errorf("expires_in exceeds %s", maxExpiry)
+	}
+	if m.MaxSize < 0 {
+		return errors.New("max_size must not be negative")
+	}
+	return nil
+}
+
+// NewPresignHandler issues URLs which allow to do the same as the principal could do with the file.
+func NewPresignHandler(signer *auth.URLSigner, options PresignOptions, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		body := &presignRequest{}
+		if err := json.NewDecoder(request.Body).Decode(body); err != nil {
+			writePlainErr(writer, fmt.Errorf("can't decode request: %w", err), http.StatusBadRequest, logger)
+			return
+		}
+		if err := body.validate(options.MaxExpiry); err != nil {
+			writePlainErr(writer, err, http.StatusBadRequest, logger)
+			return
+		}
+		if body.Bucket == "" {
+			body.Bucket = DefaultBucket
+		}
+
+		presigned := &auth.PresignedRequest{
+			Method:    body.Method,
+			Bucket:    body.Bucket,
+			Filename:  body.Filename,
+			ExpiresAt: time.Now().Add(time.Duration(body.ExpiresIn) * time.Second),
+			MaxSize:   body.MaxSize,
+			Principal: auth.PrincipalFromContext(request.Context()).Name,
+		}
+		if !authorized(request, presigned.Permission(), presigned.Key()) {
+			writePlainErr(writer, errForbidden, http.StatusForbidden, logger)
+			return
+		}
+
+		target := url.URL{
+			Path:     path.Join("/bucket", presigned.Bucket, "file", presigned.Filename),
+			RawQuery: signer.Sign(presigned).Encode(),
+		}
+		logger.Info(
+			"presigned url issued",
+			zap.String("bucket", presigned.Bucket),
+			zap.String("filename", presigned.Filename),
+			zap.String("presigned_method", presigned.Method),
+			zap.Time("expires_at", presigned.ExpiresAt),
+		)
+
+		writeJSON(writer, &presignResponse{
+			URL:       options.BaseURL + target.String(),
+			ExpiresAt: presigned.ExpiresAt,
+		}, http.StatusOK, logger)
+	}
+}
+
+// NewPresignedURLMiddleware authenticates requests with presigned URL, other requests are passed as is.
+// Holder of URL gets access only to the signed method and file.
+func NewPresignedURLMiddleware(signer *auth.URLSigner, logger *zap.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			query := request.URL.Query()
+			if !auth.IsPresigned(query) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			ctx := request.Context()
+			requestLogger := logging.FromContext(ctx, logger)
+
+			presigned, err := signer.Verify(request.Method, fileKeyOf(request), query, time.Now())
+			if err != nil {
+				requestLogger.Warn("presigned url rejected", zap.Error(err))
+				writePlainErr(writer, err, http.StatusForbidden, requestLogger)
+				return
+			}
+
+			if presigned.MaxSize > 0 {
+				if request.ContentLength > presigned.MaxSize {
+					writePlainErr(writer, errPayloadTooLarge, http.StatusRequestEntityTooLarge, requestLogger)
+					return
+				}
+				request.Body = http.MaxBytesReader(writer, request.Body, presigned.MaxSize)
+			}
+
+			// NOTE: Holder of URL acts on behalf of the issuer, e.g. uploads are accounted in issuer quota.
+			principal := &auth.Principal{
+				Name:        presigned.Principal,
+				Namespace:   presigned.Key().String(),
+				Permissions: []auth.Permission{presigned.Permission()},
+			}
+			requestLogger = requestLogger.With(zap.String("principal", principal.Name), zap.Bool("presigned", true))
+			ctx = logging.WithLogger(auth.WithPrincipal(ctx, principal), requestLogger)
+
+			next.ServeHTTP(writer, request.WithContext(ctx))
+		})
+	}
+}
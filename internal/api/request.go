@@ -0,0 +1,73 @@
+package api
+
+import (
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"karma8/internal/logging"
+	"net/http"
+	"time"
+)
+
+// maxRequestIDLength protects logs from huge client provided ids.
+const maxRequestIDLength = 128
+
+type accessRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (m *accessRecorder) WriteHeader(status int) {
+	m.status = status
+	m.ResponseWriter.WriteHeader(status)
+}
+
+func (m *accessRecorder) Write(data []byte) (int, error) {
+	n, err := m.ResponseWriter.Write(data)
+	m.written += int64(n)
+	return n, err
+}
+
+// NewRequestMiddleware assigns request id, puts request-scoped logger into the context and writes access log.
+func NewRequestMiddleware(logger *zap.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			startTime := time.Now()
+
+			requestID := request.Header.Get(logging.HeaderRequestID)
+			if requestID == "" || len(requestID) > maxRequestIDLength {
+				requestID = uuid.New().String()
+			}
+			writer.Header().Set(logging.HeaderRequestID, requestID)
+
+			fields := []zap.Field{
+				zap.String("request_id", requestID),
+				zap.String("method", request.Method),
+			}
+			if bucket, ok := mux.Vars(request)["bucket"]; ok {
+				fields = append(fields, zap.String("bucket", bucket))
+			}
+			if filename, ok := mux.Vars(request)["filename"]; ok {
+				fields = append(fields, zap.String("filename", filename))
+			}
+			requestLogger := logger.With(fields...)
+
+			ctx := logging.WithRequestID(request.Context(), requestID)
+			ctx = logging.WithLogger(ctx, requestLogger)
+
+			recorder := &accessRecorder{ResponseWriter: writer, status: http.StatusOK}
+			next.ServeHTTP(recorder, request.WithContext(ctx))
+
+			requestLogger.Info(
+				"access",
+				zap.String("path", request.URL.Path),
+				zap.String("remote_addr", request.RemoteAddr),
+				zap.Int("status", recorder.status),
+				zap.Int64("bytes_in", request.ContentLength),
+				zap.Int64("bytes_out", recorder.written),
+				zap.Duration("duration", time.Since(startTime)),
+			)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	queryLimit = "limit"
+
+	defaultDeletedFilesLimit = 100
+)
+
+type deletedFile struct {
+	ID            int64     `json:"id"`
+	Bucket        string    `json:"bucket"`
+	Filename      string    `json:"filename"`
+	Tenant        string    `json:"tenant"`
+	ContentLength int64     `json:"content_length"`
+	CreateTime    time.Time `json:"create_time"`
+	DeleteTime    time.Time `json:"delete_time"`
+}
+
+func convertDeletedFile(file *karma8.DeletedFile) *deletedFile {
+	return &deletedFile{
+		ID:            file.ID,
+		Bucket:        file.Meta.Bucket,
+		Filename:      file.Meta.Name,
+		Tenant:        file.Meta.Tenant,
+		ContentLength: file.Meta.ContentLength,
+		CreateTime:    file.Meta.CreateTime,
+		DeleteTime:    file.DeleteTime,
+	}
+}
+
+// NewListDeletedFilesHandler returns files of the bucket which are in trash, recently deleted ones go first.
+func NewListDeletedFilesHandler(trashStorage karma8.TrashStorage, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		limit := defaultDeletedFilesLimit
+		if rawLimit := request.URL.Query().Get(queryLimit); rawLimit != "" {
+			parsed, err := strconv.Atoi(rawLimit)
+			if err != nil || parsed <= 0 {
+				writePlainErr(writer, errors.New("limit must be positive"), http.StatusBadRequest, logger)
+				return
+			}
+			limit = parsed
+		}
+
+		files, err := trashStorage.ListDeletedFiles(request.Context(), mux.Vars(request)["bucket"], limit)
+		if err != nil {
+			logger.Error("can't list deleted files", zap.Error(err))
+			writePlainInternalErr(writer, err, logger)
+			return
+		}
+
+		result := make([]*deletedFile, 0, len(files))
+		for _, file := range files {
+			result = append(result, convertDeletedFile(file))
+		}
+		writeJSON(writer, result, http.StatusOK, logger)
+	}
+}
+
+// NewRestoreDeletedFileHandler moves file back from trash, it's possible until the file is purged.
+func NewRestoreDeletedFileHandler(trashStorage karma8.TrashStorage, logger *zap.Logger) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+
+		id, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+		if err != nil {
+			writePlainErr(writer, errors.New("bad deleted file id"), http.StatusBadRequest, logger)
+			return
+		}
+
+		fileMeta, err := trashStorage.RestoreDeletedFile(request.Context(), id)
+		if err != nil {
+			logger.Error("can't restore deleted file", zap.Int64("id", id), zap.Error(err))
+			switch {
+			case errors.Is(err, karma8.ErrDeletedFileNotFound):
+				writePlainErr(writer, err, http.StatusNotFound, logger)
+			case errors.Is(err, karma8.ErrFileAlreadyExists):
+				writePlainErr(writer, err, http.StatusConflict, logger)
+			default:
+				writePlainInternalErr(writer, err, logger)
+			}
+			return
+		}
+
+		logger.Info(
+			"deleted file restored",
+			zap.String("bucket", fileMeta.Bucket),
+			zap.String("filename", fileMeta.Name),
+		)
+	}
+}
@@ -5,34 +5,72 @@ import (
 	"fmt"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
+	"karma8/internal/health"
+	"karma8/internal/tlsreload"
 	"net/http"
 	"time"
 )
 
+type backgroundJob interface {
+	Run(ctx context.Context) error
+}
+
 type Application struct {
-	server          *http.Server
+	servers         []*http.Server
+	jobs            []backgroundJob
 	shutdownTimeout time.Duration
+	health          *health.Checker
+	// shutdownDelay gives load balancers time to notice readiness failure.
+	shutdownDelay time.Duration
+	// shutdownTracing flushes spans, it's called after servers stop accepting requests.
+	shutdownTracing func(ctx context.Context) error
 	logger          *zap.Logger
 }
 
 func (m *Application) Run(ctx context.Context) error {
 	group, ctx := errgroup.WithContext(ctx)
-	group.Go(func() error {
-		m.logger.Info("server start listening", zap.String("addr", m.server.Addr))
-		if err := m.server.ListenAndServe(); err != nil {
-			return fmt.Errorf("listen and server error: %w", err)
-		}
-		return nil
-	})
+	for _, server := range m.servers {
+		server := server
+		group.Go(func() error {
+			m.logger.Info("server start listening", zap.String("addr", server.Addr))
+			listen := server.ListenAndServe
+			if server.TLSConfig != nil {
+				// NOTE: Certificate is taken from TLSConfig, so it's reloaded without restart.
+				listen = func() error {
+					return server.ListenAndServeTLS("", "")
+				}
+			}
+			if err := listen(); err != nil {
+				return fmt.Errorf("listen and server error: %w", err)
+			}
+			return nil
+		})
+	}
+
+	for _, job := range m.jobs {
+		job := job
+		group.Go(func() error {
+			return job.Run(ctx)
+		})
+	}
 
 	group.Go(func() error {
 		<-ctx.Done()
 
 		m.logger.Info("graceful shutdown of server")
+		m.health.StartShutdown()
+		time.Sleep(m.shutdownDelay)
+
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
 		defer cancel()
-		if err := m.server.Shutdown(shutdownCtx); err != nil {
-			return fmt.Errorf("shutdown error: %w", err)
+		for _, server := range m.servers {
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				return fmt.Errorf("shutdown error: %w", err)
+			}
+		}
+
+		if err := m.shutdownTracing(shutdownCtx); err != nil {
+			return fmt.Errorf("tracing shutdown error: %w", err)
 		}
 
 		return ctx.Err()
@@ -42,6 +80,34 @@ func (m *Application) Run(ctx context.Context) error {
 }
 
 func NewApplication(conf *Config, logger *zap.Logger) (*Application, error) {
+	shutdownTracing, err := setupTracing(&conf.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticator, err := newAuthenticator(&conf.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring, err := newKeyring(&conf.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	httpTLSReloader, err := newServerTLSReloader(&conf.HTTP.TLS, logger)
+	if err != nil {
+		return nil, err
+	}
+	adminTLSReloader, err := newServerTLSReloader(&conf.AdminHTTP.TLS, logger)
+	if err != nil {
+		return nil, err
+	}
+	storageTLSReloader, err := newTLSReloader(&conf.Storage.TLS, logger)
+	if err != nil {
+		return nil, err
+	}
+
 	balancer := newBalancer(&conf.Balancer)
 	pg, err := newPG(&conf.PG, logger)
 	if err != nil {
@@ -49,12 +115,132 @@ func NewApplication(conf *Config, logger *zap.Logger) (*Application, error) {
 	}
 
 	fileMetaStorage := newFileMetaStorage(pg, logger)
+	bucketStorage := newBucketStorage(&conf.Bucket, pg, logger)
+	cursorStorage := newCursorStorage(pg, logger)
+	damageStorage := newDamageStorage(pg, logger)
+	orphanStorage := newOrphanStorage(pg, logger)
+	trashStorage := newTrashStorage(pg, logger)
+	blobStorage := newBlobStorage(pg, logger)
+	keyStorage := newKeyStorage(pg, logger)
+	jobLocker := newJobLocker(pg, logger)
+	evacuationStorage := newEvacuationStorage(pg, logger)
+	storageHolder := newStorageHolder(&conf.Storage, storageTLSReloader, logger)
+	healthChecker := newHealthChecker(&conf.Health, &conf.Balancer, pg, storageHolder, logger)
+	cleaner := newPartCleaner(storageHolder, fileMetaStorage, orphanStorage, logger)
 
-	fileService := newFileService(balancer, fileMetaStorage, conf.MinChunkSize, conf.HostSplitCount, logger)
+	fileService := newFileService(
+		conf,
+		balancer,
+		storageHolder,
+		fileMetaStorage,
+		bucketStorage,
+		blobStorage,
+		cleaner,
+		keyring,
+		logger,
+	)
+
+	mover := newPartMover(storageHolder, fileMetaStorage, trashStorage, logger)
+	evacuator := newEvacuator(
+		&conf.Evacuator,
+		balancer,
+		fileMetaStorage,
+		bucketStorage,
+		evacuationStorage,
+		trashStorage,
+		mover,
+		jobLocker,
+		logger,
+	)
+
+	jobs := []backgroundJob{evacuator, newDrainMonitor(&conf.Evacuator, balancer, evacuationStorage, logger)}
+	for _, reloader := range []*tlsreload.Reloader{httpTLSReloader, adminTLSReloader, storageTLSReloader} {
+		if reloader != nil {
+			jobs = append(jobs, reloader)
+		}
+	}
+	if conf.Quota.DefaultNodeBytes > 0 || len(conf.Quota.Nodes) > 0 {
+		jobs = append(jobs, newCapacityMonitor(&conf.Quota, balancer, fileMetaStorage, logger))
+	}
+	if conf.Rebalancer.Enabled {
+		jobs = append(jobs, newRebalancer(
+			&conf.Rebalancer,
+			&conf.Balancer,
+			balancer,
+			fileMetaStorage,
+			bucketStorage,
+			cursorStorage,
+			evacuationStorage,
+			mover,
+			jobLocker,
+			logger,
+		))
+	}
+	if conf.Scrubber.Enabled {
+		jobs = append(jobs, newScrubber(
+			&conf.Scrubber,
+			storageHolder,
+			fileMetaStorage,
+			cursorStorage,
+			damageStorage,
+			mover,
+			jobLocker,
+			logger,
+		))
+	}
+	if conf.Janitor.Enabled {
+		jobs = append(jobs, newJanitor(
+			&conf.Janitor,
+			&conf.Balancer,
+			storageHolder,
+			fileMetaStorage,
+			orphanStorage,
+			blobStorage,
+			cleaner,
+			jobLocker,
+			logger,
+		))
+	}
+	if conf.Expirer.Enabled {
+		jobs = append(jobs, newExpirer(&conf.Expirer, fileMetaStorage, jobLocker, logger))
+	}
+	if conf.Purger.Enabled {
+		jobs = append(jobs, newPurger(&conf.Purger, trashStorage, cleaner, jobLocker, logger))
+	}
+	if conf.Rewrapper.Enabled && keyring.ActiveKeyID() != "" {
+		jobs = append(jobs, newRewrapper(&conf.Rewrapper, keyStorage, keyring, jobLocker, logger))
+	}
 
 	return &Application{
-		server:          newHTTPServer(&conf.HTTP, fileService, logger),
+		servers: []*http.Server{
+			newHTTPServer(
+				&conf.HTTP,
+				fileService,
+				healthChecker,
+				authenticator,
+				newURLSigner(&conf.Presign),
+				&conf.Presign,
+				&conf.Limits,
+				httpTLSReloader,
+				logger,
+			),
+			newAdminHTTPServer(
+				&conf.AdminHTTP,
+				authenticator,
+				evacuator,
+				damageStorage,
+				bucketStorage,
+				trashStorage,
+				fileMetaStorage,
+				adminTLSReloader,
+				logger,
+			),
+		},
+		jobs:            jobs,
 		shutdownTimeout: conf.ShutdownTimeout,
+		shutdownTracing: shutdownTracing,
+		health:          healthChecker,
+		shutdownDelay:   conf.Health.ShutdownDelay,
 		logger:          logger,
 	}, nil
 }
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"karma8/internal/auth"
+	"os"
+)
+
+func newAPIKeyAuthenticator(conf []APIKeyConfig) (auth.Authenticator, error) {
+	keyToPrincipal := make(map[string]*auth.Principal, len(conf))
+	for _, keyConf := range conf {
+		if _, ok := keyToPrincipal[keyConf.Key]; ok {
+			return nil, fmt.Errorf("duplicated api key of principal %s", keyConf.Principal)
+		}
+
+		permissions := make([]auth.Permission, 0, len(keyConf.Permissions))
+		for _, permission := range keyConf.Permissions {
+			permissions = append(permissions, auth.Permission(permission))
+		}
+
+		keyToPrincipal[keyConf.Key] = &auth.Principal{
+			Name:        keyConf.Principal,
+			Namespace:   keyConf.Namespace,
+			Permissions: permissions,
+		}
+	}
+	return auth.NewAPIKeyAuthenticator(keyToPrincipal), nil
+}
+
+func newJWTAuthenticator(conf *JWTConfig) (auth.Authenticator, error) {
+	var publicKey []byte
+	if conf.Secret == "" {
+		var err error
+		publicKey, err = os.ReadFile(conf.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read jwt public key: %w", err)
+		}
+	}
+
+	return auth.NewJWTAuthenticator([]byte(conf.Secret), publicKey)
+}
+
+// newURLSigner returns nil if presigned URLs are disabled.
+func newURLSigner(conf *PresignConfig) *auth.URLSigner {
+	if conf.Secret == "" {
+		return nil
+	}
+	return auth.NewURLSigner([]byte(conf.Secret))
+}
+
+func newAuthenticator(conf *AuthConfig) (auth.Authenticator, error) {
+	if !conf.Enabled {
+		return auth.NewAnonymousAuthenticator(), nil
+	}
+
+	var authenticators []auth.Authenticator
+	if len(conf.APIKeys) > 0 {
+		authenticator, err := newAPIKeyAuthenticator(conf.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+	if conf.HMACSecret != "" {
+		authenticators = append(authenticators, auth.NewHMACAuthenticator([]byte(conf.HMACSecret)))
+	}
+	if conf.JWT.Secret != "" || conf.JWT.PublicKeyFile != "" {
+		authenticator, err := newJWTAuthenticator(&conf.JWT)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, authenticator)
+	}
+
+	if len(authenticators) == 0 {
+		return nil, errors.New("auth is enabled, but no authentication method is configured")
+	}
+	return auth.NewChain(authenticators...), nil
+}
@@ -1,10 +1,36 @@
 package server
 
 import (
+	"go.uber.org/zap"
 	"karma8"
 	"karma8/internal/balancer"
 )
 
-func newBalancer(conf *BalancerConfig) karma8.Balancer {
-	return balancer.NewWeightedRoundRobinBalancer(conf.HostToWeight)
+func newBalancer(conf *BalancerConfig) *balancer.DrainingBalancer {
+	return balancer.NewDrainingBalancer(balancer.NewWeightedRoundRobinBalancer(conf.HostToWeight))
+}
+
+func newDrainMonitor(
+	conf *EvacuatorConfig,
+	b *balancer.DrainingBalancer,
+	evacuationStorage karma8.EvacuationStorage,
+	logger *zap.Logger,
+) *balancer.DrainMonitor {
+	return balancer.NewDrainMonitor(b, evacuationStorage, conf.Interval, logger)
+}
+
+func newCapacityMonitor(
+	conf *QuotaConfig,
+	b *balancer.DrainingBalancer,
+	fileMetaStorage karma8.FileMetaStorage,
+	logger *zap.Logger,
+) *balancer.CapacityMonitor {
+	return balancer.NewCapacityMonitor(
+		b,
+		fileMetaStorage,
+		conf.Nodes,
+		conf.DefaultNodeBytes,
+		conf.NodeUsageInterval,
+		logger,
+	)
 }
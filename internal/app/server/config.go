@@ -2,8 +2,39 @@ package server
 
 import "time"
 
+type TLSConfig struct {
+	Enabled bool `config:"enabled" yaml:"enabled"`
+	// CertFile and KeyFile are PEM encoded certificate and key, they're presented to storages if it's client config.
+	CertFile string `config:"cert_file" yaml:"cert_file"`
+	KeyFile  string `config:"key_file" yaml:"key_file"`
+	// CAFile verifies peers: listener requires client certificates signed by it, client verifies storages by it.
+	// System roots verify storages if it's empty.
+	CAFile string `config:"ca_file" yaml:"ca_file"`
+	// ReloadInterval is how often files are checked for modification, modified ones are reloaded without restart.
+	ReloadInterval time.Duration `config:"reload_interval" yaml:"reload_interval"`
+}
+
 type HTTPConfig struct {
-	Addr string `config:"addr" yaml:"addr"`
+	Addr              string        `config:"addr" yaml:"addr"`
+	ReadHeaderTimeout time.Duration `config:"read_header_timeout" yaml:"read_header_timeout"`
+	// ReadTimeout and WriteTimeout cover the whole body, so they limit transfer time of the biggest object.
+	ReadTimeout    time.Duration `config:"read_timeout" yaml:"read_timeout"`
+	WriteTimeout   time.Duration `config:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout    time.Duration `config:"idle_timeout" yaml:"idle_timeout"`
+	MaxHeaderBytes int           `config:"max_header_bytes" yaml:"max_header_bytes"`
+	TLS            TLSConfig     `config:"tls" yaml:"tls"`
+}
+
+type LimitsConfig struct {
+	// MaxObjectSize limits size of uploaded file, zero means unlimited.
+	MaxObjectSize int64 `config:"max_object_size" yaml:"max_object_size"`
+	// MaxConcurrentUploads limits simultaneous uploads of every principal, zero means unlimited.
+	// Anonymous uploads are limited per client IP.
+	MaxConcurrentUploads int `config:"max_concurrent_uploads" yaml:"max_concurrent_uploads"`
+	// RateLimit is allowed requests per second from every IP, zero disables rate limiting.
+	RateLimit         float64 `config:"rate_limit" yaml:"rate_limit"`
+	RateBurst         int     `config:"rate_burst" yaml:"rate_burst"`
+	TrustForwardedFor bool    `config:"trust_forwarded_for" yaml:"trust_forwarded_for"`
 }
 
 type BalancerConfig struct {
@@ -16,13 +47,190 @@ type PGConfig struct {
 	DB       string `config:"db" yaml:"db"`
 	User     string `config:"user" yaml:"user"`
 	Password string `config:"password" yaml:"password"`
+	// SSLMode is one of disable, require, verify-ca or verify-full, empty value means disable.
+	SSLMode string `config:"ssl_mode" yaml:"ssl_mode"`
+	// SSLRootCert verifies server, SSLCert and SSLKey are client certificate and key.
+	// Files are read on every new connection, so rotated files are used without restart.
+	SSLRootCert string `config:"ssl_root_cert" yaml:"ssl_root_cert"`
+	SSLCert     string `config:"ssl_cert" yaml:"ssl_cert"`
+	SSLKey      string `config:"ssl_key" yaml:"ssl_key"`
+}
+
+type RetryConfig struct {
+	MaxAttempts    int           `config:"max_attempts" yaml:"max_attempts"`
+	InitialBackoff time.Duration `config:"initial_backoff" yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `config:"max_backoff" yaml:"max_backoff"`
+	AttemptTimeout time.Duration `config:"attempt_timeout" yaml:"attempt_timeout"`
+	BudgetRatio    float64       `config:"budget_ratio" yaml:"budget_ratio"`
+	BudgetCapacity float64       `config:"budget_capacity" yaml:"budget_capacity"`
+}
+
+type StorageConfig struct {
+	// Kind is either memory or http.
+	Kind  string      `config:"kind" yaml:"kind"`
+	Retry RetryConfig `config:"retry" yaml:"retry"`
+	// TLS makes https default scheme of storage URLs, client certificate is presented to storages for mutual TLS.
+	TLS TLSConfig `config:"tls" yaml:"tls"`
+}
+
+type TracingConfig struct {
+	// Exporter is one of stdout or otlp, tracing is disabled if it's empty.
+	Exporter    string  `config:"exporter" yaml:"exporter"`
+	Endpoint    string  `config:"endpoint" yaml:"endpoint"`
+	Insecure    bool    `config:"insecure" yaml:"insecure"`
+	SampleRatio float64 `config:"sample_ratio" yaml:"sample_ratio"`
+}
+
+type HedgeConfig struct {
+	// Percentile of recent read latencies used as hedging delay, zero disables hedged reads.
+	Percentile float64       `config:"percentile" yaml:"percentile"`
+	MinDelay   time.Duration `config:"min_delay" yaml:"min_delay"`
+}
+
+type RebalancerConfig struct {
+	Enabled           bool          `config:"enabled" yaml:"enabled"`
+	Interval          time.Duration `config:"interval" yaml:"interval"`
+	BatchSize         int           `config:"batch_size" yaml:"batch_size"`
+	Threshold         float64       `config:"threshold" yaml:"threshold"`
+	MaxBytesPerSecond int64         `config:"max_bytes_per_second" yaml:"max_bytes_per_second"`
+}
+
+type ScrubberConfig struct {
+	Enabled           bool          `config:"enabled" yaml:"enabled"`
+	Interval          time.Duration `config:"interval" yaml:"interval"`
+	BatchSize         int           `config:"batch_size" yaml:"batch_size"`
+	MaxBytesPerSecond int64         `config:"max_bytes_per_second" yaml:"max_bytes_per_second"`
+	Repair            bool          `config:"repair" yaml:"repair"`
+}
+
+type JanitorConfig struct {
+	Enabled     bool          `config:"enabled" yaml:"enabled"`
+	Interval    time.Duration `config:"interval" yaml:"interval"`
+	GracePeriod time.Duration `config:"grace_period" yaml:"grace_period"`
+	BatchSize   int           `config:"batch_size" yaml:"batch_size"`
+}
+
+type ExpirerConfig struct {
+	Enabled   bool          `config:"enabled" yaml:"enabled"`
+	Interval  time.Duration `config:"interval" yaml:"interval"`
+	BatchSize int           `config:"batch_size" yaml:"batch_size"`
+}
+
+type PurgerConfig struct {
+	Enabled  bool          `config:"enabled" yaml:"enabled"`
+	Interval time.Duration `config:"interval" yaml:"interval"`
+	// RestoreWindow is how long deleted files are kept in trash before their parts are deleted.
+	RestoreWindow time.Duration `config:"restore_window" yaml:"restore_window"`
+	BatchSize     int           `config:"batch_size" yaml:"batch_size"`
+}
+
+type RewrapperConfig struct {
+	Enabled   bool          `config:"enabled" yaml:"enabled"`
+	Interval  time.Duration `config:"interval" yaml:"interval"`
+	BatchSize int           `config:"batch_size" yaml:"batch_size"`
+}
+
+type EncryptionConfig struct {
+	// Enabled encrypts new files, master keys are still used to read encrypted files if it's disabled.
+	Enabled bool `config:"enabled" yaml:"enabled"`
+	// ActiveKeyID is ID of the master key wrapping data keys of new files, keys are rewrapped by it after rotation.
+	ActiveKeyID string `config:"active_key_id" yaml:"active_key_id"`
+	// MasterKeys are base64 encoded 256-bit keys by ID.
+	MasterKeys map[string]string `config:"master_keys" yaml:"master_keys"`
+	// KeyFile has more master keys, every line has key ID and base64 encoded key separated by space.
+	KeyFile string `config:"key_file" yaml:"key_file"`
+}
+
+type APIKeyConfig struct {
+	Key       string `config:"key" yaml:"key"`
+	Principal string `config:"principal" yaml:"principal"`
+	// Namespace is prefix of filenames available to the principal, it is matched by whole path segments.
+	Namespace   string   `config:"namespace" yaml:"namespace"`
+	Permissions []string `config:"permissions" yaml:"permissions"`
+}
+
+type JWTConfig struct {
+	// Secret is HMAC key, PublicKeyFile with PEM encoded RSA or ECDSA key is used if it's empty.
+	Secret        string `config:"secret" yaml:"secret"`
+	PublicKeyFile string `config:"public_key_file" yaml:"public_key_file"`
+}
+
+type AuthConfig struct {
+	// Enabled false gives full access to everyone.
+	Enabled bool           `config:"enabled" yaml:"enabled"`
+	APIKeys []APIKeyConfig `config:"api_keys" yaml:"api_keys"`
+	// HMACSecret enables tokens signed by the secret if it's set.
+	HMACSecret string    `config:"hmac_secret" yaml:"hmac_secret"`
+	JWT        JWTConfig `config:"jwt" yaml:"jwt"`
+}
+
+type PresignConfig struct {
+	// Secret signs presigned URLs, they are disabled if it's empty.
+	Secret string `config:"secret" yaml:"secret"`
+	// BaseURL is external URL of the service, issued URLs are relative if it's empty.
+	BaseURL   string        `config:"base_url" yaml:"base_url"`
+	MaxExpiry time.Duration `config:"max_expiry" yaml:"max_expiry"`
+}
+
+type BucketConfig struct {
+	// CacheTTL is how long bucket settings are cached, changes made through other instances are visible after it.
+	CacheTTL time.Duration `config:"cache_ttl" yaml:"cache_ttl"`
+}
+
+type QuotaConfig struct {
+	// DefaultTenantBytes limits tenants without own quota in Tenants, zero means unlimited.
+	DefaultTenantBytes int64            `config:"default_tenant_bytes" yaml:"default_tenant_bytes"`
+	Tenants            map[string]int64 `config:"tenants" yaml:"tenants"`
+	// DefaultNodeBytes is capacity of storages without own capacity in Nodes, zero means unlimited.
+	DefaultNodeBytes int64            `config:"default_node_bytes" yaml:"default_node_bytes"`
+	Nodes            map[string]int64 `config:"nodes" yaml:"nodes"`
+	// NodeUsageInterval is how often storage usage is refreshed to check node capacity.
+	NodeUsageInterval time.Duration `config:"node_usage_interval" yaml:"node_usage_interval"`
+}
+
+type HealthConfig struct {
+	MinHealthyStorages int           `config:"min_healthy_storages" yaml:"min_healthy_storages"`
+	CheckTimeout       time.Duration `config:"check_timeout" yaml:"check_timeout"`
+	// ShutdownDelay is time between readiness failure and server shutdown, load balancers drain traffic meanwhile.
+	ShutdownDelay time.Duration `config:"shutdown_delay" yaml:"shutdown_delay"`
+}
+
+type EvacuatorConfig struct {
+	// Interval between checks for started evacuations, drained hosts are refreshed with the same interval.
+	Interval  time.Duration `config:"interval" yaml:"interval"`
+	BatchSize int           `config:"batch_size" yaml:"batch_size"`
 }
 
 type Config struct {
-	HTTP            HTTPConfig     `config:"http" yaml:"http"`
-	Balancer        BalancerConfig `config:"balancer" yaml:"balancer"`
-	PG              PGConfig       `config:"pg" yaml:"pg"`
-	ShutdownTimeout time.Duration  `config:"shutdown_timeout" yaml:"shutdown_timeout"`
-	MinChunkSize    int64          `config:"min_chunk_size" yaml:"min_chunk_size"`
-	HostSplitCount  int            `config:"host_split_count" yaml:"host_split_count"`
+	HTTP            HTTPConfig       `config:"http" yaml:"http"`
+	AdminHTTP       HTTPConfig       `config:"admin_http" yaml:"admin_http"`
+	Balancer        BalancerConfig   `config:"balancer" yaml:"balancer"`
+	PG              PGConfig         `config:"pg" yaml:"pg"`
+	Storage         StorageConfig    `config:"storage" yaml:"storage"`
+	Tracing         TracingConfig    `config:"tracing" yaml:"tracing"`
+	Health          HealthConfig     `config:"health" yaml:"health"`
+	Bucket          BucketConfig     `config:"bucket" yaml:"bucket"`
+	Quota           QuotaConfig      `config:"quota" yaml:"quota"`
+	Limits          LimitsConfig     `config:"limits" yaml:"limits"`
+	Auth            AuthConfig       `config:"auth" yaml:"auth"`
+	Presign         PresignConfig    `config:"presign" yaml:"presign"`
+	Rebalancer      RebalancerConfig `config:"rebalancer" yaml:"rebalancer"`
+	Evacuator       EvacuatorConfig  `config:"evacuator" yaml:"evacuator"`
+	Scrubber        ScrubberConfig   `config:"scrubber" yaml:"scrubber"`
+	Janitor         JanitorConfig    `config:"janitor" yaml:"janitor"`
+	Expirer         ExpirerConfig    `config:"expirer" yaml:"expirer"`
+	Purger          PurgerConfig     `config:"purger" yaml:"purger"`
+	Rewrapper       RewrapperConfig  `config:"rewrapper" yaml:"rewrapper"`
+	Encryption      EncryptionConfig `config:"encryption" yaml:"encryption"`
+	ShutdownTimeout time.Duration    `config:"shutdown_timeout" yaml:"shutdown_timeout"`
+	MinChunkSize    int64            `config:"min_chunk_size" yaml:"min_chunk_size"`
+	HostSplitCount  int              `config:"host_split_count" yaml:"host_split_count"`
+	// ReplicationFactor is amount of storages keeping every part, host_split_count * replication_factor hosts
+	// are required for every file.
+	ReplicationFactor int `config:"replication_factor" yaml:"replication_factor"`
+	// ReadAttempts limits attempts to read every part during download, failed read is resumed on another replica.
+	ReadAttempts int `config:"read_attempts" yaml:"read_attempts"`
+	// MaxBufferedPart is maximal size of the part buffered in memory during upload, so upload could be retried.
+	MaxBufferedPart int64       `config:"max_buffered_part" yaml:"max_buffered_part"`
+	Hedge           HedgeConfig `config:"hedge" yaml:"hedge"`
 }
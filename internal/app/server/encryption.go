@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"karma8/internal/encryption"
+)
+
+// newKeyring builds keyring even if encryption is disabled, so files encrypted before are still readable.
+func newKeyring(conf *EncryptionConfig) (*encryption.Keyring, error) {
+	masterKeys := make(map[string][]byte, len(conf.MasterKeys))
+	for keyID, encodedKey := range conf.MasterKeys {
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode master key %s: %w", keyID, err)
+		}
+		masterKeys[keyID] = key
+	}
+
+	if conf.KeyFile != "" {
+		fileKeys, err := encryption.LoadKeyFile(conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load key file: %w", err)
+		}
+		for keyID, key := range fileKeys {
+			if _, ok := masterKeys[keyID]; ok {
+				return nil, fmt.Errorf("duplicated master key %s", keyID)
+			}
+			masterKeys[keyID] = key
+		}
+	}
+
+	activeKeyID := ""
+	if conf.Enabled {
+		if conf.ActiveKeyID == "" {
+			return nil, errors.New("encryption is enabled, but no active master key is configured")
+		}
+		activeKeyID = conf.ActiveKeyID
+	}
+	return encryption.NewKeyring(activeKeyID, masterKeys)
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/balancer"
+	"karma8/internal/evacuator"
+	"karma8/internal/partmover"
+)
+
+func newEvacuator(
+	conf *EvacuatorConfig,
+	balancer *balancer.DrainingBalancer,
+	fileMetaStorage karma8.FileMetaStorage,
+	bucketStorage karma8.BucketStorage,
+	evacuationStorage karma8.EvacuationStorage,
+	trashStorage karma8.TrashStorage,
+	mover *partmover.Mover,
+	jobLocker karma8.JobLocker,
+	logger *zap.Logger,
+) *evacuator.Evacuator {
+	return evacuator.New(
+		balancer,
+		fileMetaStorage,
+		bucketStorage,
+		evacuationStorage,
+		trashStorage,
+		mover,
+		jobLocker,
+		conf.BatchSize,
+		conf.Interval,
+		logger,
+	)
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/expirer"
+)
+
+func newExpirer(
+	conf *ExpirerConfig,
+	fileMetaStorage karma8.FileMetaStorage,
+	jobLocker karma8.JobLocker,
+	logger *zap.Logger,
+) *expirer.Expirer {
+	return expirer.New(
+		fileMetaStorage,
+		jobLocker,
+		expirer.Options{
+			Interval:  conf.Interval,
+			BatchSize: conf.BatchSize,
+		},
+		logger,
+	)
+}
@@ -5,8 +5,49 @@ import (
 	"go.uber.org/zap"
 	"karma8"
 	"karma8/internal/filemetastorage"
+	"karma8/internal/metrics"
+	"karma8/internal/tracing"
 )
 
 func newFileMetaStorage(pg *sqlx.DB, logger *zap.Logger) karma8.FileMetaStorage {
-	return filemetastorage.NewPGStorage(pg, logger)
+	return metrics.NewFileMetaStorage(tracing.NewFileMetaStorage(filemetastorage.NewPGStorage(pg, logger)))
+}
+
+func newBucketStorage(conf *BucketConfig, pg *sqlx.DB, logger *zap.Logger) karma8.BucketStorage {
+	return filemetastorage.NewCachedBucketStorage(
+		metrics.NewBucketStorage(filemetastorage.NewPGBucketStorage(pg, logger)),
+		conf.CacheTTL,
+	)
+}
+
+func newCursorStorage(pg *sqlx.DB, logger *zap.Logger) karma8.CursorStorage {
+	return metrics.NewCursorStorage(filemetastorage.NewPGCursorStorage(pg, logger))
+}
+
+func newDamageStorage(pg *sqlx.DB, logger *zap.Logger) karma8.DamageStorage {
+	return metrics.NewDamageStorage(filemetastorage.NewPGDamageStorage(pg, logger))
+}
+
+func newOrphanStorage(pg *sqlx.DB, logger *zap.Logger) karma8.OrphanStorage {
+	return metrics.NewOrphanStorage(filemetastorage.NewPGOrphanStorage(pg, logger))
+}
+
+func newTrashStorage(pg *sqlx.DB, logger *zap.Logger) karma8.TrashStorage {
+	return metrics.NewTrashStorage(filemetastorage.NewPGTrashStorage(pg, logger))
+}
+
+func newBlobStorage(pg *sqlx.DB, logger *zap.Logger) karma8.BlobStorage {
+	return metrics.NewBlobStorage(filemetastorage.NewPGBlobStorage(pg, logger))
+}
+
+func newKeyStorage(pg *sqlx.DB, logger *zap.Logger) karma8.KeyStorage {
+	return metrics.NewKeyStorage(filemetastorage.NewPGKeyStorage(pg, logger))
+}
+
+func newJobLocker(pg *sqlx.DB, logger *zap.Logger) karma8.JobLocker {
+	return metrics.NewJobLocker(filemetastorage.NewPGJobLocker(pg, logger))
+}
+
+func newEvacuationStorage(pg *sqlx.DB, logger *zap.Logger) karma8.EvacuationStorage {
+	return metrics.NewEvacuationStorage(filemetastorage.NewPGEvacuationStorage(pg, logger))
 }
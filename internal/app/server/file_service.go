@@ -3,17 +3,55 @@ package server
 import (
 	"go.uber.org/zap"
 	"karma8"
+	"karma8/internal/encryption"
 	"karma8/internal/fileservice"
-	"karma8/internal/storageholder"
+	"karma8/internal/metrics"
+	"karma8/internal/partcleaner"
+	"karma8/internal/tracing"
 )
 
+func newPartCleaner(
+	storageHolder karma8.StorageHolder,
+	fileMetaStorage karma8.FileMetaStorage,
+	orphanStorage karma8.OrphanStorage,
+	logger *zap.Logger,
+) *partcleaner.Cleaner {
+	return partcleaner.New(storageHolder, fileMetaStorage, orphanStorage, logger)
+}
+
 func newFileService(
-	balancer karma8.Balancer,
+	conf *Config,
+	balancer karma8.FilteringBalancer,
+	storageHolder karma8.StorageHolder,
 	fileMetaStorage karma8.FileMetaStorage,
-	minChunkSize int64,
-	hostSplitCount int,
+	bucketStorage karma8.BucketStorage,
+	blobStorage karma8.BlobStorage,
+	cleaner *partcleaner.Cleaner,
+	keyring *encryption.Keyring,
 	logger *zap.Logger,
 ) karma8.FileService {
-	storageHolder := storageholder.New()
-	return fileservice.New(balancer, storageHolder, fileMetaStorage, minChunkSize, hostSplitCount, logger)
+	service := fileservice.New(
+		tracing.NewBalancer(metrics.NewBalancer(balancer)),
+		storageHolder,
+		fileMetaStorage,
+		bucketStorage,
+		blobStorage,
+		cleaner,
+		keyring,
+		fileservice.Options{
+			MinChunkSize:      conf.MinChunkSize,
+			HostSplitCount:    conf.HostSplitCount,
+			ReplicationFactor: conf.ReplicationFactor,
+			ReadAttempts:      conf.ReadAttempts,
+			MaxBufferedPart:   conf.MaxBufferedPart,
+			HedgePercentile:   conf.Hedge.Percentile,
+			HedgeMinDelay:     conf.Hedge.MinDelay,
+			// NOTE: Tenant is a name of authenticated principal.
+			DefaultTenantQuota: conf.Quota.DefaultTenantBytes,
+			TenantQuotas:       conf.Quota.Tenants,
+			Encrypt:            conf.Encryption.Enabled,
+		},
+		logger,
+	)
+	return metrics.NewFileService(tracing.NewFileService(service))
 }
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/health"
+)
+
+func newHealthChecker(
+	conf *HealthConfig,
+	balancerConf *BalancerConfig,
+	pg *sqlx.DB,
+	storageHolder karma8.StorageHolder,
+	logger *zap.Logger,
+) *health.Checker {
+	hosts := make([]string, 0, len(balancerConf.HostToWeight))
+	for host := range balancerConf.HostToWeight {
+		hosts = append(hosts, host)
+	}
+
+	return health.NewChecker(pg, storageHolder, health.Options{
+		Hosts:              hosts,
+		MinHealthyStorages: conf.MinHealthyStorages,
+		CheckTimeout:       conf.CheckTimeout,
+	}, logger)
+}
@@ -4,13 +4,65 @@ import (
 	"go.uber.org/zap"
 	"karma8"
 	"karma8/internal/api"
+	"karma8/internal/auth"
+	"karma8/internal/tlsreload"
 	"net/http"
 )
 
-func newHTTPServer(conf *HTTPConfig, fileService karma8.FileService, logger *zap.Logger) *http.Server {
-	mux := api.NewMux(fileService, logger)
-	return &http.Server{
-		Addr:    conf.Addr,
-		Handler: mux,
+func newHTTPServer(
+	conf *HTTPConfig,
+	fileService karma8.FileService,
+	readinessChecker karma8.ReadinessChecker,
+	authenticator auth.Authenticator,
+	signer *auth.URLSigner,
+	presignConf *PresignConfig,
+	limitsConf *LimitsConfig,
+	tlsReloader *tlsreload.Reloader,
+	logger *zap.Logger,
+) *http.Server {
+	presignOptions := api.PresignOptions{
+		BaseURL:   presignConf.BaseURL,
+		MaxExpiry: presignConf.MaxExpiry,
 	}
+	limitOptions := api.LimitOptions{
+		MaxObjectSize:        limitsConf.MaxObjectSize,
+		MaxConcurrentUploads: limitsConf.MaxConcurrentUploads,
+		RateLimit:            limitsConf.RateLimit,
+		RateBurst:            limitsConf.RateBurst,
+		TrustForwardedFor:    limitsConf.TrustForwardedFor,
+	}
+	mux := api.NewMux(fileService, readinessChecker, authenticator, signer, presignOptions, limitOptions, logger)
+	return newServer(conf, mux, tlsReloader)
+}
+
+// newServer serves plain HTTP if tlsReloader is nil.
+func newServer(conf *HTTPConfig, handler http.Handler, tlsReloader *tlsreload.Reloader) *http.Server {
+	server := &http.Server{
+		Addr:              conf.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		ReadTimeout:       conf.ReadTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+		MaxHeaderBytes:    conf.MaxHeaderBytes,
+	}
+	if tlsReloader != nil {
+		server.TLSConfig = tlsReloader.ServerConfig()
+	}
+	return server
+}
+
+func newAdminHTTPServer(
+	conf *HTTPConfig,
+	authenticator auth.Authenticator,
+	evacuator karma8.Evacuator,
+	damageStorage karma8.DamageStorage,
+	bucketStorage karma8.BucketStorage,
+	trashStorage karma8.TrashStorage,
+	fileMetaStorage karma8.FileMetaStorage,
+	tlsReloader *tlsreload.Reloader,
+	logger *zap.Logger,
+) *http.Server {
+	mux := api.NewAdminMux(authenticator, evacuator, damageStorage, bucketStorage, trashStorage, fileMetaStorage, logger)
+	return newServer(conf, mux, tlsReloader)
 }
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/janitor"
+	"karma8/internal/partcleaner"
+)
+
+func newJanitor(
+	conf *JanitorConfig,
+	balancerConf *BalancerConfig,
+	storageHolder karma8.StorageHolder,
+	fileMetaStorage karma8.FileMetaStorage,
+	orphanStorage karma8.OrphanStorage,
+	blobStorage karma8.BlobStorage,
+	cleaner *partcleaner.Cleaner,
+	jobLocker karma8.JobLocker,
+	logger *zap.Logger,
+) *janitor.Janitor {
+	hosts := make([]string, 0, len(balancerConf.HostToWeight))
+	for host := range balancerConf.HostToWeight {
+		hosts = append(hosts, host)
+	}
+
+	return janitor.New(
+		hosts,
+		storageHolder,
+		fileMetaStorage,
+		orphanStorage,
+		blobStorage,
+		cleaner,
+		jobLocker,
+		janitor.Options{
+			Interval:    conf.Interval,
+			GracePeriod: conf.GracePeriod,
+			BatchSize:   conf.BatchSize,
+		},
+		logger,
+	)
+}
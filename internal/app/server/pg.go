@@ -5,16 +5,34 @@ import (
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"go.uber.org/zap"
+	"net/url"
 )
 
 func newPG(conf *PGConfig, logger *zap.Logger) (*sqlx.DB, error) {
+	sslMode := conf.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	params := url.Values{"sslmode": {sslMode}}
+	for param, value := range map[string]string{
+		"sslrootcert": conf.SSLRootCert,
+		"sslcert":     conf.SSLCert,
+		"sslkey":      conf.SSLKey,
+	} {
+		if value != "" {
+			params.Set(param, value)
+		}
+	}
+
 	connStr := fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		"postgres://%s:%s@%s:%d/%s?%s",
 		conf.User,
 		conf.Password,
 		conf.Host,
 		conf.Port,
 		conf.DB,
+		params.Encode(),
 	)
 
 	db, err := sqlx.Connect("postgres", connStr)
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/partcleaner"
+	"karma8/internal/purger"
+)
+
+func newPurger(
+	conf *PurgerConfig,
+	trashStorage karma8.TrashStorage,
+	cleaner *partcleaner.Cleaner,
+	jobLocker karma8.JobLocker,
+	logger *zap.Logger,
+) *purger.Purger {
+	return purger.New(
+		trashStorage,
+		cleaner,
+		jobLocker,
+		purger.Options{
+			Interval:      conf.Interval,
+			RestoreWindow: conf.RestoreWindow,
+			BatchSize:     conf.BatchSize,
+		},
+		logger,
+	)
+}
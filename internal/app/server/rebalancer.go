@@ -0,0 +1,49 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/balancer"
+	"karma8/internal/partmover"
+	"karma8/internal/rebalancer"
+)
+
+func newPartMover(
+	storageHolder karma8.StorageHolder,
+	fileMetaStorage karma8.FileMetaStorage,
+	trashStorage karma8.TrashStorage,
+	logger *zap.Logger,
+) *partmover.Mover {
+	return partmover.New(storageHolder, fileMetaStorage, trashStorage, logger)
+}
+
+func newRebalancer(
+	conf *RebalancerConfig,
+	balancerConf *BalancerConfig,
+	b *balancer.DrainingBalancer,
+	fileMetaStorage karma8.FileMetaStorage,
+	bucketStorage karma8.BucketStorage,
+	cursorStorage karma8.CursorStorage,
+	evacuationStorage karma8.EvacuationStorage,
+	mover *partmover.Mover,
+	jobLocker karma8.JobLocker,
+	logger *zap.Logger,
+) *rebalancer.Rebalancer {
+	return rebalancer.New(
+		balancerConf.HostToWeight,
+		b,
+		fileMetaStorage,
+		bucketStorage,
+		cursorStorage,
+		evacuationStorage,
+		mover,
+		jobLocker,
+		rebalancer.Options{
+			Interval:          conf.Interval,
+			BatchSize:         conf.BatchSize,
+			Threshold:         conf.Threshold,
+			MaxBytesPerSecond: conf.MaxBytesPerSecond,
+		},
+		logger,
+	)
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/encryption"
+	"karma8/internal/rewrapper"
+)
+
+func newRewrapper(
+	conf *RewrapperConfig,
+	keyStorage karma8.KeyStorage,
+	keyring *encryption.Keyring,
+	jobLocker karma8.JobLocker,
+	logger *zap.Logger,
+) *rewrapper.Rewrapper {
+	return rewrapper.New(
+		keyStorage,
+		keyring,
+		jobLocker,
+		rewrapper.Options{
+			Interval:  conf.Interval,
+			BatchSize: conf.BatchSize,
+		},
+		logger,
+	)
+}
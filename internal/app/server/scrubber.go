@@ -0,0 +1,35 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/partmover"
+	"karma8/internal/scrubber"
+)
+
+func newScrubber(
+	conf *ScrubberConfig,
+	storageHolder karma8.StorageHolder,
+	fileMetaStorage karma8.FileMetaStorage,
+	cursorStorage karma8.CursorStorage,
+	damageStorage karma8.DamageStorage,
+	mover *partmover.Mover,
+	jobLocker karma8.JobLocker,
+	logger *zap.Logger,
+) *scrubber.Scrubber {
+	return scrubber.New(
+		storageHolder,
+		fileMetaStorage,
+		cursorStorage,
+		damageStorage,
+		mover,
+		jobLocker,
+		scrubber.Options{
+			Interval:          conf.Interval,
+			BatchSize:         conf.BatchSize,
+			MaxBytesPerSecond: conf.MaxBytesPerSecond,
+			Repair:            conf.Repair,
+		},
+		logger,
+	)
+}
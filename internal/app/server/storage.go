@@ -0,0 +1,55 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/metrics"
+	"karma8/internal/storage"
+	"karma8/internal/storageholder"
+	"karma8/internal/tlsreload"
+	"karma8/internal/tracing"
+	"net/http"
+	"strings"
+)
+
+const (
+	storageKindMemory = "memory"
+	storageKindHTTP   = "http"
+)
+
+// newStorageHolder uses https for storage URLs without scheme if tlsReloader isn't nil.
+func newStorageHolder(conf *StorageConfig, tlsReloader *tlsreload.Reloader, logger *zap.Logger) karma8.StorageHolder {
+	policy := storage.RetryPolicy{
+		MaxAttempts:    conf.Retry.MaxAttempts,
+		InitialBackoff: conf.Retry.InitialBackoff,
+		MaxBackoff:     conf.Retry.MaxBackoff,
+		AttemptTimeout: conf.Retry.AttemptTimeout,
+		BudgetRatio:    conf.Retry.BudgetRatio,
+		BudgetCapacity: conf.Retry.BudgetCapacity,
+	}
+
+	// NOTE: Client is shared by all storages to reuse keep-alive connections.
+	client := &http.Client{}
+	if tlsReloader != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsReloader.ClientConfig()
+		client.Transport = transport
+	}
+
+	return storageholder.New(func(host string) karma8.Storage {
+		var s karma8.Storage
+		if conf.Kind == storageKindHTTP {
+			storageURL := host
+			if tlsReloader != nil && !strings.Contains(host, "://") {
+				storageURL = "https://" + host
+			}
+			s = storage.NewHTTP(client, storageURL)
+		} else {
+			s = storage.NewInMemory()
+		}
+
+		s = tracing.NewStorage(s, host)
+		s = metrics.NewStorage(s, host)
+		return storage.NewRetrying(s, policy, logger.With(zap.String("storage_url", host)))
+	})
+}
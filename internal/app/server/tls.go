@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"karma8/internal/tlsreload"
+)
+
+var errNoServerCertificate = errors.New("tls listener requires cert_file and key_file")
+
+// newTLSReloader returns nil if TLS isn't configured.
+func newTLSReloader(conf *TLSConfig, logger *zap.Logger) (*tlsreload.Reloader, error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+
+	reloader, err := tlsreload.New(
+		tlsreload.Options{
+			CertFile: conf.CertFile,
+			KeyFile:  conf.KeyFile,
+			CAFile:   conf.CAFile,
+			Interval: conf.ReloadInterval,
+		},
+		logger,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("can't load tls files: %w", err)
+	}
+	return reloader, nil
+}
+
+func newServerTLSReloader(conf *TLSConfig, logger *zap.Logger) (*tlsreload.Reloader, error) {
+	if conf.Enabled && conf.CertFile == "" {
+		return nil, errNoServerCertificate
+	}
+	return newTLSReloader(conf, logger)
+}
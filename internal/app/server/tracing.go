@@ -0,0 +1,15 @@
+package server
+
+import (
+	"context"
+	"karma8/internal/tracing"
+)
+
+func setupTracing(conf *TracingConfig) (func(ctx context.Context) error, error) {
+	return tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    conf.Exporter,
+		Endpoint:    conf.Endpoint,
+		Insecure:    conf.Insecure,
+		SampleRatio: conf.SampleRatio,
+	})
+}
@@ -0,0 +1,14 @@
+package auth
+
+import "net/http"
+
+type anonymousAuthenticator struct{}
+
+func (m anonymousAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	return Anonymous, nil
+}
+
+// NewAnonymousAuthenticator accepts all requests, it's used when authentication is disabled.
+func NewAnonymousAuthenticator() Authenticator {
+	return anonymousAuthenticator{}
+}
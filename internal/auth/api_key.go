@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+)
+
+// HeaderAPIKey carries static API key.
+const HeaderAPIKey = "X-API-Key"
+
+type apiKeyAuthenticator struct {
+	// keyHashToPrincipal is keyed by sha256 of the key, so lookup doesn't leak key through timing.
+	keyHashToPrincipal map[[sha256.Size]byte]*Principal
+}
+
+func (m *apiKeyAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	key := request.Header.Get(HeaderAPIKey)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	keyHash := sha256.Sum256([]byte(key))
+	for hash, principal := range m.keyHashToPrincipal {
+		if subtle.ConstantTimeCompare(hash[:], keyHash[:]) == 1 {
+			return principal, nil
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// NewAPIKeyAuthenticator authenticates requests by static keys from config.
+func NewAPIKeyAuthenticator(keyToPrincipal map[string]*Principal) Authenticator {
+	keyHashToPrincipal := make(map[[sha256.Size]byte]*Principal, len(keyToPrincipal))
+	for key, principal := range keyToPrincipal {
+		keyHashToPrincipal[sha256.Sum256([]byte(key))] = principal
+	}
+
+	return &apiKeyAuthenticator{keyHashToPrincipal: keyHashToPrincipal}
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNoCredentials is returned by authenticator if request doesn't carry its credentials, so the next one is tried.
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+const headerAuthorization = "Authorization"
+
+type Authenticator interface {
+	Authenticate(request *http.Request) (*Principal, error)
+}
+
+// authorizationCredentials returns credentials of the Authorization header with the given scheme.
+func authorizationCredentials(request *http.Request, scheme string) (string, bool) {
+	header := request.Header.Get(headerAuthorization)
+	prefix := scheme + " "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
+
+// chain tries authenticators in order until one of them finds its credentials.
+type chain []Authenticator
+
+func (m chain) Authenticate(request *http.Request) (*Principal, error) {
+	for _, authenticator := range m {
+		principal, err := authenticator.Authenticate(request)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
+
+func NewChain(authenticators ...Authenticator) Authenticator {
+	return chain(authenticators)
+}
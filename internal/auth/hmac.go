@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// schemeHMAC is Authorization scheme of tokens signed by the shared secret.
+const schemeHMAC = "HMAC"
+
+// HMACClaims are encoded into token as base64url JSON followed by dot and base64url HMAC-SHA256 of the payload.
+type HMACClaims struct {
+	Subject     string   `json:"sub"`
+	Namespace   string   `json:"namespace"`
+	Permissions []string `json:"permissions"`
+	ExpiresAt   int64    `json:"exp"`
+}
+
+type hmacAuthenticator struct {
+	secret []byte
+	now    func() time.Time
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignHMACToken issues token accepted by HMAC authenticator with the same secret.
+func SignHMACToken(secret []byte, claims *HMACClaims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + sign(secret, payload), nil
+}
+
+func (m *hmacAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	token, ok := authorizationCredentials(request, schemeHMAC)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	fields := strings.Split(token, ".")
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+	payload, signature := fields[0], fields[1]
+	if !hmac.Equal([]byte(signature), []byte(sign(m.secret, payload))) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidCredentials)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", ErrInvalidCredentials)
+	}
+
+	claims := &HMACClaims{}
+	if err := json.Unmarshal(data, claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidCredentials)
+	}
+	if m.now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidCredentials)
+	}
+
+	return &Principal{
+		Name:        claims.Subject,
+		Namespace:   claims.Namespace,
+		Permissions: parsePermissions(claims.Permissions),
+	}, nil
+}
+
+// NewHMACAuthenticator authenticates requests by tokens signed with the shared secret, e.g. issued by SignHMACToken.
+func NewHMACAuthenticator(secret []byte) Authenticator {
+	return &hmacAuthenticator{
+		secret: secret,
+		now:    time.Now,
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"net/http"
+)
+
+const schemeBearer = "Bearer"
+
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Namespace   string   `json:"namespace"`
+	Permissions []string `json:"permissions"`
+}
+
+type jwtAuthenticator struct {
+	key     interface{}
+	methods []string
+}
+
+func (m *jwtAuthenticator) Authenticate(request *http.Request) (*Principal, error) {
+	raw, ok := authorizationCredentials(request, schemeBearer)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	claims := &jwtClaims{}
+	_, err := jwt.ParseWithClaims(
+		raw,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			return m.key, nil
+		},
+		jwt.WithValidMethods(m.methods),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidCredentials, err)
+	}
+	// NOTE: Token without expiration is valid forever, such tokens aren't accepted.
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: token without expiration", ErrInvalidCredentials)
+	}
+
+	return &Principal{
+		Name:        claims.Subject,
+		Namespace:   claims.Namespace,
+		Permissions: parsePermissions(claims.Permissions),
+	}, nil
+}
+
+// NewJWTAuthenticator authenticates requests by bearer JWT, it's verified with HMAC secret if it's set,
+// otherwise with PEM encoded RSA or ECDSA public key.
+func NewJWTAuthenticator(secret []byte, publicKeyPEM []byte) (Authenticator, error) {
+	if len(secret) > 0 {
+		return &jwtAuthenticator{
+			key:     secret,
+			methods: []string{"HS256", "HS384", "HS512"},
+		}, nil
+	}
+
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(publicKeyPEM); err == nil {
+		return &jwtAuthenticator{
+			key:     key,
+			methods: []string{"RS256", "RS384", "RS512"},
+		}, nil
+	}
+
+	if key, err := jwt.ParseECPublicKeyFromPEM(publicKeyPEM); err == nil {
+		return &jwtAuthenticator{
+			key:     key,
+			methods: []string{"ES256", "ES384", "ES512"},
+		}, nil
+	}
+
+	return nil, errors.New("jwt key must be either HMAC secret or RSA/ECDSA public key")
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"karma8/internal/logging"
+	"net/http"
+)
+
+// NewMiddleware puts authenticated principal into the context, unauthenticated requests are rejected.
+// Authorization is done by handlers since they know requested file and action.
+func NewMiddleware(authenticator Authenticator, logger *zap.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			ctx := request.Context()
+			// NOTE: Request could be already authenticated by presigned URL.
+			if PrincipalFromContext(ctx) != nil {
+				next.ServeHTTP(writer, request)
+				return
+			}
+
+			requestLogger := logging.FromContext(ctx, logger)
+
+			principal, err := authenticator.Authenticate(request)
+			if err != nil {
+				requestLogger.Warn("authentication failed", zap.Error(err))
+				http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			requestLogger = requestLogger.With(zap.String("principal", principal.Name))
+			ctx = logging.WithLogger(WithPrincipal(ctx, principal), requestLogger)
+			next.ServeHTTP(writer, request.WithContext(ctx))
+		})
+	}
+}
+
+// NewPermissionMiddleware rejects principals without the permission, it's used for routes not bound to files
+// and goes after authentication middleware.
+func NewPermissionMiddleware(permission Permission, logger *zap.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			principal := PrincipalFromContext(request.Context())
+			if principal == nil || !principal.Has(permission) {
+				logging.FromContext(request.Context(), logger).Warn(
+					"permission denied",
+					zap.String("permission", string(permission)),
+				)
+				http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
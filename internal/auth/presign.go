@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"karma8"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters of presigned URL.
+const (
+	QueryPresignMethod    = "X-Karma8-Method"
+	QueryPresignExpires   = "X-Karma8-Expires"
+	QueryPresignMaxSize   = "X-Karma8-Max-Size"
+	QueryPresignPrincipal = "X-Karma8-Principal"
+	QueryPresignSignature = "X-Karma8-Signature"
+)
+
+var (
+	ErrPresignExpired = errors.New("presigned url expired")
+	ErrPresignInvalid = errors.New("invalid presigned url")
+)
+
+// PresignedRequest is what presigned URL allows to do, MaxSize limits uploads, zero means no limit.
+type PresignedRequest struct {
+	Method    string
+	Bucket    string
+	Filename  string
+	ExpiresAt time.Time
+	MaxSize   int64
+	// Principal issued the URL, access is logged on its behalf.
+	Principal string
+}
+
+func (m *PresignedRequest) Key() karma8.FileKey {
+	return karma8.FileKey{Bucket: m.Bucket, Name: m.Filename}
+}
+
+func (m *PresignedRequest) canonical() string {
+	return strings.Join([]string{
+		m.Method,
+		m.Bucket,
+		m.Filename,
+		strconv.FormatInt(m.ExpiresAt.Unix(), 10),
+		strconv.FormatInt(m.MaxSize, 10),
+		m.Principal,
+	}, "\n")
+}
+
+// Permission is required from the issuer and granted to the URL holder.
+func (m *PresignedRequest) Permission() Permission {
+	if m.Method == http.MethodPut {
+		return PermissionWrite
+	}
+	return PermissionRead
+}
+
+// URLSigner issues and verifies presigned URLs, they are bound to method, filename, expiry and max size.
+type URLSigner struct {
+	secret []byte
+}
+
+func (m *URLSigner) signature(request *PresignedRequest) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(request.canonical()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns query of presigned URL.
+func (m *URLSigner) Sign(request *PresignedRequest) url.Values {
+	query := url.Values{}
+	query.Set(QueryPresignMethod, request.Method)
+	query.Set(QueryPresignExpires, strconv.FormatInt(request.ExpiresAt.Unix(), 10))
+	if request.MaxSize > 0 {
+		query.Set(QueryPresignMaxSize, strconv.FormatInt(request.MaxSize, 10))
+	}
+	query.Set(QueryPresignPrincipal, request.Principal)
+	query.Set(QueryPresignSignature, m.signature(request))
+	return query
+}
+
+// IsPresigned checks whether URL is presigned, such requests are authenticated by Verify instead of credentials.
+func IsPresigned(query url.Values) bool {
+	return query.Get(QueryPresignSignature) != ""
+}
+
+// Verify checks that presigned URL of the file is valid for the method at the moment.
+func (m *URLSigner) Verify(method string, key karma8.FileKey, query url.Values, now time.Time) (*PresignedRequest, error) {
+	expires, err := strconv.ParseInt(query.Get(QueryPresignExpires), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad expiry", ErrPresignInvalid)
+	}
+
+	var maxSize int64
+	if rawMaxSize := query.Get(QueryPresignMaxSize); rawMaxSize != "" {
+		maxSize, err = strconv.ParseInt(rawMaxSize, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad max size", ErrPresignInvalid)
+		}
+	}
+
+	request := &PresignedRequest{
+		Method:    query.Get(QueryPresignMethod),
+		Bucket:    key.Bucket,
+		Filename:  key.Name,
+		ExpiresAt: time.Unix(expires, 0),
+		MaxSize:   maxSize,
+		Principal: query.Get(QueryPresignPrincipal),
+	}
+	if !hmac.Equal([]byte(query.Get(QueryPresignSignature)), []byte(m.signature(request))) {
+		return nil, fmt.Errorf("%w: bad signature", ErrPresignInvalid)
+	}
+	if request.Method != method {
+		return nil, fmt.Errorf("%w: url is signed for %s", ErrPresignInvalid, request.Method)
+	}
+	if !now.Before(request.ExpiresAt) {
+		return nil, ErrPresignExpired
+	}
+
+	return request, nil
+}
+
+func NewURLSigner(secret []byte) *URLSigner {
+	return &URLSigner{secret: secret}
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"errors"
+	"karma8"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestURLSignerVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	key := karma8.FileKey{Bucket: "tenant", Name: "file"}
+	signer := NewURLSigner([]byte("secret"))
+
+	sign := func(request PresignedRequest) url.Values {
+		return signer.Sign(&request)
+	}
+	valid := PresignedRequest{
+		Method:    http.MethodPut,
+		Bucket:    key.Bucket,
+		Filename:  key.Name,
+		ExpiresAt: now.Add(time.Minute),
+		MaxSize:   1024,
+		Principal: "issuer",
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		key     karma8.FileKey
+		query   func() url.Values
+		now     time.Time
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			method: http.MethodPut,
+			key:    key,
+			query:  func() url.Values { return sign(valid) },
+			now:    now,
+		},
+		{
+			name:    "expired",
+			method:  http.MethodPut,
+			key:     key,
+			query:   func() url.Values { return sign(valid) },
+			now:     now.Add(time.Minute),
+			wantErr: ErrPresignExpired,
+		},
+		{
+			name:    "another method",
+			method:  http.MethodGet,
+			key:     key,
+			query:   func() url.Values { return sign(valid) },
+			now:     now,
+			wantErr: ErrPresignInvalid,
+		},
+		{
+			name:    "another file",
+			method:  http.MethodPut,
+			key:     karma8.FileKey{Bucket: key.Bucket, Name: "other"},
+			query:   func() url.Values { return sign(valid) },
+			now:     now,
+			wantErr: ErrPresignInvalid,
+		},
+		{
+			name:   "another secret",
+			method: http.MethodPut,
+			key:    key,
+			query: func() url.Values {
+				return NewURLSigner([]byte("other")).Sign(&valid)
+			},
+			now:     now,
+			wantErr: ErrPresignInvalid,
+		},
+		{
+			name:   "extended expiry",
+			method: http.MethodPut,
+			key:    key,
+			query: func() url.Values {
+				query := sign(valid)
+				query.Set(QueryPresignExpires, "1800000000")
+				return query
+			},
+			now:     now,
+			wantErr: ErrPresignInvalid,
+		},
+		{
+			name:   "removed max size",
+			method: http.MethodPut,
+			key:    key,
+			query: func() url.Values {
+				query := sign(valid)
+				query.Del(QueryPresignMaxSize)
+				return query
+			},
+			now:     now,
+			wantErr: ErrPresignInvalid,
+		},
+		{
+			name:   "replaced principal",
+			method: http.MethodPut,
+			key:    key,
+			query: func() url.Values {
+				query := sign(valid)
+				query.Set(QueryPresignPrincipal, "admin")
+				return query
+			},
+			now:     now,
+			wantErr: ErrPresignInvalid,
+		},
+		{
+			name:   "bad expiry",
+			method: http.MethodPut,
+			key:    key,
+			query: func() url.Values {
+				query := sign(valid)
+				query.Set(QueryPresignExpires, "tomorrow")
+				return query
+			},
+			now:     now,
+			wantErr: ErrPresignInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := signer.Verify(test.method, test.key, test.query(), test.now)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("verify error is %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				return
+			}
+
+			if request.Principal != valid.Principal || request.MaxSize != valid.MaxSize || request.Key() != key {
+				t.Fatalf("verified request is %+v, want %+v", request, valid)
+			}
+			if request.Permission() != PermissionWrite {
+				t.Fatalf("permission is %s, want %s", request.Permission(), PermissionWrite)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"karma8"
+	"strings"
+)
+
+type Permission string
+
+const (
+	PermissionRead   Permission = "read"
+	PermissionWrite  Permission = "write"
+	PermissionDelete Permission = "delete"
+	// PermissionAdmin gives access to maintenance API, e.g. bucket settings, trash and file locks.
+	PermissionAdmin Permission = "admin"
+)
+
+// Principal is authenticated client, it has access only to files which key starts with Namespace,
+// e.g. "tenant/" gives access to all files of bucket tenant. Namespace is matched by whole path segments,
+// so "tenant" gives access to the same files and not to bucket tenant2.
+type Principal struct {
+	Name        string
+	Namespace   string
+	Permissions []Permission
+}
+
+// Anonymous is used when authentication is disabled, it has full access.
+var Anonymous = &Principal{
+	Name:        "anonymous",
+	Permissions: []Permission{PermissionRead, PermissionWrite, PermissionDelete, PermissionAdmin},
+}
+
+// Has checks that principal is granted the permission regardless of namespace.
+func (m *Principal) Has(permission Permission) bool {
+	for _, granted := range m.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows checks that principal is permitted to do action with the file.
+func (m *Principal) Allows(permission Permission, key karma8.FileKey) bool {
+	return m.inNamespace(key.String()) && m.Has(permission)
+}
+
+func (m *Principal) inNamespace(path string) bool {
+	namespace := strings.TrimSuffix(m.Namespace, "/")
+	if namespace == "" {
+		return true
+	}
+	return path == namespace || strings.HasPrefix(path, namespace+"/")
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns nil if request isn't authenticated.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+func parsePermissions(raw []string) []Permission {
+	permissions := make([]Permission, 0, len(raw))
+	for _, permission := range raw {
+		permissions = append(permissions, Permission(permission))
+	}
+	return permissions
+}
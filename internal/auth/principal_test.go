@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"karma8"
+	"testing"
+)
+
+func TestPrincipalAllows(t *testing.T) {
+	tests := []struct {
+		name        string
+		namespace   string
+		permissions []Permission
+		permission  Permission
+		key         karma8.FileKey
+		want        bool
+	}{
+		{
+			name:        "empty namespace",
+			permissions: []Permission{PermissionRead},
+			permission:  PermissionRead,
+			key:         karma8.FileKey{Bucket: "tenant", Name: "file"},
+			want:        true,
+		},
+		{
+			name:        "missing permission",
+			permissions: []Permission{PermissionRead},
+			permission:  PermissionWrite,
+			key:         karma8.FileKey{Bucket: "tenant", Name: "file"},
+			want:        false,
+		},
+		{
+			name:        "bucket namespace",
+			namespace:   "tenant/",
+			permissions: []Permission{PermissionRead},
+			permission:  PermissionRead,
+			key:         karma8.FileKey{Bucket: "tenant", Name: "dir/file"},
+			want:        true,
+		},
+		{
+			name:        "bucket namespace without slash",
+			namespace:   "tenant",
+			permissions: []Permission{PermissionRead},
+			permission:  PermissionRead,
+			key:         karma8.FileKey{Bucket: "tenant", Name: "file"},
+			want:        true,
+		},
+		{
+			name:        "bucket with namespace prefix",
+			namespace:   "tenant",
+			permissions: []Permission{PermissionRead},
+			permission:  PermissionRead,
+			key:         karma8.FileKey{Bucket: "tenant2", Name: "file"},
+			want:        false,
+		},
+		{
+			name:        "another bucket",
+			namespace:   "tenant/",
+			permissions: []Permission{PermissionRead},
+			permission:  PermissionRead,
+			key:         karma8.FileKey{Bucket: "other", Name: "file"},
+			want:        false,
+		},
+		{
+			name:        "directory namespace",
+			namespace:   "tenant/dir",
+			permissions: []Permission{PermissionRead},
+			permission:  PermissionRead,
+			key:         karma8.FileKey{Bucket: "tenant", Name: "dir/file"},
+			want:        true,
+		},
+		{
+			name:        "file with directory prefix",
+			namespace:   "tenant/dir",
+			permissions: []Permission{PermissionRead},
+			permission:  PermissionRead,
+			key:         karma8.FileKey{Bucket: "tenant", Name: "dir2"},
+			want:        false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal := &Principal{Name: "test", Namespace: test.namespace, Permissions: test.permissions}
+
+			if got := principal.Allows(test.permission, test.key); got != test.want {
+				t.Fatalf("Allows(%s, %s) is %t, want %t", test.permission, test.key, got, test.want)
+			}
+		})
+	}
+}
+
+func TestAnonymousAllowsEverything(t *testing.T) {
+	key := karma8.FileKey{Bucket: "tenant", Name: "file"}
+	for _, permission := range []Permission{PermissionRead, PermissionWrite, PermissionDelete, PermissionAdmin} {
+		if !Anonymous.Allows(permission, key) {
+			t.Fatalf("anonymous isn't allowed to %s", permission)
+		}
+	}
+}
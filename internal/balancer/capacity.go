@@ -0,0 +1,75 @@
+package balancer
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/job"
+	"time"
+)
+
+// CapacityMonitor periodically refreshes storage usage and excludes hosts which reached their capacity,
+// so new parts aren't placed on them until usage goes down.
+type CapacityMonitor struct {
+	balancer        *DrainingBalancer
+	fileMetaStorage karma8.FileMetaStorage
+	// hostToCapacity overrides defaultCapacity, zero capacity means unlimited.
+	hostToCapacity  map[string]int64
+	defaultCapacity int64
+	interval        time.Duration
+
+	logger *zap.Logger
+}
+
+func (m *CapacityMonitor) capacity(host string) int64 {
+	if capacity, ok := m.hostToCapacity[host]; ok {
+		return capacity
+	}
+	return m.defaultCapacity
+}
+
+func (m *CapacityMonitor) Run(ctx context.Context) error {
+	return job.RunPeriodically(ctx, m.interval, m.RunOnce, m.logger)
+}
+
+func (m *CapacityMonitor) RunOnce(ctx context.Context) error {
+	usage, err := m.fileMetaStorage.GetStorageUsage(ctx)
+	if err != nil {
+		return err
+	}
+
+	full := map[string]struct{}{}
+	for host, used := range usage {
+		capacity := m.capacity(host)
+		if capacity > 0 && used >= capacity {
+			m.logger.Warn(
+				"storage reached capacity",
+				zap.String("storage_url", host),
+				zap.Int64("used", used),
+				zap.Int64("capacity", capacity),
+			)
+			full[host] = struct{}{}
+		}
+	}
+
+	m.balancer.SetFull(full)
+	return nil
+}
+
+func NewCapacityMonitor(
+	balancer *DrainingBalancer,
+	fileMetaStorage karma8.FileMetaStorage,
+	hostToCapacity map[string]int64,
+	defaultCapacity int64,
+	interval time.Duration,
+	logger *zap.Logger,
+) *CapacityMonitor {
+	return &CapacityMonitor{
+		balancer:        balancer,
+		fileMetaStorage: fileMetaStorage,
+		hostToCapacity:  hostToCapacity,
+		defaultCapacity: defaultCapacity,
+		interval:        interval,
+		logger:          logger.With(zap.String("job", "capacity_monitor")),
+	}
+}
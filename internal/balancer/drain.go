@@ -0,0 +1,61 @@
+package balancer
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/job"
+	"time"
+)
+
+// DrainMonitor periodically refreshes drained hosts from evacuations, so evacuation started
+// through any instance drains the storage on all of them.
+type DrainMonitor struct {
+	balancer          *DrainingBalancer
+	evacuationStorage karma8.EvacuationStorage
+	interval          time.Duration
+
+	logger *zap.Logger
+}
+
+func (m *DrainMonitor) Run(ctx context.Context) error {
+	return job.RunPeriodically(ctx, m.interval, m.RunOnce, m.logger)
+}
+
+func (m *DrainMonitor) RunOnce(ctx context.Context) error {
+	drained, err := DrainedHosts(ctx, m.evacuationStorage)
+	if err != nil {
+		return err
+	}
+
+	m.balancer.SetDrained(drained)
+	return nil
+}
+
+// DrainedHosts returns storages which evacuation was ever started.
+func DrainedHosts(ctx context.Context, evacuationStorage karma8.EvacuationStorage) (map[string]struct{}, error) {
+	evacuations, err := evacuationStorage.ListEvacuations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	drained := make(map[string]struct{}, len(evacuations))
+	for _, evacuation := range evacuations {
+		drained[evacuation.StorageURL] = struct{}{}
+	}
+	return drained, nil
+}
+
+func NewDrainMonitor(
+	balancer *DrainingBalancer,
+	evacuationStorage karma8.EvacuationStorage,
+	interval time.Duration,
+	logger *zap.Logger,
+) *DrainMonitor {
+	return &DrainMonitor{
+		balancer:          balancer,
+		evacuationStorage: evacuationStorage,
+		interval:          interval,
+		logger:            logger.With(zap.String("job", "drain_monitor")),
+	}
+}
@@ -0,0 +1,131 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"karma8"
+	"sync"
+)
+
+// maxExtraAttempts limits amount of additional requests to underlying balancer when some hosts are rejected.
+const maxExtraAttempts = 100
+
+var ErrNotEnoughHosts = errors.New("not enough hosts")
+
+// DrainingBalancer excludes drained and full hosts from the underlying balancer output,
+// so new parts aren't placed on them.
+type DrainingBalancer struct {
+	balancer karma8.Balancer
+	drained  map[string]struct{}
+	full     map[string]struct{}
+	mutex    sync.RWMutex
+}
+
+// Drain excludes the host right away, without waiting for the next refresh of drained hosts.
+func (m *DrainingBalancer) Drain(host string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.drained[host] = struct{}{}
+}
+
+// SetDrained replaces set of drained hosts.
+func (m *DrainingBalancer) SetDrained(hosts map[string]struct{}) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.drained = hosts
+}
+
+// SetFull replaces set of hosts which reached their capacity.
+func (m *DrainingBalancer) SetFull(hosts map[string]struct{}) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.full = hosts
+}
+
+func (m *DrainingBalancer) isExcluded(host string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if _, ok := m.drained[host]; ok {
+		return true
+	}
+	_, ok := m.full[host]
+	return ok
+}
+
+func (m *DrainingBalancer) GetHosts(ctx context.Context, count int) ([]string, error) {
+	return m.GetHostsExcluding(ctx, count, nil, nil)
+}
+
+func (m *DrainingBalancer) GetAllowedHosts(ctx context.Context, count int, allowed []string) ([]string, error) {
+	return m.GetHostsExcluding(ctx, count, nil, allowed)
+}
+
+// GetHostsExcluding works like GetHosts, but additionally skips hosts from exclude and hosts not in allowed,
+// all hosts are allowed if allowed is empty.
+func (m *DrainingBalancer) GetHostsExcluding(
+	ctx context.Context,
+	count int,
+	exclude map[string]struct{},
+	allowed []string,
+) ([]string, error) {
+	isAllowed := func(host string) bool {
+		if len(allowed) == 0 {
+			return true
+		}
+		for _, allowedHost := range allowed {
+			if host == allowedHost {
+				return true
+			}
+		}
+		return false
+	}
+
+	candidates, err := m.balancer.GetHosts(ctx, count)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make([]string, 0, count)
+	seen := make(map[string]struct{}, count)
+	accept := func(host string) {
+		if _, ok := seen[host]; ok {
+			return
+		}
+		seen[host] = struct{}{}
+
+		if _, ok := exclude[host]; ok || m.isExcluded(host) || !isAllowed(host) {
+			return
+		}
+		hosts = append(hosts, host)
+	}
+
+	for _, host := range candidates {
+		accept(host)
+	}
+
+	for attempt := 0; len(hosts) < count; attempt++ {
+		if attempt >= maxExtraAttempts {
+			return nil, ErrNotEnoughHosts
+		}
+
+		extra, err := m.balancer.GetHosts(ctx, 1)
+		if err != nil {
+			return nil, err
+		}
+		accept(extra[0])
+	}
+
+	return hosts, nil
+}
+
+func NewDrainingBalancer(balancer karma8.Balancer) *DrainingBalancer {
+	return &DrainingBalancer{
+		balancer: balancer,
+		drained:  map[string]struct{}{},
+		full:     map[string]struct{}{},
+	}
+}
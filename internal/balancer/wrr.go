@@ -9,10 +9,15 @@ import (
 
 type weightedRoundRobinBalancer struct {
 	roundRobinWeighted weighted.SW
+	hostCount          int
 	mutex              sync.Mutex
 }
 
 func (m *weightedRoundRobinBalancer) GetHosts(ctx context.Context, count int) ([]string, error) {
+	if count > m.hostCount {
+		return nil, ErrNotEnoughHosts
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -40,5 +45,6 @@ func NewWeightedRoundRobinBalancer(hostToWeight map[string]int) karma8.Balancer
 
 	return &weightedRoundRobinBalancer{
 		roundRobinWeighted: roundRobinWeighted,
+		hostCount:          len(hostToWeight),
 	}
 }
@@ -0,0 +1,80 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+)
+
+const (
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+)
+
+var ErrUnknownCodec = errors.New("unknown codec")
+
+// IsKnown reports whether codec is supported, empty codec means no compression and is known too.
+func IsKnown(codec string) bool {
+	switch codec {
+	case "", CodecGzip, CodecZstd:
+		return true
+	}
+	return false
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// NewWriter compresses data written into it, Close flushes the rest of data but doesn't close w.
+func NewWriter(codec string, w io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case "":
+		return nopWriteCloser{Writer: w}, nil
+	case CodecGzip:
+		return gzip.NewWriter(w), nil
+	case CodecZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, codec)
+}
+
+// NewReader decompresses data of r, Close releases decoder but doesn't close r.
+func NewReader(codec string, r io.Reader) (io.ReadCloser, error) {
+	switch codec {
+	case "":
+		return io.NopCloser(r), nil
+	case CodecGzip:
+		return gzip.NewReader(r)
+	case CodecZstd:
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, codec)
+}
+
+// Compress returns compressed copy of data.
+func Compress(codec string, data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer, err := NewWriter(codec, &buffer)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
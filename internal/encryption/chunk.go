@@ -0,0 +1,207 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ChunkSize is amount of plaintext sealed together, ranges are read by whole chunks.
+const ChunkSize = 64 * 1024
+
+const (
+	tagSize         = 16
+	sealedChunkSize = ChunkSize + tagSize
+)
+
+var (
+	ErrChunkAuthFailed = errors.New("chunk authentication failed")
+	errWriterClosed    = errors.New("writer is closed")
+)
+
+// SealedSize returns size of sealed data of the given plaintext size, empty data is sealed as an empty chunk.
+func SealedSize(size int64) int64 {
+	chunks := (size + ChunkSize - 1) / ChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return size + chunks*tagSize
+}
+
+// SealedOffset returns offset of the sealed chunk keeping the given plaintext offset
+// and amount of plaintext in the chunk before the offset.
+func SealedOffset(offset int64) (int64, int64) {
+	return offset / ChunkSize * sealedChunkSize, offset % ChunkSize
+}
+
+// PartCipher seals part data by chunks with AES-GCM. Nonce is made of part and chunk indexes, so chunks can't be
+// reordered or moved between parts, and the last chunk is marked, so truncated data is noticed.
+// NOTE: Nonces are unique only while every data key seals a single upload, data key mustn't be reused.
+type PartCipher struct {
+	aead      cipher.AEAD
+	partIndex uint32
+}
+
+func NewPartCipher(dataKey []byte, partIndex int) (*PartCipher, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PartCipher{aead: aead, partIndex: uint32(partIndex)}, nil
+}
+
+func (m *PartCipher) nonce(chunkIndex int64) []byte {
+	nonce := make([]byte, m.aead.NonceSize())
+	binary.BigEndian.PutUint32(nonce, m.partIndex)
+	binary.BigEndian.PutUint64(nonce[4:], uint64(chunkIndex))
+	return nonce
+}
+
+func additionalData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+func (m *PartCipher) sealChunk(dst, chunk []byte, chunkIndex int64, last bool) []byte {
+	return m.aead.Seal(dst, m.nonce(chunkIndex), chunk, additionalData(last))
+}
+
+func (m *PartCipher) openChunk(dst, sealed []byte, chunkIndex int64, last bool) ([]byte, error) {
+	chunk, err := m.aead.Open(dst, m.nonce(chunkIndex), sealed, additionalData(last))
+	if err != nil {
+		return nil, ErrChunkAuthFailed
+	}
+	return chunk, nil
+}
+
+// Seal returns sealed copy of the whole part data.
+func (m *PartCipher) Seal(data []byte) []byte {
+	result := make([]byte, 0, SealedSize(int64(len(data))))
+	for chunkIndex := int64(0); ; chunkIndex++ {
+		if len(data) <= ChunkSize {
+			return m.sealChunk(result, data, chunkIndex, true)
+		}
+		result = m.sealChunk(result, data[:ChunkSize], chunkIndex, false)
+		data = data[ChunkSize:]
+	}
+}
+
+type sealingWriter struct {
+	cipher     *PartCipher
+	writer     io.Writer
+	buffer     []byte
+	chunkIndex int64
+	closed     bool
+}
+
+// NewWriter seals data written into it, Close seals the last chunk but doesn't close w.
+func (m *PartCipher) NewWriter(w io.Writer) io.WriteCloser {
+	return &sealingWriter{cipher: m, writer: w, buffer: make([]byte, 0, ChunkSize)}
+}
+
+func (m *sealingWriter) flush(last bool) error {
+	sealed := m.cipher.sealChunk(nil, m.buffer, m.chunkIndex, last)
+	m.buffer = m.buffer[:0]
+	m.chunkIndex++
+	_, err := m.writer.Write(sealed)
+	return err
+}
+
+func (m *sealingWriter) Write(p []byte) (int, error) {
+	if m.closed {
+		return 0, errWriterClosed
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// NOTE: Full chunk is sealed only when more data comes, otherwise it may be the last one.
+		if len(m.buffer) == ChunkSize {
+			if err := m.flush(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(m.buffer[len(m.buffer):ChunkSize], p)
+		m.buffer = m.buffer[:len(m.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (m *sealingWriter) Close() error {
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	return m.flush(true)
+}
+
+type openingReader struct {
+	cipher     *PartCipher
+	reader     io.Reader
+	sealed     []byte
+	chunk      []byte
+	chunkIndex int64
+	done       bool
+}
+
+// NewReader opens sealed data of r, which starts at the given offset of sealed data returned by SealedOffset.
+func (m *PartCipher) NewReader(r io.Reader, sealedOffset int64) io.Reader {
+	return &openingReader{
+		cipher:     m,
+		reader:     r,
+		sealed:     make([]byte, sealedChunkSize),
+		chunkIndex: sealedOffset / sealedChunkSize,
+	}
+}
+
+func (m *openingReader) next() error {
+	n, err := io.ReadFull(m.reader, m.sealed)
+	if err == io.EOF {
+		// NOTE: Data ended right after a chunk which isn't marked as the last one.
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	if n < sealedChunkSize {
+		m.chunk, err = m.cipher.openChunk(m.chunk[:0], m.sealed[:n], m.chunkIndex, true)
+		m.done = true
+		return err
+	}
+
+	// NOTE: The last chunk may be full, it's known only by additional data.
+	m.chunk, err = m.cipher.openChunk(m.chunk[:0], m.sealed, m.chunkIndex, false)
+	if err != nil {
+		m.chunk, err = m.cipher.openChunk(m.chunk[:0], m.sealed, m.chunkIndex, true)
+		m.done = true
+	}
+	m.chunkIndex++
+	return err
+}
+
+func (m *openingReader) Read(p []byte) (int, error) {
+	for len(m.chunk) == 0 {
+		if m.done {
+			return 0, io.EOF
+		}
+		if err := m.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, m.chunk)
+	m.chunk = m.chunk[n:]
+	return n, nil
+}
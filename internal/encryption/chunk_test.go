@@ -0,0 +1,210 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func newTestCipher(t *testing.T, key byte, partIndex int) *PartCipher {
+	t.Helper()
+
+	partCipher, err := NewPartCipher(bytes.Repeat([]byte{key}, 32), partIndex)
+	if err != nil {
+		t.Fatalf("can't create cipher: %v", err)
+	}
+	return partCipher
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+func open(partCipher *PartCipher, sealed []byte, sealedOffset int64) ([]byte, error) {
+	return io.ReadAll(partCipher.NewReader(bytes.NewReader(sealed[sealedOffset:]), sealedOffset))
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "one byte", size: 1},
+		{name: "chunk without byte", size: ChunkSize - 1},
+		{name: "chunk", size: ChunkSize},
+		{name: "chunk and byte", size: ChunkSize + 1},
+		{name: "several chunks", size: 3 * ChunkSize},
+		{name: "several chunks and tail", size: 3*ChunkSize + 7},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			partCipher := newTestCipher(t, 1, 2)
+			data := testData(test.size)
+
+			sealed := partCipher.Seal(data)
+			if int64(len(sealed)) != SealedSize(int64(test.size)) {
+				t.Fatalf("sealed size is %d, want %d", len(sealed), SealedSize(int64(test.size)))
+			}
+
+			// NOTE: Writes are split unevenly, so chunks are assembled from several writes.
+			var written bytes.Buffer
+			writer := partCipher.NewWriter(&written)
+			for rest := data; len(rest) > 0; {
+				n := 1000
+				if n > len(rest) {
+					n = len(rest)
+				}
+				if _, err := writer.Write(rest[:n]); err != nil {
+					t.Fatalf("can't write: %v", err)
+				}
+				rest = rest[n:]
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("can't close writer: %v", err)
+			}
+			if !bytes.Equal(written.Bytes(), sealed) {
+				t.Fatal("writer and Seal results differ")
+			}
+
+			opened, err := open(partCipher, sealed, 0)
+			if err != nil {
+				t.Fatalf("can't open: %v", err)
+			}
+			if !bytes.Equal(opened, data) {
+				t.Fatal("opened data differs")
+			}
+		})
+	}
+}
+
+func TestLastChunk(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		truncate int
+		err      error
+	}{
+		{name: "ends after chunk", size: 2 * ChunkSize, truncate: sealedChunkSize, err: io.ErrUnexpectedEOF},
+		{name: "ends after chunk before tail", size: 2*ChunkSize + 5, truncate: 2 * sealedChunkSize, err: io.ErrUnexpectedEOF},
+		{name: "ends inside chunk", size: 2 * ChunkSize, truncate: sealedChunkSize + 100, err: ErrChunkAuthFailed},
+		{name: "ends inside tail", size: ChunkSize + 100, truncate: sealedChunkSize + 50, err: ErrChunkAuthFailed},
+		{name: "empty", size: 0, truncate: 0, err: io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			partCipher := newTestCipher(t, 1, 0)
+			sealed := partCipher.Seal(testData(test.size))
+
+			_, err := open(partCipher, sealed[:test.truncate], 0)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestTampering(t *testing.T) {
+	data := testData(2*ChunkSize + 10)
+
+	tests := []struct {
+		name   string
+		cipher func(t *testing.T) *PartCipher
+		tamper func(sealed []byte) []byte
+	}{
+		{
+			name:   "flipped byte",
+			cipher: func(t *testing.T) *PartCipher { return newTestCipher(t, 1, 0) },
+			tamper: func(sealed []byte) []byte {
+				sealed[sealedChunkSize+10] ^= 1
+				return sealed
+			},
+		},
+		{
+			name:   "flipped tag",
+			cipher: func(t *testing.T) *PartCipher { return newTestCipher(t, 1, 0) },
+			tamper: func(sealed []byte) []byte {
+				sealed[len(sealed)-1] ^= 1
+				return sealed
+			},
+		},
+		{
+			name:   "swapped chunks",
+			cipher: func(t *testing.T) *PartCipher { return newTestCipher(t, 1, 0) },
+			tamper: func(sealed []byte) []byte {
+				swapped := append([]byte{}, sealed[sealedChunkSize:2*sealedChunkSize]...)
+				swapped = append(swapped, sealed[:sealedChunkSize]...)
+				return append(swapped, sealed[2*sealedChunkSize:]...)
+			},
+		},
+		{
+			name:   "another part",
+			cipher: func(t *testing.T) *PartCipher { return newTestCipher(t, 1, 1) },
+			tamper: func(sealed []byte) []byte { return sealed },
+		},
+		{
+			name:   "another key",
+			cipher: func(t *testing.T) *PartCipher { return newTestCipher(t, 2, 0) },
+			tamper: func(sealed []byte) []byte { return sealed },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sealed := test.tamper(newTestCipher(t, 1, 0).Seal(data))
+
+			_, err := open(test.cipher(t), sealed, 0)
+			if !errors.Is(err, ErrChunkAuthFailed) {
+				t.Fatalf("got error %v, want %v", err, ErrChunkAuthFailed)
+			}
+		})
+	}
+}
+
+func TestSealedOffset(t *testing.T) {
+	tests := []struct {
+		offset       int64
+		sealedOffset int64
+		skip         int64
+	}{
+		{offset: 0, sealedOffset: 0, skip: 0},
+		{offset: 1, sealedOffset: 0, skip: 1},
+		{offset: ChunkSize - 1, sealedOffset: 0, skip: ChunkSize - 1},
+		{offset: ChunkSize, sealedOffset: sealedChunkSize, skip: 0},
+		{offset: ChunkSize + 1, sealedOffset: sealedChunkSize, skip: 1},
+		{offset: 2 * ChunkSize, sealedOffset: 2 * sealedChunkSize, skip: 0},
+		{offset: 3*ChunkSize - 1, sealedOffset: 2 * sealedChunkSize, skip: ChunkSize - 1},
+	}
+
+	partCipher := newTestCipher(t, 1, 0)
+	data := testData(3*ChunkSize + 7)
+	sealed := partCipher.Seal(data)
+
+	for _, test := range tests {
+		sealedOffset, skip := SealedOffset(test.offset)
+		if sealedOffset != test.sealedOffset || skip != test.skip {
+			t.Fatalf(
+				"offset %d: got (%d, %d), want (%d, %d)",
+				test.offset,
+				sealedOffset,
+				skip,
+				test.sealedOffset,
+				test.skip,
+			)
+		}
+
+		opened, err := open(partCipher, sealed, sealedOffset)
+		if err != nil {
+			t.Fatalf("offset %d: can't open: %v", test.offset, err)
+		}
+		if !bytes.Equal(opened[skip:], data[test.offset:]) {
+			t.Fatalf("offset %d: opened data differs", test.offset)
+		}
+	}
+}
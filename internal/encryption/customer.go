@@ -0,0 +1,49 @@
+package encryption
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"karma8"
+)
+
+// CustomerKeyFingerprint identifies key provided by the client without revealing it.
+func CustomerKeyFingerprint(customerKey []byte) string {
+	fingerprint := sha256.Sum256(customerKey)
+	return hex.EncodeToString(fingerprint[:])
+}
+
+// NewCustomerDataKey generates data key for a new file and wraps it by the key provided by the client.
+// NOTE: Customer key isn't used as data key directly, because chunk nonces are unique only within a single upload.
+func NewCustomerDataKey(customerKey []byte) ([]byte, *karma8.FileEncryption, error) {
+	aead, err := newAEAD(customerKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataKey, err := newDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fingerprint := CustomerKeyFingerprint(customerKey)
+	wrappedKey, err := wrapKey(aead, dataKey, []byte(fingerprint))
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, &karma8.FileEncryption{WrappedKey: wrappedKey, CustomerKeyFingerprint: fingerprint}, nil
+}
+
+// UnwrapCustomerDataKey fails with ErrCustomerKeyMismatch if the key doesn't match fingerprint of the file.
+func UnwrapCustomerDataKey(customerKey []byte, encryption *karma8.FileEncryption) ([]byte, error) {
+	fingerprint := CustomerKeyFingerprint(customerKey)
+	if subtle.ConstantTimeCompare([]byte(fingerprint), []byte(encryption.CustomerKeyFingerprint)) != 1 {
+		return nil, karma8.ErrCustomerKeyMismatch
+	}
+
+	aead, err := newAEAD(customerKey)
+	if err != nil {
+		return nil, err
+	}
+	return unwrapKey(aead, encryption.WrappedKey, []byte(fingerprint))
+}
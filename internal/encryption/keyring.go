@@ -0,0 +1,171 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"karma8"
+	"os"
+	"strings"
+)
+
+const keySize = 32
+
+var (
+	ErrUnknownMasterKey = errors.New("unknown master key")
+	ErrMalformedKey     = errors.New("malformed wrapped key")
+)
+
+// Keyring keeps master keys. Data keys of new files are wrapped by the active master key,
+// the other ones are kept to unwrap data keys of older files until they're rewrapped.
+type Keyring struct {
+	activeKeyID string
+	masterKeys  map[string]cipher.AEAD
+}
+
+// NewKeyring fails if any key isn't 256-bit or the active key is unknown, empty active key disables encryption.
+func NewKeyring(activeKeyID string, masterKeys map[string][]byte) (*Keyring, error) {
+	keyring := &Keyring{
+		activeKeyID: activeKeyID,
+		masterKeys:  make(map[string]cipher.AEAD, len(masterKeys)),
+	}
+	for keyID, key := range masterKeys {
+		if len(key) != keySize {
+			return nil, fmt.Errorf("master key %s must be %d bytes, got %d", keyID, keySize, len(key))
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		keyring.masterKeys[keyID] = aead
+	}
+
+	if _, ok := keyring.masterKeys[activeKeyID]; activeKeyID != "" && !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMasterKey, activeKeyID)
+	}
+	return keyring, nil
+}
+
+// LoadKeyFile reads master keys from the file, every line has key ID and base64 encoded key separated by space.
+// Empty lines and lines starting with # are skipped.
+func LoadKeyFile(path string) (map[string][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := map[string][]byte{}
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("bad key file line %d", lineNumber)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("can't decode key at line %d: %w", lineNumber, err)
+		}
+		result[fields[0]] = key
+	}
+
+	return result, scanner.Err()
+}
+
+// ActiveKeyID returns ID of the master key wrapping new data keys, it's empty if encryption is disabled.
+func (m *Keyring) ActiveKeyID() string {
+	return m.activeKeyID
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrapKey seals data key with random nonce, additional data binds wrapped key to the wrapping key.
+func wrapKey(aead cipher.AEAD, dataKey []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, additionalData), nil
+}
+
+func unwrapKey(aead cipher.AEAD, wrappedKey []byte, additionalData []byte) ([]byte, error) {
+	if len(wrappedKey) < aead.NonceSize() {
+		return nil, ErrMalformedKey
+	}
+
+	nonce, sealed := wrappedKey[:aead.NonceSize()], wrappedKey[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return nil, ErrMalformedKey
+	}
+	return dataKey, nil
+}
+
+func newDataKey() ([]byte, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	return dataKey, nil
+}
+
+func (m *Keyring) wrap(masterKeyID string, dataKey []byte) (*karma8.FileEncryption, error) {
+	aead, ok := m.masterKeys[masterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMasterKey, masterKeyID)
+	}
+
+	// NOTE: Master key ID is authenticated, so wrapped key can't be attributed to another master key.
+	wrappedKey, err := wrapKey(aead, dataKey, []byte(masterKeyID))
+	if err != nil {
+		return nil, err
+	}
+	return &karma8.FileEncryption{MasterKeyID: masterKeyID, WrappedKey: wrappedKey}, nil
+}
+
+// NewDataKey generates data key for a new file and wraps it by the active master key.
+func (m *Keyring) NewDataKey() ([]byte, *karma8.FileEncryption, error) {
+	dataKey, err := newDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encryption, err := m.wrap(m.activeKeyID, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, encryption, nil
+}
+
+func (m *Keyring) UnwrapDataKey(encryption *karma8.FileEncryption) ([]byte, error) {
+	aead, ok := m.masterKeys[encryption.MasterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMasterKey, encryption.MasterKeyID)
+	}
+	return unwrapKey(aead, encryption.WrappedKey, []byte(encryption.MasterKeyID))
+}
+
+// Rewrap wraps data key by the active master key, data encrypted by the data key stays valid.
+func (m *Keyring) Rewrap(encryption *karma8.FileEncryption) (*karma8.FileEncryption, error) {
+	dataKey, err := m.UnwrapDataKey(encryption)
+	if err != nil {
+		return nil, err
+	}
+	return m.wrap(m.activeKeyID, dataKey)
+}
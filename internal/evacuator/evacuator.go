@@ -0,0 +1,300 @@
+package evacuator
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/balancer"
+	"karma8/internal/job"
+	"karma8/internal/partmover"
+	"time"
+)
+
+const jobName = "evacuator"
+
+// Evacuator moves all file parts off the drained storage to hosts chosen by the balancer.
+// Evacuations are kept in EvacuationStorage and executed by Run of any instance, so evacuation interrupted
+// by restart is resumed.
+type Evacuator struct {
+	balancer          *balancer.DrainingBalancer
+	fileMetaStorage   karma8.FileMetaStorage
+	bucketStorage     karma8.BucketStorage
+	evacuationStorage karma8.EvacuationStorage
+	trashStorage      karma8.TrashStorage
+	mover             *partmover.Mover
+	jobLocker         karma8.JobLocker
+	batchSize         int
+	interval          time.Duration
+
+	logger *zap.Logger
+}
+
+func (m *Evacuator) Run(ctx context.Context) error {
+	return job.RunExclusively(ctx, jobName, m.jobLocker, m.interval, m.RunOnce, m.logger)
+}
+
+// RunOnce executes all running evacuations one by one.
+func (m *Evacuator) RunOnce(ctx context.Context) error {
+	evacuations, err := m.evacuationStorage.ListEvacuations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, evacuation := range evacuations {
+		if evacuation.State != karma8.EvacuationStateRunning {
+			continue
+		}
+		if err := m.evacuate(ctx, evacuation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartEvacuation persists the evacuation, it's picked up by the next pass of Run.
+func (m *Evacuator) StartEvacuation(ctx context.Context, storageURL string) error {
+	if err := m.evacuationStorage.StartEvacuation(ctx, storageURL); err != nil {
+		return err
+	}
+
+	m.balancer.Drain(storageURL)
+	return nil
+}
+
+func (m *Evacuator) GetEvacuationProgress(ctx context.Context, storageURL string) (*karma8.EvacuationProgress, error) {
+	return m.evacuationStorage.GetEvacuation(ctx, storageURL)
+}
+
+// evacuate leaves interrupted evacuation running, so it's resumed by the next pass, possibly on another instance.
+func (m *Evacuator) evacuate(ctx context.Context, evacuation *karma8.EvacuationProgress) error {
+	storageURL := evacuation.StorageURL
+	logger := m.logger.With(zap.String("storage_url", storageURL))
+	logger.Info("start evacuation")
+
+	// NOTE: Other instances drain the storage on the next refresh of drained hosts, which happens every interval,
+	// uploads they start meanwhile wouldn't be noticed among processing files.
+	err := sleep(ctx, time.Until(evacuation.StartTime.Add(m.interval)))
+	if err == nil {
+		err = m.evacuateFiles(ctx, storageURL, logger)
+	}
+	if ctx.Err() != nil {
+		logger.Info("evacuation interrupted")
+		return ctx.Err()
+	}
+
+	state := karma8.EvacuationStateDone
+	var reason string
+	if err != nil {
+		logger.Error("evacuation failed", zap.Error(err))
+		state = karma8.EvacuationStateFailed
+		reason = err.Error()
+	} else {
+		logger.Info("evacuation finished")
+	}
+
+	return m.evacuationStorage.FinishEvacuation(ctx, storageURL, state, reason)
+}
+
+func (m *Evacuator) evacuateFiles(ctx context.Context, storageURL string, logger *zap.Logger) error {
+	for {
+		// NOTE: Uploads started before all instances drained the storage may still place parts on it,
+		// so walk is repeated until they are completed or abandoned.
+		processing, err := m.fileMetaStorage.CountProcessingFilesByStorage(ctx, storageURL)
+		if err != nil {
+			return fmt.Errorf("can't count processing files: %w", err)
+		}
+
+		if err := m.evacuateLiveFiles(ctx, storageURL, logger); err != nil {
+			return err
+		}
+		if err := m.evacuateDeletedFiles(ctx, storageURL, logger); err != nil {
+			return err
+		}
+
+		if processing == 0 {
+			return nil
+		}
+
+		logger.Info("wait for uploads to the storage", zap.Int("processing_files", processing))
+		if err := sleep(ctx, m.interval); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Evacuator) evacuateLiveFiles(ctx context.Context, storageURL string, logger *zap.Logger) error {
+	// NOTE: Successfully evacuated files disappear from the listing, cursor is required to skip failed ones.
+	var cursor karma8.FileKey
+	for {
+		fileMetas, err := m.fileMetaStorage.ListFileMetasByStorage(ctx, storageURL, cursor, m.batchSize)
+		if err != nil {
+			return fmt.Errorf("can't list file metas: %w", err)
+		}
+
+		if len(fileMetas) == 0 {
+			return nil
+		}
+
+		for _, fileMeta := range fileMetas {
+			fileMeta := fileMeta
+			failure := &karma8.EvacuationFailure{Bucket: fileMeta.Bucket, Filename: fileMeta.Name}
+			move := func(partIndex int, to string) error {
+				return m.mover.Move(ctx, fileMeta, partIndex, storageURL, to)
+			}
+			if err := m.evacuateFile(ctx, storageURL, fileMeta, failure, move); err != nil {
+				return err
+			}
+		}
+
+		cursor = fileMetas[len(fileMetas)-1].Key()
+		logger.Info("evacuation progress", zap.Stringer("cursor", cursor))
+	}
+}
+
+// evacuateDeletedFiles moves parts of files in trash, they could be restored until purge.
+func (m *Evacuator) evacuateDeletedFiles(ctx context.Context, storageURL string, logger *zap.Logger) error {
+	var cursor int64
+	for {
+		deletedFiles, err := m.trashStorage.ListDeletedFilesByStorage(ctx, storageURL, cursor, m.batchSize)
+		if err != nil {
+			return fmt.Errorf("can't list deleted files: %w", err)
+		}
+
+		if len(deletedFiles) == 0 {
+			return nil
+		}
+
+		for _, deletedFile := range deletedFiles {
+			deletedFile := deletedFile
+			failure := &karma8.EvacuationFailure{
+				Bucket:        deletedFile.Meta.Bucket,
+				Filename:      deletedFile.Meta.Name,
+				DeletedFileID: deletedFile.ID,
+			}
+			move := func(partIndex int, to string) error {
+				return m.mover.MoveDeleted(ctx, deletedFile, partIndex, storageURL, to)
+			}
+			if err := m.evacuateFile(ctx, storageURL, deletedFile.Meta, failure, move); err != nil {
+				return err
+			}
+		}
+
+		cursor = deletedFiles[len(deletedFiles)-1].ID
+		logger.Info("evacuation progress of deleted files", zap.Int64("cursor", cursor))
+	}
+}
+
+// evacuateFile moves parts of the file off the storage with move, failed parts are saved
+// as copies of failure template.
+func (m *Evacuator) evacuateFile(
+	ctx context.Context,
+	storageURL string,
+	fileMeta *karma8.FileMeta,
+	failure *karma8.EvacuationFailure,
+	move func(partIndex int, to string) error,
+) error {
+	usedHosts := make(map[string]struct{}, len(fileMeta.Parts))
+	for _, part := range fileMeta.Parts {
+		for _, location := range part.Locations() {
+			usedHosts[location] = struct{}{}
+		}
+	}
+
+	for i, part := range fileMeta.Parts {
+		if !hasLocation(part, storageURL) {
+			continue
+		}
+
+		target, err := m.evacuatePart(ctx, fileMeta.Bucket, i, usedHosts, move)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			partFailure := *failure
+			partFailure.PartIndex = i
+			partFailure.Error = err.Error()
+			if err := m.evacuationStorage.AddEvacuationFailure(ctx, storageURL, &partFailure); err != nil {
+				return fmt.Errorf("can't save evacuation failure: %w", err)
+			}
+			continue
+		}
+
+		usedHosts[target] = struct{}{}
+		if err := m.evacuationStorage.AddEvacuationMoved(ctx, storageURL, part.StoredSize()); err != nil {
+			return fmt.Errorf("can't save evacuation progress: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func hasLocation(part *karma8.FilePart, storageURL string) bool {
+	for _, location := range part.Locations() {
+		if location == storageURL {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Evacuator) evacuatePart(
+	ctx context.Context,
+	bucketName string,
+	partIndex int,
+	usedHosts map[string]struct{},
+	move func(partIndex int, to string) error,
+) (string, error) {
+	bucket, err := m.bucketStorage.GetBucket(ctx, bucketName)
+	if err != nil {
+		return "", fmt.Errorf("can't get bucket: %w", err)
+	}
+
+	hosts, err := m.balancer.GetHostsExcluding(ctx, 1, usedHosts, bucket.AllowedHosts)
+	if err != nil {
+		return "", fmt.Errorf("can't get host from balancer: %w", err)
+	}
+
+	if err := move(partIndex, hosts[0]); err != nil {
+		return "", err
+	}
+	return hosts[0], nil
+}
+
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func New(
+	balancer *balancer.DrainingBalancer,
+	fileMetaStorage karma8.FileMetaStorage,
+	bucketStorage karma8.BucketStorage,
+	evacuationStorage karma8.EvacuationStorage,
+	trashStorage karma8.TrashStorage,
+	mover *partmover.Mover,
+	jobLocker karma8.JobLocker,
+	batchSize int,
+	interval time.Duration,
+	logger *zap.Logger,
+) *Evacuator {
+	return &Evacuator{
+		balancer:          balancer,
+		fileMetaStorage:   fileMetaStorage,
+		bucketStorage:     bucketStorage,
+		evacuationStorage: evacuationStorage,
+		trashStorage:      trashStorage,
+		mover:             mover,
+		jobLocker:         jobLocker,
+		batchSize:         batchSize,
+		interval:          interval,
+		logger:            logger.With(zap.String("job", jobName)),
+	}
+}
@@ -0,0 +1,94 @@
+package expirer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/job"
+	"time"
+)
+
+const jobName = "expirer"
+
+type Options struct {
+	// Interval between expirer passes.
+	Interval time.Duration
+	// BatchSize is amount of expired files listed at once, every pass deletes all expired files batch by batch.
+	BatchSize int
+}
+
+// Expirer deletes files which outlived their TTL or retention of the bucket.
+// Expired files go to trash like deleted ones, so their parts are deleted later by the purger.
+type Expirer struct {
+	fileMetaStorage karma8.FileMetaStorage
+	jobLocker       karma8.JobLocker
+	options         Options
+
+	logger *zap.Logger
+}
+
+func (m *Expirer) Run(ctx context.Context) error {
+	return job.RunExclusively(ctx, jobName, m.jobLocker, m.options.Interval, m.RunOnce, m.logger)
+}
+
+func (m *Expirer) RunOnce(ctx context.Context) error {
+	for {
+		fileMetas, err := m.fileMetaStorage.ListExpiredFileMetas(ctx, time.Now(), m.options.BatchSize)
+		if err != nil {
+			return fmt.Errorf("can't list expired files: %w", err)
+		}
+
+		var expired int
+		for _, fileMeta := range fileMetas {
+			if err := m.expire(ctx, fileMeta.Key()); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				m.logger.Error(
+					"can't expire file",
+					zap.String("bucket", fileMeta.Bucket),
+					zap.String("filename", fileMeta.Name),
+					zap.Error(err),
+				)
+				continue
+			}
+			expired++
+		}
+
+		if expired > 0 {
+			m.logger.Info("expired files deleted", zap.Int("count", expired))
+		}
+
+		// NOTE: Files which can't be deleted are listed again, so the pass stops if nothing is deleted.
+		if len(fileMetas) < m.options.BatchSize || expired == 0 {
+			return nil
+		}
+	}
+}
+
+func (m *Expirer) expire(ctx context.Context, key karma8.FileKey) error {
+	err := m.fileMetaStorage.DeleteFileMeta(ctx, key)
+	if errors.Is(err, karma8.ErrFileNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't delete file meta: %w", err)
+	}
+	return nil
+}
+
+func New(
+	fileMetaStorage karma8.FileMetaStorage,
+	jobLocker karma8.JobLocker,
+	options Options,
+	logger *zap.Logger,
+) *Expirer {
+	return &Expirer{
+		fileMetaStorage: fileMetaStorage,
+		jobLocker:       jobLocker,
+		options:         options,
+		logger:          logger.With(zap.String("job", jobName)),
+	}
+}
@@ -0,0 +1,351 @@
+package filemetastorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+	"time"
+)
+
+type pgBlobStorage struct {
+	db *sqlx.DB
+
+	logger *zap.Logger
+}
+
+func scanBlob(row rowScanner) (*karma8.Blob, error) {
+	blob := &karma8.Blob{}
+	var part dbFilePart
+	if err := row.Scan(&blob.Bucket, &part, &blob.RefCount); err != nil {
+		return nil, err
+	}
+
+	blob.Part = convertDBFilePart(&part)
+	return blob, nil
+}
+
+func (m *pgBlobStorage) FindBlob(ctx context.Context, bucket string, checksum string) (*karma8.Blob, error) {
+	row := m.db.QueryRowContext(
+		ctx,
+		`
+SELECT bucket, part, ref_count FROM blob
+WHERE bucket = $1 AND checksum = $2 AND ref_count > 0`,
+		bucket,
+		checksum,
+	)
+	blob, err := scanBlob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, karma8.ErrBlobNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't find blob", zap.Error(err))
+		return nil, err
+	}
+	return blob, nil
+}
+
+func (m *pgBlobStorage) PutBlob(ctx context.Context, blob *karma8.Blob) (bool, error) {
+	result, err := m.db.ExecContext(
+		ctx,
+		`
+INSERT INTO blob (bucket, checksum, part) VALUES ($1, $2, $3)
+ON CONFLICT (bucket, checksum) DO NOTHING`,
+		blob.Bucket,
+		blob.Part.Checksum,
+		convertFilePart(blob.Part),
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't put blob", zap.Error(err))
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (m *pgBlobStorage) ListGarbageBlobs(ctx context.Context, before time.Time, limit int) ([]*karma8.Blob, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT bucket, part, ref_count FROM blob
+WHERE ref_count = 0 AND update_datetime < $1
+ORDER BY update_datetime
+LIMIT $2`,
+		before,
+		limit,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list garbage blobs", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*karma8.Blob
+	for rows.Next() {
+		blob, err := scanBlob(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, blob)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *pgBlobStorage) DeleteGarbageBlob(ctx context.Context, blob *karma8.Blob) error {
+	result, err := m.db.ExecContext(
+		ctx,
+		`
+DELETE FROM blob
+WHERE bucket = $1 AND checksum = $2 AND ref_count = 0`,
+		blob.Bucket,
+		blob.Part.Checksum,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't delete garbage blob", zap.Error(err))
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return karma8.ErrBlobNotFound
+	}
+
+	return nil
+}
+
+// addBlobRefs changes reference count of blobs of shared parts by delta,
+// it fails with ErrBlobNotFound if blob of the added reference doesn't exist anymore.
+func addBlobRefs(ctx context.Context, tx *sqlx.Tx, bucket string, parts []*karma8.FilePart, delta int64) error {
+	for _, part := range parts {
+		if !part.Shared {
+			continue
+		}
+
+		result, err := tx.ExecContext(
+			ctx,
+			`
+UPDATE blob SET ref_count = ref_count + $4, update_datetime = CURRENT_TIMESTAMP
+WHERE bucket = $1 AND checksum = $2 AND (part).file_path = $3`,
+			bucket,
+			part.Checksum,
+			part.Path,
+			delta,
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 && delta > 0 {
+			return karma8.ErrBlobNotFound
+		}
+	}
+	return nil
+}
+
+// refreshBlobParts replaces locations of shared parts with the current ones of their blobs, because blobs may be
+// moved while upload is running. Blobs are locked until the end of transaction, so they can't be moved until
+// the file referring to them is visible. It fails with ErrBlobNotFound if blob doesn't exist anymore.
+// NOTE: Blob is locked for update right away, since its reference count is updated later in the same transaction,
+// shared lock would deadlock with concurrent uploads of the same content.
+func refreshBlobParts(ctx context.Context, tx *sqlx.Tx, bucket string, parts []*karma8.FilePart) error {
+	for _, part := range parts {
+		if !part.Shared {
+			continue
+		}
+
+		var blobPart dbFilePart
+		err := tx.QueryRowContext(
+			ctx,
+			`
+SELECT part FROM blob
+WHERE bucket = $1 AND checksum = $2 AND (part).file_path = $3
+FOR NO KEY UPDATE`,
+			bucket,
+			part.Checksum,
+			part.Path,
+		).Scan(&blobPart)
+		if errors.Is(err, sql.ErrNoRows) {
+			return karma8.ErrBlobNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		part.StorageURL = blobPart.StorageURL
+		part.Replicas = blobPart.Replicas
+	}
+	return nil
+}
+
+// moveBlob replaces location of the blob in every file referring to it, so all of them keep pointing to the same data.
+func moveBlob(ctx context.Context, tx *sqlx.Tx, bucket string, blobPart *dbFilePart, from, to string) error {
+	var part dbFilePart
+	err := tx.QueryRowContext(
+		ctx,
+		`
+SELECT part FROM blob
+WHERE bucket = $1 AND checksum = $2 AND (part).file_path = $3
+FOR UPDATE`,
+		bucket,
+		blobPart.Checksum,
+		blobPart.Path,
+	).Scan(&part)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && replaceLocation(&part, from, to) {
+		_, err = tx.ExecContext(
+			ctx,
+			`
+UPDATE blob SET part = $3
+WHERE bucket = $1 AND checksum = $2`,
+			bucket,
+			blobPart.Checksum,
+			&part,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := moveBlobInFiles(ctx, tx, bucket, blobPart.Path, from, to); err != nil {
+		return err
+	}
+	return moveBlobInDeletedFiles(ctx, tx, bucket, blobPart.Path, from, to)
+}
+
+func replaceBlobLocation(parts []dbFilePart, path string, from, to string) {
+	for i := range parts {
+		if parts[i].Shared && parts[i].Path == path {
+			replaceLocation(&parts[i], from, to)
+		}
+	}
+}
+
+// selectFilesByBlob returns parts of files referring to the blob path, locked files are included,
+// because moving keeps the data as is.
+func selectFilesByBlob(ctx context.Context, tx *sqlx.Tx, bucket string, path string) (map[string][]dbFilePart, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		`
+SELECT name, parts FROM file
+WHERE bucket = $1 AND EXISTS (SELECT 1 FROM unnest(parts) AS p WHERE (p).file_path = $2)
+FOR UPDATE`,
+		bucket,
+		path,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string][]dbFilePart{}
+	for rows.Next() {
+		var name string
+		var parts []dbFilePart
+		if err := rows.Scan(&name, pq.Array(&parts)); err != nil {
+			return nil, err
+		}
+		result[name] = parts
+	}
+
+	return result, rows.Err()
+}
+
+func moveBlobInFiles(ctx context.Context, tx *sqlx.Tx, bucket string, path string, from, to string) error {
+	nameToParts, err := selectFilesByBlob(ctx, tx, bucket, path)
+	if err != nil {
+		return err
+	}
+
+	for name, parts := range nameToParts {
+		replaceBlobLocation(parts, path, from, to)
+		_, err := tx.ExecContext(
+			ctx,
+			`
+UPDATE file SET parts = $3
+WHERE bucket = $1 AND name = $2`,
+			bucket,
+			name,
+			pq.Array(parts),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func selectDeletedFilesByBlob(ctx context.Context, tx *sqlx.Tx, bucket string, path string) (map[int64][]dbFilePart, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		`
+SELECT id, parts FROM deleted_file
+WHERE bucket = $1 AND EXISTS (SELECT 1 FROM unnest(parts) AS p WHERE (p).file_path = $2)
+FOR UPDATE`,
+		bucket,
+		path,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[int64][]dbFilePart{}
+	for rows.Next() {
+		var id int64
+		var parts []dbFilePart
+		if err := rows.Scan(&id, pq.Array(&parts)); err != nil {
+			return nil, err
+		}
+		result[id] = parts
+	}
+
+	return result, rows.Err()
+}
+
+func moveBlobInDeletedFiles(ctx context.Context, tx *sqlx.Tx, bucket string, path string, from, to string) error {
+	idToParts, err := selectDeletedFilesByBlob(ctx, tx, bucket, path)
+	if err != nil {
+		return err
+	}
+
+	for id, parts := range idToParts {
+		replaceBlobLocation(parts, path, from, to)
+		_, err := tx.ExecContext(
+			ctx,
+			`
+UPDATE deleted_file SET parts = $2
+WHERE id = $1`,
+			id,
+			pq.Array(parts),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewPGBlobStorage(db *sqlx.DB, logger *zap.Logger) karma8.BlobStorage {
+	return &pgBlobStorage{
+		db:     db,
+		logger: logger,
+	}
+}
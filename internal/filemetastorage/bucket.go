@@ -0,0 +1,135 @@
+package filemetastorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+	"time"
+)
+
+type pgBucketStorage struct {
+	db *sqlx.DB
+
+	logger *zap.Logger
+}
+
+func scanBucket(row rowScanner) (*karma8.Bucket, error) {
+	bucket := &karma8.Bucket{}
+	var retentionSeconds int64
+	err := row.Scan(
+		&bucket.Name,
+		&bucket.ReplicationFactor,
+		&bucket.QuotaBytes,
+		&retentionSeconds,
+		pq.Array(&bucket.AllowedHosts),
+		&bucket.Dedup,
+		&bucket.Compression,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket.Retention = time.Duration(retentionSeconds) * time.Second
+	return bucket, nil
+}
+
+func (m *pgBucketStorage) GetBucket(ctx context.Context, name string) (*karma8.Bucket, error) {
+	row := m.db.QueryRowContext(
+		ctx,
+		`
+SELECT name, replication_factor, quota_bytes, retention_seconds, allowed_hosts, dedup, compression FROM bucket
+WHERE name = $1`,
+		name,
+	)
+	bucket, err := scanBucket(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, karma8.ErrBucketNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't get bucket", zap.String("bucket", name), zap.Error(err))
+		return nil, err
+	}
+	return bucket, nil
+}
+
+func (m *pgBucketStorage) ListBuckets(ctx context.Context) ([]*karma8.Bucket, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT name, replication_factor, quota_bytes, retention_seconds, allowed_hosts, dedup, compression FROM bucket
+ORDER BY name`,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list buckets", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*karma8.Bucket
+	for rows.Next() {
+		bucket, err := scanBucket(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, bucket)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *pgBucketStorage) PutBucket(ctx context.Context, bucket *karma8.Bucket) error {
+	_, err := m.db.ExecContext(
+		ctx,
+		`
+INSERT INTO bucket (name, replication_factor, quota_bytes, retention_seconds, allowed_hosts, dedup, compression)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (name) DO UPDATE
+SET replication_factor = excluded.replication_factor,
+    quota_bytes = excluded.quota_bytes,
+    retention_seconds = excluded.retention_seconds,
+    allowed_hosts = excluded.allowed_hosts,
+    dedup = excluded.dedup,
+    compression = excluded.compression`,
+		bucket.Name,
+		bucket.ReplicationFactor,
+		bucket.QuotaBytes,
+		int64(bucket.Retention/time.Second),
+		pq.Array(bucket.AllowedHosts),
+		bucket.Dedup,
+		bucket.Compression,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't put bucket", zap.String("bucket", bucket.Name), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (m *pgBucketStorage) GetBucketUsage(ctx context.Context, name string) (int64, error) {
+	var usage int64
+	err := m.db.QueryRowContext(
+		ctx,
+		`
+SELECT
+    COALESCE((SELECT used_bytes FROM bucket WHERE name = $1), 0) +
+    COALESCE((SELECT SUM(content_length) FROM processing_file WHERE bucket = $1), 0)`,
+		name,
+	).Scan(&usage)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't get bucket usage", zap.String("bucket", name), zap.Error(err))
+		return 0, err
+	}
+	return usage, nil
+}
+
+func NewPGBucketStorage(db *sqlx.DB, logger *zap.Logger) karma8.BucketStorage {
+	return &pgBucketStorage{
+		db:     db,
+		logger: logger,
+	}
+}
@@ -0,0 +1,65 @@
+package filemetastorage
+
+import (
+	"context"
+	"karma8"
+	"sync"
+	"time"
+)
+
+type cachedBucket struct {
+	bucket     *karma8.Bucket
+	expireTime time.Time
+}
+
+// cachedBucketStorage keeps buckets in memory, so settings aren't queried on every request.
+// NOTE: Changes of settings made by other instances are visible after ttl.
+type cachedBucketStorage struct {
+	karma8.BucketStorage
+	ttl     time.Duration
+	buckets map[string]*cachedBucket
+	mutex   sync.Mutex
+}
+
+func (m *cachedBucketStorage) GetBucket(ctx context.Context, name string) (*karma8.Bucket, error) {
+	m.mutex.Lock()
+	cached, ok := m.buckets[name]
+	m.mutex.Unlock()
+	if ok && time.Now().Before(cached.expireTime) {
+		return cached.bucket, nil
+	}
+
+	bucket, err := m.BucketStorage.GetBucket(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	m.buckets[name] = &cachedBucket{
+		bucket:     bucket,
+		expireTime: time.Now().Add(m.ttl),
+	}
+	m.mutex.Unlock()
+
+	return bucket, nil
+}
+
+func (m *cachedBucketStorage) PutBucket(ctx context.Context, bucket *karma8.Bucket) error {
+	if err := m.BucketStorage.PutBucket(ctx, bucket); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	delete(m.buckets, bucket.Name)
+	m.mutex.Unlock()
+
+	return nil
+}
+
+func NewCachedBucketStorage(storage karma8.BucketStorage, ttl time.Duration) karma8.BucketStorage {
+	return &cachedBucketStorage{
+		BucketStorage: storage,
+		ttl:           ttl,
+		buckets:       map[string]*cachedBucket{},
+	}
+}
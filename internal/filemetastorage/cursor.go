@@ -0,0 +1,59 @@
+package filemetastorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+)
+
+type pgCursorStorage struct {
+	db *sqlx.DB
+
+	logger *zap.Logger
+}
+
+func (m *pgCursorStorage) GetCursor(ctx context.Context, job string) (string, error) {
+	var cursor string
+	err := m.db.QueryRowContext(
+		ctx,
+		`
+SELECT last_key FROM job_cursor
+WHERE name = $1`,
+		job,
+	).Scan(&cursor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't get job cursor", zap.String("job", job), zap.Error(err))
+		return "", err
+	}
+	return cursor, nil
+}
+
+func (m *pgCursorStorage) SaveCursor(ctx context.Context, job string, cursor string) error {
+	_, err := m.db.ExecContext(
+		ctx,
+		`
+INSERT INTO job_cursor (name, last_key) VALUES ($1, $2)
+ON CONFLICT (name) DO UPDATE SET last_key = excluded.last_key, update_datetime = CURRENT_TIMESTAMP`,
+		job,
+		cursor,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't save job cursor", zap.String("job", job), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func NewPGCursorStorage(db *sqlx.DB, logger *zap.Logger) karma8.CursorStorage {
+	return &pgCursorStorage{
+		db:     db,
+		logger: logger,
+	}
+}
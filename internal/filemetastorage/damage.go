@@ -0,0 +1,80 @@
+package filemetastorage
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+)
+
+type pgDamageStorage struct {
+	db *sqlx.DB
+
+	logger *zap.Logger
+}
+
+func (m *pgDamageStorage) PutDamagedFilePart(ctx context.Context, part *karma8.DamagedFilePart) error {
+	_, err := m.db.ExecContext(
+		ctx,
+		`
+INSERT INTO damaged_file_part (bucket, name, part_index, storage_url, reason, repaired)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (bucket, name, part_index, storage_url) DO UPDATE
+SET reason = excluded.reason, repaired = excluded.repaired, detect_datetime = CURRENT_TIMESTAMP`,
+		part.Bucket,
+		part.Filename,
+		part.PartIndex,
+		part.StorageURL,
+		part.Reason,
+		part.Repaired,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't put damaged file part", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (m *pgDamageStorage) ListDamagedFileParts(ctx context.Context, onlyActive bool) ([]*karma8.DamagedFilePart, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT bucket, name, part_index, storage_url, reason, repaired, detect_datetime FROM damaged_file_part
+WHERE NOT (repaired AND $1)
+ORDER BY detect_datetime`,
+		onlyActive,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list damaged file parts", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*karma8.DamagedFilePart
+	for rows.Next() {
+		part := &karma8.DamagedFilePart{}
+		err := rows.Scan(
+			&part.Bucket,
+			&part.Filename,
+			&part.PartIndex,
+			&part.StorageURL,
+			&part.Reason,
+			&part.Repaired,
+			&part.DetectTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, part)
+	}
+
+	return result, rows.Err()
+}
+
+func NewPGDamageStorage(db *sqlx.DB, logger *zap.Logger) karma8.DamageStorage {
+	return &pgDamageStorage{
+		db:     db,
+		logger: logger,
+	}
+}
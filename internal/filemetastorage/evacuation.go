@@ -0,0 +1,216 @@
+package filemetastorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+)
+
+type pgEvacuationStorage struct {
+	db *sqlx.DB
+
+	logger *zap.Logger
+}
+
+func scanEvacuation(row rowScanner) (*karma8.EvacuationProgress, error) {
+	progress := &karma8.EvacuationProgress{}
+	var finishTime sql.NullTime
+	err := row.Scan(
+		&progress.StorageURL,
+		&progress.State,
+		&progress.MovedParts,
+		&progress.MovedBytes,
+		&progress.Error,
+		&progress.StartTime,
+		&finishTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if finishTime.Valid {
+		progress.FinishTime = &finishTime.Time
+	}
+	return progress, nil
+}
+
+func (m *pgEvacuationStorage) StartEvacuation(ctx context.Context, storageURL string) error {
+	return transact(ctx, m.db, func(tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(
+			ctx,
+			`
+INSERT INTO evacuation (storage_url, state) VALUES ($1, $2)
+ON CONFLICT (storage_url) DO UPDATE
+SET state = excluded.state, moved_parts = 0, moved_bytes = 0, error = '',
+    start_datetime = CURRENT_TIMESTAMP, finish_datetime = NULL
+WHERE evacuation.state <> excluded.state`,
+			storageURL,
+			karma8.EvacuationStateRunning,
+		)
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't start evacuation", zap.Error(err))
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return karma8.ErrEvacuationInProgress
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`
+DELETE FROM evacuation_failure
+WHERE storage_url = $1`,
+			storageURL,
+		)
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't delete evacuation failures", zap.Error(err))
+			return err
+		}
+		return nil
+	})
+}
+
+func (m *pgEvacuationStorage) GetEvacuation(ctx context.Context, storageURL string) (*karma8.EvacuationProgress, error) {
+	progress, err := scanEvacuation(m.db.QueryRowContext(
+		ctx,
+		`
+SELECT storage_url, state, moved_parts, moved_bytes, error, start_datetime, finish_datetime FROM evacuation
+WHERE storage_url = $1`,
+		storageURL,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, karma8.ErrEvacuationNotFound
+	}
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't get evacuation", zap.Error(err))
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT bucket, name, deleted_file_id, part_index, error FROM evacuation_failure
+WHERE storage_url = $1
+ORDER BY bucket, name, deleted_file_id, part_index`,
+		storageURL,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list evacuation failures", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		failure := &karma8.EvacuationFailure{}
+		err := rows.Scan(&failure.Bucket, &failure.Filename, &failure.DeletedFileID, &failure.PartIndex, &failure.Error)
+		if err != nil {
+			return nil, err
+		}
+		progress.Failures = append(progress.Failures, failure)
+	}
+
+	return progress, rows.Err()
+}
+
+func (m *pgEvacuationStorage) ListEvacuations(ctx context.Context) ([]*karma8.EvacuationProgress, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT storage_url, state, moved_parts, moved_bytes, error, start_datetime, finish_datetime FROM evacuation
+ORDER BY start_datetime`,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list evacuations", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*karma8.EvacuationProgress
+	for rows.Next() {
+		progress, err := scanEvacuation(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, progress)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *pgEvacuationStorage) AddEvacuationMoved(ctx context.Context, storageURL string, size int64) error {
+	_, err := m.db.ExecContext(
+		ctx,
+		`
+UPDATE evacuation SET moved_parts = moved_parts + 1, moved_bytes = moved_bytes + $2::BIGINT
+WHERE storage_url = $1`,
+		storageURL,
+		size,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't add moved part to evacuation", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (m *pgEvacuationStorage) AddEvacuationFailure(
+	ctx context.Context,
+	storageURL string,
+	failure *karma8.EvacuationFailure,
+) error {
+	_, err := m.db.ExecContext(
+		ctx,
+		`
+INSERT INTO evacuation_failure (storage_url, bucket, name, deleted_file_id, part_index, error)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (storage_url, bucket, name, deleted_file_id, part_index) DO UPDATE SET error = excluded.error`,
+		storageURL,
+		failure.Bucket,
+		failure.Filename,
+		failure.DeletedFileID,
+		failure.PartIndex,
+		failure.Error,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't add evacuation failure", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (m *pgEvacuationStorage) FinishEvacuation(
+	ctx context.Context,
+	storageURL string,
+	state karma8.EvacuationState,
+	reason string,
+) error {
+	_, err := m.db.ExecContext(
+		ctx,
+		`
+UPDATE evacuation SET state = $2, error = $3, finish_datetime = CURRENT_TIMESTAMP
+WHERE storage_url = $1`,
+		storageURL,
+		state,
+		reason,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't finish evacuation", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func NewPGEvacuationStorage(db *sqlx.DB, logger *zap.Logger) karma8.EvacuationStorage {
+	return &pgEvacuationStorage{
+		db:     db,
+		logger: logger,
+	}
+}
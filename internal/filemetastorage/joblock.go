@@ -0,0 +1,71 @@
+package filemetastorage
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+)
+
+type pgJobLocker struct {
+	db *sqlx.DB
+
+	logger *zap.Logger
+}
+
+// NOTE: Advisory lock belongs to the session, so connection is kept out of the pool until the job is unlocked.
+// Lock is released by pg if the instance dies.
+func (m *pgJobLocker) TryLockJob(ctx context.Context, job string) (func(), bool, error) {
+	logger := logging.FromContext(ctx, m.logger).With(zap.String("job", job))
+
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		logger.Error("can't get connection for job lock", zap.Error(err))
+		return nil, false, err
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(
+		ctx,
+		`
+SELECT pg_try_advisory_lock(hashtext($1))`,
+		job,
+	).Scan(&locked)
+	if err != nil {
+		_ = conn.Close()
+		logger.Error("can't lock job", zap.Error(err))
+		return nil, false, err
+	}
+	if !locked {
+		_ = conn.Close()
+		return nil, false, nil
+	}
+
+	unlock := func() {
+		// NOTE: Context of the pass may be already cancelled, the lock must be released anyway.
+		_, err := conn.ExecContext(
+			context.Background(),
+			`
+SELECT pg_advisory_unlock(hashtext($1))`,
+			job,
+		)
+		if err != nil {
+			logger.Error("can't unlock job", zap.Error(err))
+			// NOTE: Connection is discarded instead of returning to the pool, so the lock is released with the session.
+			_ = conn.Raw(func(interface{}) error {
+				return driver.ErrBadConn
+			})
+		}
+		_ = conn.Close()
+	}
+	return unlock, true, nil
+}
+
+func NewPGJobLocker(db *sqlx.DB, logger *zap.Logger) karma8.JobLocker {
+	return &pgJobLocker{
+		db:     db,
+		logger: logger,
+	}
+}
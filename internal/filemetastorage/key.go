@@ -0,0 +1,133 @@
+package filemetastorage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+)
+
+type pgKeyStorage struct {
+	db *sqlx.DB
+
+	logger *zap.Logger
+}
+
+// fileEncryptionColumns returns NULL master key ID for data keys wrapped by customer keys,
+// so they aren't listed for rewrapping.
+func fileEncryptionColumns(encryption *karma8.FileEncryption) (sql.NullString, []byte, sql.NullString) {
+	var masterKeyID, keyFingerprint sql.NullString
+	if encryption == nil {
+		return masterKeyID, nil, keyFingerprint
+	}
+
+	if encryption.CustomerKeyFingerprint != "" {
+		keyFingerprint = sql.NullString{String: encryption.CustomerKeyFingerprint, Valid: true}
+	} else {
+		masterKeyID = sql.NullString{String: encryption.MasterKeyID, Valid: true}
+	}
+	return masterKeyID, encryption.WrappedKey, keyFingerprint
+}
+
+func convertFileEncryption(
+	masterKeyID sql.NullString,
+	wrappedKey []byte,
+	keyFingerprint sql.NullString,
+) *karma8.FileEncryption {
+	if !masterKeyID.Valid && !keyFingerprint.Valid {
+		return nil
+	}
+	return &karma8.FileEncryption{
+		MasterKeyID:            masterKeyID.String,
+		WrappedKey:             wrappedKey,
+		CustomerKeyFingerprint: keyFingerprint.String,
+	}
+}
+
+func (m *pgKeyStorage) ListStaleFileEncryptions(
+	ctx context.Context,
+	masterKeyID string,
+	limit int,
+) ([]*karma8.FileEncryption, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT master_key_id, wrapped_key FROM file
+WHERE master_key_id IS NOT NULL AND master_key_id <> $1
+UNION ALL
+SELECT master_key_id, wrapped_key FROM processing_file
+WHERE master_key_id IS NOT NULL AND master_key_id <> $1
+UNION ALL
+SELECT master_key_id, wrapped_key FROM deleted_file
+WHERE master_key_id IS NOT NULL AND master_key_id <> $1
+LIMIT $2`,
+		masterKeyID,
+		limit,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list stale file encryptions", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*karma8.FileEncryption
+	for rows.Next() {
+		var staleKeyID sql.NullString
+		var wrappedKey []byte
+		if err := rows.Scan(&staleKeyID, &wrappedKey); err != nil {
+			return nil, err
+		}
+		result = append(result, convertFileEncryption(staleKeyID, wrappedKey, sql.NullString{}))
+	}
+
+	return result, rows.Err()
+}
+
+// ReplaceFileEncryption finds file by wrapped key, every upload has its own data key, so wrapped key is unique.
+// NOTE: File moves between processing, completed and deleted files, so all of them are updated.
+func (m *pgKeyStorage) ReplaceFileEncryption(
+	ctx context.Context,
+	old *karma8.FileEncryption,
+	new *karma8.FileEncryption,
+) error {
+	return transact(ctx, m.db, func(tx *sqlx.Tx) error {
+		var affected int64
+		for _, table := range []string{"file", "processing_file", "deleted_file"} {
+			result, err := tx.ExecContext(
+				ctx,
+				`
+UPDATE `+table+`
+SET master_key_id = $3, wrapped_key = $4
+WHERE master_key_id = $1 AND wrapped_key = $2`,
+				old.MasterKeyID,
+				old.WrappedKey,
+				new.MasterKeyID,
+				new.WrappedKey,
+			)
+			if err != nil {
+				logging.FromContext(ctx, m.logger).Error("can't replace file encryption", zap.Error(err))
+				return err
+			}
+
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			affected += rowsAffected
+		}
+
+		if affected == 0 {
+			return karma8.ErrFileEncryptionNotFound
+		}
+		return nil
+	})
+}
+
+func NewPGKeyStorage(db *sqlx.DB, logger *zap.Logger) karma8.KeyStorage {
+	return &pgKeyStorage{
+		db:     db,
+		logger: logger,
+	}
+}
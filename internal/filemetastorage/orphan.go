@@ -0,0 +1,90 @@
+package filemetastorage
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+)
+
+type pgOrphanStorage struct {
+	db *sqlx.DB
+
+	logger *zap.Logger
+}
+
+func (m *pgOrphanStorage) PutOrphanFileParts(ctx context.Context, parts []*karma8.OrphanFilePart) error {
+	storageURLs := make([]string, 0, len(parts))
+	paths := make([]string, 0, len(parts))
+	for _, part := range parts {
+		storageURLs = append(storageURLs, part.StorageURL)
+		paths = append(paths, part.Path)
+	}
+
+	_, err := m.db.ExecContext(
+		ctx,
+		`
+INSERT INTO orphan_file_part (storage_url, file_path)
+SELECT * FROM unnest($1::VARCHAR[], $2::VARCHAR[])
+ON CONFLICT DO NOTHING`,
+		pq.Array(storageURLs),
+		pq.Array(paths),
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't put orphan file parts", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (m *pgOrphanStorage) ListOrphanFileParts(ctx context.Context, limit int) ([]*karma8.OrphanFilePart, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT storage_url, file_path FROM orphan_file_part
+ORDER BY create_datetime
+LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list orphan file parts", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*karma8.OrphanFilePart
+	for rows.Next() {
+		part := &karma8.OrphanFilePart{}
+		if err := rows.Scan(&part.StorageURL, &part.Path); err != nil {
+			return nil, err
+		}
+		result = append(result, part)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *pgOrphanStorage) DeleteOrphanFilePart(ctx context.Context, part *karma8.OrphanFilePart) error {
+	_, err := m.db.ExecContext(
+		ctx,
+		`
+DELETE FROM orphan_file_part
+WHERE storage_url = $1 AND file_path = $2`,
+		part.StorageURL,
+		part.Path,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't delete orphan file part", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func NewPGOrphanStorage(db *sqlx.DB, logger *zap.Logger) karma8.OrphanStorage {
+	return &pgOrphanStorage{
+		db:     db,
+		logger: logger,
+	}
+}
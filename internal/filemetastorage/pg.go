@@ -2,42 +2,91 @@ package filemetastorage
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"go.uber.org/zap"
 	"karma8"
+	"karma8/internal/logging"
 	"strconv"
-	"strings"
+	"time"
 )
 
 type dbFilePart struct {
-	StorageURL    string `db:"storage_url"`
-	Path          string `db:"file_path"`
-	ContentLength int64  `db:"content_length"`
+	StorageURL    string   `db:"storage_url"`
+	Path          string   `db:"file_path"`
+	ContentLength int64    `db:"content_length"`
+	Checksum      string   `db:"checksum"`
+	Replicas      []string `db:"replicas"`
+	Shared        bool     `db:"shared"`
+	Codec         string   `db:"codec"`
+	StoredLength  int64    `db:"stored_length"`
 }
 
 func (m dbFilePart) Value() (driver.Value, error) {
-	return fmt.Sprintf("(%s,%s,%d)", m.StorageURL, m.Path, m.ContentLength), nil
+	replicas, err := pq.StringArray(m.Replicas).Value()
+	if err != nil {
+		return nil, err
+	}
+	if replicas == nil {
+		replicas = "{}"
+	}
+
+	return formatRecord(
+		m.StorageURL,
+		m.Path,
+		strconv.FormatInt(m.ContentLength, 10),
+		m.Checksum,
+		replicas.(string),
+		strconv.FormatBool(m.Shared),
+		m.Codec,
+		strconv.FormatInt(m.StoredLength, 10),
+	), nil
 }
 
 func (m *dbFilePart) Scan(src interface{}) error {
 	rawValue := string(src.([]byte))
-	rawValue = rawValue[1 : len(rawValue)-1]
-	splitValue := strings.Split(rawValue, ",")
-	if len(splitValue) != 3 {
-		return fmt.Errorf("unexpected split len for '%s': %d", rawValue, len(splitValue))
+	fields, err := parseRecord(rawValue)
+	if err != nil {
+		return fmt.Errorf("can't parse '%s': %w", rawValue, err)
+	}
+	if len(fields) != 8 {
+		return fmt.Errorf("unexpected fields count for '%s': %d", rawValue, len(fields))
 	}
-	m.StorageURL = splitValue[0]
-	m.Path = splitValue[1]
+	m.StorageURL = fields[0]
+	m.Path = fields[1]
 
-	contentLength, err := strconv.ParseInt(splitValue[2], 10, 64)
+	contentLength, err := strconv.ParseInt(fields[2], 10, 64)
 	if err != nil {
 		return fmt.Errorf("can't parse ContentLength: %w", err)
 	}
 
 	m.ContentLength = contentLength
+	m.Checksum = fields[3]
+
+	var replicas pq.StringArray
+	if fields[4] != "" {
+		if err := replicas.Scan([]byte(fields[4])); err != nil {
+			return fmt.Errorf("can't parse Replicas: %w", err)
+		}
+	}
+	m.Replicas = replicas
+	// NOTE: Booleans are formatted as t and f by postgres.
+	m.Shared = fields[5] == "t"
+	m.Codec = fields[6]
+
+	// NOTE: Stored length is NULL for parts written before compression was introduced.
+	m.StoredLength = 0
+	if fields[7] != "" {
+		storedLength, err := strconv.ParseInt(fields[7], 10, 64)
+		if err != nil {
+			return fmt.Errorf("can't parse StoredLength: %w", err)
+		}
+		m.StoredLength = storedLength
+	}
 
 	return nil
 }
@@ -72,8 +121,12 @@ type pgStorage struct {
 	logger *zap.Logger
 }
 
-func (m *pgStorage) Transact(ctx context.Context, atomic func(tx *sqlx.Tx) error) (err error) {
-	tx, err := m.db.BeginTxx(ctx, nil)
+func (m *pgStorage) Transact(ctx context.Context, atomic func(tx *sqlx.Tx) error) error {
+	return transact(ctx, m.db, atomic)
+}
+
+func transact(ctx context.Context, db *sqlx.DB, atomic func(tx *sqlx.Tx) error) (err error) {
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -95,33 +148,101 @@ func (m *pgStorage) Transact(ctx context.Context, atomic func(tx *sqlx.Tx) error
 }
 
 func (m *pgStorage) PutProcessingFileMeta(ctx context.Context, meta *karma8.FileMeta) error {
-	_, err := m.db.ExecContext(
+	masterKeyID, wrappedKey, keyFingerprint := fileEncryptionColumns(meta.Encryption)
+	err := m.db.QueryRowContext(
 		ctx,
-		`INSERT INTO processing_file (name, parts, content_length) VALUES ($1, $2, $3)`,
+		`
+INSERT INTO processing_file (
+    bucket, name, tenant, parts, content_length, expire_datetime, legal_hold, retain_until,
+    master_key_id, wrapped_key, key_fingerprint
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+RETURNING create_datetime`,
+		meta.Bucket,
 		meta.Name,
+		meta.Tenant,
 		pq.Array(convertFileParts(meta.Parts)),
 		meta.ContentLength,
-	)
+		meta.ExpireTime,
+		meta.Lock.LegalHold,
+		meta.Lock.RetainUntil,
+		masterKeyID,
+		wrappedKey,
+		keyFingerprint,
+	).Scan(&meta.CreateTime)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		return karma8.ErrFileAlreadyExists
+	}
 	if err != nil {
-		m.logger.Error("can't put processing file meta", zap.Error(err))
+		logging.FromContext(ctx, m.logger).Error("can't put processing file meta", zap.Error(err))
 		return err
 	}
 	return nil
 }
 
-func (m *pgStorage) CompleteFileMeta(ctx context.Context, filename string) error {
+func (m *pgStorage) CompleteFileMeta(ctx context.Context, meta *karma8.FileMeta, tenantQuota int64) error {
 	err := m.Transact(ctx, func(tx *sqlx.Tx) error {
-		_, err := tx.ExecContext(
+		if err := refreshBlobParts(ctx, tx, meta.Bucket, meta.Parts); err != nil {
+			if !errors.Is(err, karma8.ErrBlobNotFound) {
+				logging.FromContext(ctx, m.logger).Error("can't refresh blob parts", zap.Error(err))
+			}
+			return err
+		}
+
+		result, err := tx.ExecContext(
 			ctx,
 			`
-INSERT INTO file
-SELECT * FROM processing_file
-WHERE name = $1;
+INSERT INTO file (
+    bucket, name, tenant, parts, content_length, expire_datetime, legal_hold, retain_until,
+    master_key_id, wrapped_key, key_fingerprint
+)
+SELECT
+    bucket, name, tenant, $3, content_length, expire_datetime, legal_hold, retain_until,
+    master_key_id, wrapped_key, key_fingerprint
+FROM processing_file
+WHERE bucket = $1 AND name = $2 AND create_datetime = $4;
 `,
-			filename,
+			meta.Bucket,
+			meta.Name,
+			pq.Array(convertFileParts(meta.Parts)),
+			meta.CreateTime,
 		)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+			return karma8.ErrFileAlreadyExists
+		}
 		if err != nil {
-			m.logger.Error("can't move file meta to completed", zap.Error(err))
+			logging.FromContext(ctx, m.logger).Error("can't move file meta to completed", zap.Error(err))
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			// NOTE: Janitor cleaned up the upload meanwhile, its parts may be already deleted.
+			return karma8.ErrUploadAborted
+		}
+
+		if err := addTenantUsage(ctx, tx, meta.Tenant, meta.ContentLength, tenantQuota); err != nil {
+			if !errors.Is(err, karma8.ErrTenantQuotaExceeded) {
+				logging.FromContext(ctx, m.logger).Error("can't update tenant usage", zap.Error(err))
+			}
+			return err
+		}
+		if err := addBucketUsage(ctx, tx, meta.Bucket, meta.ContentLength, true); err != nil {
+			if !errors.Is(err, karma8.ErrBucketQuotaExceeded) {
+				logging.FromContext(ctx, m.logger).Error("can't update bucket usage", zap.Error(err))
+			}
+			return err
+		}
+
+		if err := addBlobRefs(ctx, tx, meta.Bucket, meta.Parts, 1); err != nil {
+			if !errors.Is(err, karma8.ErrBlobNotFound) {
+				logging.FromContext(ctx, m.logger).Error("can't add blob references", zap.Error(err))
+			}
 			return err
 		}
 
@@ -129,12 +250,14 @@ WHERE name = $1;
 			ctx,
 			`
 DELETE FROM processing_file
-WHERE name = $1;
+WHERE bucket = $1 AND name = $2 AND create_datetime = $3;
 `,
-			filename,
+			meta.Bucket,
+			meta.Name,
+			meta.CreateTime,
 		)
 		if err != nil {
-			m.logger.Error("can't delete processing meta", zap.Error(err))
+			logging.FromContext(ctx, m.logger).Error("can't delete processing meta", zap.Error(err))
 			return err
 		}
 
@@ -147,26 +270,596 @@ WHERE name = $1;
 	return nil
 }
 
-func (m *pgStorage) GetFileMeta(ctx context.Context, filename string) (*karma8.FileMeta, error) {
-	var name string
-	var parts []dbFilePart
-	var contentLength int64
-	err := m.db.QueryRowContext(
+func (m *pgStorage) DeleteProcessingFileMeta(
+	ctx context.Context,
+	bucket string,
+	filename string,
+	createTime time.Time,
+) error {
+	result, err := m.db.ExecContext(
 		ctx,
 		`
-SELECT name, parts, content_length FROM file
-WHERE name = $1`,
+DELETE FROM processing_file
+WHERE bucket = $1 AND name = $2 AND create_datetime = $3`,
+		bucket,
 		filename,
-	).Scan(&name, pq.Array(&parts), &contentLength)
+		createTime,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't delete processing meta", zap.Error(err))
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return karma8.ErrFileNotFound
+	}
+
+	return nil
+}
+
+func (m *pgStorage) ListStaleProcessingFileMetas(
+	ctx context.Context,
+	before time.Time,
+	limit int,
+) ([]*karma8.FileMeta, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT
+    bucket, name, tenant, parts, content_length, create_datetime, expire_datetime, legal_hold, retain_until,
+    master_key_id, wrapped_key, key_fingerprint
+FROM processing_file
+WHERE create_datetime < $1
+ORDER BY create_datetime
+LIMIT $2`,
+		before,
+		limit,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list stale processing file metas", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFileMetas(rows)
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFileMeta(row rowScanner) (*karma8.FileMeta, error) {
+	var bucket, name, tenant string
+	var parts []dbFilePart
+	var contentLength int64
+	var createTime time.Time
+	var expireTime, retainUntil sql.NullTime
+	var legalHold bool
+	var masterKeyID sql.NullString
+	var wrappedKey []byte
+	var keyFingerprint sql.NullString
+	err := row.Scan(
+		&bucket,
+		&name,
+		&tenant,
+		pq.Array(&parts),
+		&contentLength,
+		&createTime,
+		&expireTime,
+		&legalHold,
+		&retainUntil,
+		&masterKeyID,
+		&wrappedKey,
+		&keyFingerprint,
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	return &karma8.FileMeta{
+	fileMeta := &karma8.FileMeta{
+		Bucket:        bucket,
 		Name:          name,
+		Tenant:        tenant,
 		Parts:         convertDBFileParts(parts),
 		ContentLength: contentLength,
-	}, nil
+		CreateTime:    createTime,
+		Lock:          karma8.FileLock{LegalHold: legalHold},
+		Encryption:    convertFileEncryption(masterKeyID, wrappedKey, keyFingerprint),
+	}
+	if expireTime.Valid {
+		fileMeta.ExpireTime = &expireTime.Time
+	}
+	if retainUntil.Valid {
+		fileMeta.Lock.RetainUntil = &retainUntil.Time
+	}
+	return fileMeta, nil
+}
+
+func scanFileMetas(rows *sql.Rows) ([]*karma8.FileMeta, error) {
+	var result []*karma8.FileMeta
+	for rows.Next() {
+		fileMeta, err := scanFileMeta(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, fileMeta)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *pgStorage) GetFileMeta(ctx context.Context, bucket string, filename string) (*karma8.FileMeta, error) {
+	row := m.db.QueryRowContext(
+		ctx,
+		`
+SELECT
+    bucket, name, tenant, parts, content_length, create_datetime, expire_datetime, legal_hold, retain_until,
+    master_key_id, wrapped_key, key_fingerprint
+FROM file
+WHERE bucket = $1 AND name = $2`,
+		bucket,
+		filename,
+	)
+	fileMeta, err := scanFileMeta(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, karma8.ErrFileNotFound
+	}
+	return fileMeta, err
+}
+
+func (m *pgStorage) ListFileMetas(ctx context.Context, after karma8.FileKey, limit int) ([]*karma8.FileMeta, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT
+    bucket, name, tenant, parts, content_length, create_datetime, expire_datetime, legal_hold, retain_until,
+    master_key_id, wrapped_key, key_fingerprint
+FROM file
+WHERE (bucket, name) > ($1, $2)
+ORDER BY bucket, name
+LIMIT $3`,
+		after.Bucket,
+		after.Name,
+		limit,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list file metas", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFileMetas(rows)
+}
+
+func (m *pgStorage) ListFileMetasByStorage(
+	ctx context.Context,
+	storageURL string,
+	after karma8.FileKey,
+	limit int,
+) ([]*karma8.FileMeta, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT
+    bucket, name, tenant, parts, content_length, create_datetime, expire_datetime, legal_hold, retain_until,
+    master_key_id, wrapped_key, key_fingerprint
+FROM file
+WHERE (bucket, name) > ($2, $3) AND EXISTS (
+    SELECT 1 FROM unnest(parts) AS p
+    WHERE (p).storage_url = $1 OR $1 = ANY ((p).replicas)
+)
+ORDER BY bucket, name
+LIMIT $4`,
+		storageURL,
+		after.Bucket,
+		after.Name,
+		limit,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list file metas by storage", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFileMetas(rows)
+}
+
+func (m *pgStorage) CountProcessingFilesByStorage(ctx context.Context, storageURL string) (int, error) {
+	var count int
+	err := m.db.QueryRowContext(
+		ctx,
+		`
+SELECT COUNT(*) FROM processing_file
+WHERE EXISTS (
+    SELECT 1 FROM unnest(parts) AS p
+    WHERE (p).storage_url = $1 OR $1 = ANY ((p).replicas)
+)`,
+		storageURL,
+	).Scan(&count)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't count processing files by storage", zap.Error(err))
+		return 0, err
+	}
+	return count, nil
+}
+
+func (m *pgStorage) ListExpiredFileMetas(ctx context.Context, now time.Time, limit int) ([]*karma8.FileMeta, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT
+    f.bucket, f.name, f.tenant, f.parts, f.content_length, f.create_datetime, f.expire_datetime,
+    f.legal_hold, f.retain_until, f.master_key_id, f.wrapped_key, f.key_fingerprint
+FROM file AS f
+JOIN bucket AS b ON b.name = f.bucket
+WHERE (
+    f.expire_datetime < $1
+    OR (b.retention_seconds > 0 AND f.create_datetime + b.retention_seconds * INTERVAL '1 second' < $1)
+) AND NOT f.legal_hold AND (f.retain_until IS NULL OR f.retain_until < $1)
+LIMIT $2`,
+		now,
+		limit,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list expired file metas", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFileMetas(rows)
+}
+
+// selectUnlockedFile locks row of the file until the end of transaction and fails with ErrFileLocked if file is under WORM lock.
+func selectUnlockedFile(ctx context.Context, tx *sqlx.Tx, key karma8.FileKey) error {
+	var lock karma8.FileLock
+	var retainUntil sql.NullTime
+	err := tx.QueryRowContext(
+		ctx,
+		`
+SELECT legal_hold, retain_until FROM file
+WHERE bucket = $1 AND name = $2
+FOR UPDATE`,
+		key.Bucket,
+		key.Name,
+	).Scan(&lock.LegalHold, &retainUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return karma8.ErrFileNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if retainUntil.Valid {
+		lock.RetainUntil = &retainUntil.Time
+	}
+
+	if lock.IsLocked(time.Now()) {
+		return karma8.ErrFileLocked
+	}
+	return nil
+}
+
+func (m *pgStorage) DeleteFileMeta(ctx context.Context, key karma8.FileKey) error {
+	return m.Transact(ctx, func(tx *sqlx.Tx) error {
+		if err := selectUnlockedFile(ctx, tx, key); err != nil {
+			if !errors.Is(err, karma8.ErrFileNotFound) && !errors.Is(err, karma8.ErrFileLocked) {
+				logging.FromContext(ctx, m.logger).Error("can't check file lock", zap.Error(err))
+			}
+			return err
+		}
+
+		var tenant string
+		var contentLength int64
+		err := tx.QueryRowContext(
+			ctx,
+			`
+WITH deleted AS (
+    DELETE FROM file
+    WHERE bucket = $1 AND name = $2
+    RETURNING
+        bucket, name, tenant, parts, content_length, create_datetime, expire_datetime,
+        master_key_id, wrapped_key, key_fingerprint
+)
+INSERT INTO deleted_file (
+    bucket, name, tenant, parts, content_length, create_datetime, expire_datetime,
+    master_key_id, wrapped_key, key_fingerprint
+)
+SELECT
+    bucket, name, tenant, parts, content_length, create_datetime, expire_datetime,
+    master_key_id, wrapped_key, key_fingerprint
+FROM deleted
+RETURNING tenant, content_length`,
+			key.Bucket,
+			key.Name,
+		).Scan(&tenant, &contentLength)
+		if errors.Is(err, sql.ErrNoRows) {
+			return karma8.ErrFileNotFound
+		}
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't move file meta to trash", zap.Error(err))
+			return err
+		}
+
+		// NOTE: Files in trash aren't accounted, restore adds them back.
+		if err := addTenantUsage(ctx, tx, tenant, -contentLength, 0); err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't update tenant usage", zap.Error(err))
+			return err
+		}
+		if err := addBucketUsage(ctx, tx, key.Bucket, -contentLength, false); err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't update bucket usage", zap.Error(err))
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (m *pgStorage) SetFileLock(ctx context.Context, key karma8.FileKey, lock karma8.FileLock) error {
+	return m.Transact(ctx, func(tx *sqlx.Tx) error {
+		var retainUntil sql.NullTime
+		err := tx.QueryRowContext(
+			ctx,
+			`
+SELECT retain_until FROM file
+WHERE bucket = $1 AND name = $2
+FOR UPDATE`,
+			key.Bucket,
+			key.Name,
+		).Scan(&retainUntil)
+		if errors.Is(err, sql.ErrNoRows) {
+			return karma8.ErrFileNotFound
+		}
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't select file lock", zap.Error(err))
+			return err
+		}
+
+		if retainUntil.Valid && retainUntil.Time.After(time.Now()) &&
+			(lock.RetainUntil == nil || lock.RetainUntil.Before(retainUntil.Time)) {
+			return karma8.ErrRetentionShortened
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`
+UPDATE file SET legal_hold = $3, retain_until = $4
+WHERE bucket = $1 AND name = $2`,
+			key.Bucket,
+			key.Name,
+			lock.LegalHold,
+			lock.RetainUntil,
+		)
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't update file lock", zap.Error(err))
+			return err
+		}
+
+		return nil
+	})
+}
+
+func hasLocation(part *dbFilePart, location string) bool {
+	if part.StorageURL == location {
+		return true
+	}
+	for _, replica := range part.Replicas {
+		if replica == location {
+			return true
+		}
+	}
+	return false
+}
+
+func replaceLocation(part *dbFilePart, from, to string) bool {
+	if part.StorageURL == from {
+		part.StorageURL = to
+		return true
+	}
+	for i, replica := range part.Replicas {
+		if replica == from {
+			part.Replicas[i] = to
+			return true
+		}
+	}
+	return false
+}
+
+func (m *pgStorage) MoveFilePart(ctx context.Context, key karma8.FileKey, partIndex int, from, to string) error {
+	return m.Transact(ctx, func(tx *sqlx.Tx) error {
+		var parts []dbFilePart
+		err := tx.QueryRowContext(
+			ctx,
+			`
+SELECT parts FROM file
+WHERE bucket = $1 AND name = $2
+FOR UPDATE`,
+			key.Bucket,
+			key.Name,
+		).Scan(pq.Array(&parts))
+		if errors.Is(err, sql.ErrNoRows) {
+			return karma8.ErrFilePartMoved
+		}
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't select file parts", zap.Error(err))
+			return err
+		}
+
+		if partIndex >= len(parts) || !hasLocation(&parts[partIndex], from) {
+			return karma8.ErrFilePartMoved
+		}
+
+		if parts[partIndex].Shared {
+			if err := moveBlob(ctx, tx, key.Bucket, &parts[partIndex], from, to); err != nil {
+				logging.FromContext(ctx, m.logger).Error("can't move blob", zap.Error(err))
+				return err
+			}
+			return nil
+		}
+
+		replaceLocation(&parts[partIndex], from, to)
+
+		_, err = tx.ExecContext(
+			ctx,
+			`
+UPDATE file SET parts = $3
+WHERE bucket = $1 AND name = $2`,
+			key.Bucket,
+			key.Name,
+			pq.Array(parts),
+		)
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't update file parts", zap.Error(err))
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (m *pgStorage) GetStorageUsage(ctx context.Context) (map[string]int64, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT storage_url, SUM(stored_size) FROM (
+    SELECT (p).storage_url, (p).file_path,
+           CASE WHEN (p).stored_length > 0 THEN (p).stored_length ELSE (p).content_length END AS stored_size
+    FROM file, unnest(parts) AS p
+    UNION
+    SELECT r, (p).file_path,
+           CASE WHEN (p).stored_length > 0 THEN (p).stored_length ELSE (p).content_length END AS stored_size
+    FROM file, unnest(parts) AS p, unnest((p).replicas) AS r
+) AS location
+GROUP BY storage_url`,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't get storage usage", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]int64{}
+	for rows.Next() {
+		var storageURL string
+		var usage int64
+		if err := rows.Scan(&storageURL, &usage); err != nil {
+			return nil, err
+		}
+		result[storageURL] = usage
+	}
+
+	return result, rows.Err()
+}
+
+// addTenantUsage changes usage of the tenant by delta bytes, delete paths pass negative delta.
+// It fails with ErrTenantQuotaExceeded if usage exceeds the quota after the change, zero quota means unlimited.
+// NOTE: Usage row is locked by the update, so concurrent uploads of the tenant can't overcommit the quota together.
+func addTenantUsage(ctx context.Context, tx *sqlx.Tx, tenant string, delta int64, quota int64) error {
+	result, err := tx.ExecContext(
+		ctx,
+		`
+INSERT INTO tenant_usage (tenant, used_bytes)
+SELECT $1::VARCHAR, $2::BIGINT
+WHERE $3::BIGINT <= 0 OR $2::BIGINT <= $3::BIGINT
+ON CONFLICT (tenant) DO UPDATE
+SET used_bytes = tenant_usage.used_bytes + excluded.used_bytes, update_datetime = CURRENT_TIMESTAMP
+WHERE $3::BIGINT <= 0 OR tenant_usage.used_bytes + excluded.used_bytes <= $3::BIGINT`,
+		tenant,
+		delta,
+		quota,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return karma8.ErrTenantQuotaExceeded
+	}
+	return nil
+}
+
+// addBucketUsage changes usage of the bucket by delta bytes like addTenantUsage, quota is taken from the bucket itself.
+// It fails with ErrBucketQuotaExceeded if checkQuota is set and usage exceeds the quota after the change.
+func addBucketUsage(ctx context.Context, tx *sqlx.Tx, bucket string, delta int64, checkQuota bool) error {
+	result, err := tx.ExecContext(
+		ctx,
+		`
+UPDATE bucket SET used_bytes = used_bytes + $2::BIGINT
+WHERE name = $1 AND (NOT $3::BOOLEAN OR quota_bytes <= 0 OR used_bytes + $2::BIGINT <= quota_bytes)`,
+		bucket,
+		delta,
+		checkQuota,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return karma8.ErrBucketQuotaExceeded
+	}
+	return nil
+}
+
+func (m *pgStorage) GetTenantUsage(ctx context.Context, tenant string) (int64, error) {
+	var usage int64
+	err := m.db.QueryRowContext(
+		ctx,
+		`
+SELECT
+    COALESCE((SELECT used_bytes FROM tenant_usage WHERE tenant = $1), 0) +
+    COALESCE((SELECT SUM(content_length) FROM processing_file WHERE tenant = $1), 0)`,
+		tenant,
+	).Scan(&usage)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't get tenant usage", zap.String("tenant", tenant), zap.Error(err))
+		return 0, err
+	}
+	return usage, nil
+}
+
+func (m *pgStorage) GetReferencedPaths(ctx context.Context, storageURL string) (map[string]struct{}, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT (p).file_path FROM file, unnest(parts) AS p
+WHERE (p).storage_url = $1 OR $1 = ANY ((p).replicas)
+UNION
+SELECT (p).file_path FROM processing_file, unnest(parts) AS p
+WHERE (p).storage_url = $1 OR $1 = ANY ((p).replicas)
+UNION
+SELECT (p).file_path FROM deleted_file, unnest(parts) AS p
+WHERE (p).storage_url = $1 OR $1 = ANY ((p).replicas)
+UNION
+SELECT (part).file_path FROM blob
+WHERE (part).storage_url = $1 OR $1 = ANY ((part).replicas)`,
+		storageURL,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't get referenced paths", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]struct{}{}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		result[path] = struct{}{}
+	}
+
+	return result, rows.Err()
 }
 
 func NewPGStorage(db *sqlx.DB, logger *zap.Logger) karma8.FileMetaStorage {
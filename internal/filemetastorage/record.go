@@ -0,0 +1,68 @@
+package filemetastorage
+
+import (
+	"errors"
+	"strings"
+)
+
+var errMalformedRecord = errors.New("malformed record")
+
+// formatRecord builds text representation of postgres composite value, every field is quoted.
+func formatRecord(fields ...string) string {
+	var builder strings.Builder
+	builder.WriteByte('(')
+	for i, field := range fields {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteByte('"')
+		for _, r := range field {
+			if r == '"' || r == '\\' {
+				builder.WriteByte('\\')
+			}
+			builder.WriteRune(r)
+		}
+		builder.WriteByte('"')
+	}
+	builder.WriteByte(')')
+	return builder.String()
+}
+
+// parseRecord splits text representation of postgres composite value into fields.
+// NULL fields are returned as empty strings.
+func parseRecord(raw string) ([]string, error) {
+	if len(raw) < 2 || raw[0] != '(' || raw[len(raw)-1] != ')' {
+		return nil, errMalformedRecord
+	}
+	raw = raw[1 : len(raw)-1]
+
+	var fields []string
+	var field strings.Builder
+	quoted := false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case quoted && c == '\\':
+			i++
+			if i == len(raw) {
+				return nil, errMalformedRecord
+			}
+			field.WriteByte(raw[i])
+		case quoted && c == '"' && i+1 < len(raw) && raw[i+1] == '"':
+			i++
+			field.WriteByte('"')
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == ',':
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(c)
+		}
+	}
+	if quoted {
+		return nil, errMalformedRecord
+	}
+
+	return append(fields, field.String()), nil
+}
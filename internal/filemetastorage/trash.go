@@ -0,0 +1,331 @@
+package filemetastorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/logging"
+	"time"
+)
+
+// pqUniqueViolation is error code of pg for duplicated key.
+const pqUniqueViolation = "23505"
+
+type pgTrashStorage struct {
+	db *sqlx.DB
+
+	logger *zap.Logger
+}
+
+func scanDeletedFile(row rowScanner) (*karma8.DeletedFile, error) {
+	var id int64
+	var bucket, name, tenant string
+	var parts []dbFilePart
+	var contentLength int64
+	var createTime, deleteTime time.Time
+	var expireTime sql.NullTime
+	var masterKeyID sql.NullString
+	var wrappedKey []byte
+	var keyFingerprint sql.NullString
+	err := row.Scan(
+		&id,
+		&bucket,
+		&name,
+		&tenant,
+		pq.Array(&parts),
+		&contentLength,
+		&createTime,
+		&expireTime,
+		&deleteTime,
+		&masterKeyID,
+		&wrappedKey,
+		&keyFingerprint,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	deletedFile := &karma8.DeletedFile{
+		ID: id,
+		Meta: &karma8.FileMeta{
+			Bucket:        bucket,
+			Name:          name,
+			Tenant:        tenant,
+			Parts:         convertDBFileParts(parts),
+			ContentLength: contentLength,
+			CreateTime:    createTime,
+			Encryption:    convertFileEncryption(masterKeyID, wrappedKey, keyFingerprint),
+		},
+		DeleteTime: deleteTime,
+	}
+	if expireTime.Valid {
+		deletedFile.Meta.ExpireTime = &expireTime.Time
+	}
+	return deletedFile, nil
+}
+
+func scanDeletedFiles(rows *sql.Rows) ([]*karma8.DeletedFile, error) {
+	var result []*karma8.DeletedFile
+	for rows.Next() {
+		deletedFile, err := scanDeletedFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, deletedFile)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *pgTrashStorage) ListDeletedFiles(ctx context.Context, bucket string, limit int) ([]*karma8.DeletedFile, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT
+    id, bucket, name, tenant, parts, content_length, create_datetime, expire_datetime, delete_datetime,
+    master_key_id, wrapped_key, key_fingerprint
+FROM deleted_file
+WHERE bucket = $1
+ORDER BY delete_datetime DESC
+LIMIT $2`,
+		bucket,
+		limit,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list deleted files", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeletedFiles(rows)
+}
+
+func (m *pgTrashStorage) ListPurgeableDeletedFiles(
+	ctx context.Context,
+	before time.Time,
+	limit int,
+) ([]*karma8.DeletedFile, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT
+    id, bucket, name, tenant, parts, content_length, create_datetime, expire_datetime, delete_datetime,
+    master_key_id, wrapped_key, key_fingerprint
+FROM deleted_file
+WHERE delete_datetime < $1
+ORDER BY delete_datetime
+LIMIT $2`,
+		before,
+		limit,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list purgeable deleted files", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeletedFiles(rows)
+}
+
+func (m *pgTrashStorage) RestoreDeletedFile(ctx context.Context, id int64) (*karma8.FileMeta, error) {
+	var fileMeta *karma8.FileMeta
+	err := transact(ctx, m.db, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			`
+DELETE FROM deleted_file
+WHERE id = $1
+RETURNING
+    bucket, name, tenant, parts, content_length, create_datetime,
+    expire_datetime, FALSE, NULL::TIMESTAMP WITH TIME ZONE,
+    master_key_id, wrapped_key, key_fingerprint`,
+			id,
+		)
+		var err error
+		fileMeta, err = scanFileMeta(row)
+		if errors.Is(err, sql.ErrNoRows) {
+			return karma8.ErrDeletedFileNotFound
+		}
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't delete file meta from trash", zap.Error(err))
+			return err
+		}
+
+		masterKeyID, wrappedKey, keyFingerprint := fileEncryptionColumns(fileMeta.Encryption)
+		_, err = tx.ExecContext(
+			ctx,
+			`
+INSERT INTO file (
+    bucket, name, tenant, parts, content_length, create_datetime, expire_datetime,
+    master_key_id, wrapped_key, key_fingerprint
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			fileMeta.Bucket,
+			fileMeta.Name,
+			fileMeta.Tenant,
+			pq.Array(convertFileParts(fileMeta.Parts)),
+			fileMeta.ContentLength,
+			fileMeta.CreateTime,
+			fileMeta.ExpireTime,
+			masterKeyID,
+			wrappedKey,
+			keyFingerprint,
+		)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+			return karma8.ErrFileAlreadyExists
+		}
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't restore file meta", zap.Error(err))
+			return err
+		}
+
+		// NOTE: Quota isn't checked, see RestoreDeletedFile of TrashStorage.
+		if err := addTenantUsage(ctx, tx, fileMeta.Tenant, fileMeta.ContentLength, 0); err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't update tenant usage", zap.Error(err))
+			return err
+		}
+		if err := addBucketUsage(ctx, tx, fileMeta.Bucket, fileMeta.ContentLength, false); err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't update bucket usage", zap.Error(err))
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fileMeta, nil
+}
+
+func (m *pgTrashStorage) PurgeDeletedFile(ctx context.Context, id int64) ([]*karma8.FilePart, error) {
+	var parts []*karma8.FilePart
+	err := transact(ctx, m.db, func(tx *sqlx.Tx) error {
+		var bucket string
+		var dbParts []dbFilePart
+		err := tx.QueryRowContext(
+			ctx,
+			`
+DELETE FROM deleted_file
+WHERE id = $1
+RETURNING bucket, parts`,
+			id,
+		).Scan(&bucket, pq.Array(&dbParts))
+		if errors.Is(err, sql.ErrNoRows) {
+			return karma8.ErrDeletedFileNotFound
+		}
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't purge deleted file", zap.Error(err))
+			return err
+		}
+
+		// NOTE: Blobs without references are deleted by the janitor.
+		parts = convertDBFileParts(dbParts)
+		if err := addBlobRefs(ctx, tx, bucket, parts, -1); err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't release blob references", zap.Error(err))
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parts, nil
+}
+
+func (m *pgTrashStorage) ListDeletedFilesByStorage(
+	ctx context.Context,
+	storageURL string,
+	afterID int64,
+	limit int,
+) ([]*karma8.DeletedFile, error) {
+	rows, err := m.db.QueryContext(
+		ctx,
+		`
+SELECT
+    id, bucket, name, tenant, parts, content_length, create_datetime, expire_datetime, delete_datetime,
+    master_key_id, wrapped_key, key_fingerprint
+FROM deleted_file
+WHERE id > $2 AND EXISTS (
+    SELECT 1 FROM unnest(parts) AS p
+    WHERE (p).storage_url = $1 OR $1 = ANY ((p).replicas)
+)
+ORDER BY id
+LIMIT $3`,
+		storageURL,
+		afterID,
+		limit,
+	)
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Error("can't list deleted files by storage", zap.Error(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDeletedFiles(rows)
+}
+
+func (m *pgTrashStorage) MoveDeletedFilePart(ctx context.Context, id int64, partIndex int, from, to string) error {
+	return transact(ctx, m.db, func(tx *sqlx.Tx) error {
+		var bucket string
+		var parts []dbFilePart
+		err := tx.QueryRowContext(
+			ctx,
+			`
+SELECT bucket, parts FROM deleted_file
+WHERE id = $1
+FOR UPDATE`,
+			id,
+		).Scan(&bucket, pq.Array(&parts))
+		if errors.Is(err, sql.ErrNoRows) {
+			return karma8.ErrFilePartMoved
+		}
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't select deleted file parts", zap.Error(err))
+			return err
+		}
+
+		if partIndex >= len(parts) || !hasLocation(&parts[partIndex], from) {
+			return karma8.ErrFilePartMoved
+		}
+
+		if parts[partIndex].Shared {
+			if err := moveBlob(ctx, tx, bucket, &parts[partIndex], from, to); err != nil {
+				logging.FromContext(ctx, m.logger).Error("can't move blob", zap.Error(err))
+				return err
+			}
+			return nil
+		}
+
+		replaceLocation(&parts[partIndex], from, to)
+
+		_, err = tx.ExecContext(
+			ctx,
+			`
+UPDATE deleted_file SET parts = $2
+WHERE id = $1`,
+			id,
+			pq.Array(parts),
+		)
+		if err != nil {
+			logging.FromContext(ctx, m.logger).Error("can't update deleted file parts", zap.Error(err))
+			return err
+		}
+
+		return nil
+	})
+}
+
+func NewPGTrashStorage(db *sqlx.DB, logger *zap.Logger) karma8.TrashStorage {
+	return &pgTrashStorage{
+		db:     db,
+		logger: logger,
+	}
+}
@@ -0,0 +1,146 @@
+package fileservice
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"karma8"
+	"time"
+)
+
+const firstChunkSize = 32 * 1024
+
+type hedgeResult struct {
+	locationIndex int
+	body          io.ReadCloser
+	err           error
+}
+
+type prefixedBody struct {
+	io.Reader
+	body   io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (m *prefixedBody) Close() error {
+	defer m.cancel()
+	return m.body.Close()
+}
+
+// hedgedBody releases context of the winning hedged read on close.
+type hedgedBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (m *hedgedBody) Close() error {
+	defer m.cancel()
+	return m.ReadCloser.Close()
+}
+
+// openWithFirstChunk opens part and waits for the first data, so slow storage is noticed before the body is returned.
+func openWithFirstChunk(
+	ctx context.Context,
+	storage karma8.Storage,
+	path string,
+	offset int64,
+) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	body, err := storage.ReadFilePart(ctx, path, offset)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	chunk := make([]byte, firstChunkSize)
+	var n int
+	for n == 0 && err == nil {
+		n, err = body.Read(chunk)
+	}
+	if err != nil && err != io.EOF {
+		_ = body.Close()
+		cancel()
+		return nil, err
+	}
+
+	return &prefixedBody{
+		Reader: io.MultiReader(bytes.NewReader(chunk[:n]), body),
+		body:   body,
+		cancel: cancel,
+	}, nil
+}
+
+func (m *multiStorageReader) hedgeDelay() time.Duration {
+	delay, ok := m.latency.percentile(m.hedgePercentile)
+	if !ok || delay < m.hedgeMinDelay {
+		return m.hedgeMinDelay
+	}
+	return delay
+}
+
+// openHedged reads the current part from the current location and, if the first data isn't received
+// within hedge delay, from the next one too. The first answered location wins, the other read is canceled.
+// Part with a single location isn't hedged, because the second read would go to the same storage.
+func (m *multiStorageReader) openHedged() (io.ReadCloser, int, error) {
+	partIndex, offset := m.currentPartIndex, m.currentOffset
+	locations := m.currentPart().Locations()
+
+	results := make(chan hedgeResult, 2)
+	cancels := make(map[int]context.CancelFunc, 2)
+	start := func(locationIndex int) {
+		ctx, cancel := context.WithCancel(m.ctx)
+		cancels[locationIndex] = cancel
+
+		storage := m.storageHolder.GetStorage(locations[locationIndex%len(locations)])
+		go func() {
+			body, err := m.openPart(ctx, storage, partIndex, offset)
+			results <- hedgeResult{locationIndex: locationIndex, body: body, err: err}
+		}()
+	}
+
+	startTime := time.Now()
+	start(m.currentLocationIndex)
+	pending := 1
+
+	var hedge <-chan time.Time
+	if len(locations) > 1 {
+		timer := time.NewTimer(m.hedgeDelay())
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	for {
+		select {
+		case <-hedge:
+			start(m.currentLocationIndex + 1)
+			pending++
+		case result := <-results:
+			pending--
+			if result.err != nil {
+				cancels[result.locationIndex]()
+				if pending > 0 {
+					continue
+				}
+				return nil, 0, result.err
+			}
+
+			m.latency.observe(time.Since(startTime))
+
+			for locationIndex, cancel := range cancels {
+				if locationIndex != result.locationIndex {
+					cancel()
+				}
+			}
+			go func(pending int) {
+				for ; pending > 0; pending-- {
+					if loser := <-results; loser.err == nil {
+						_ = loser.body.Close()
+					}
+				}
+			}(pending)
+
+			return &hedgedBody{ReadCloser: result.body, cancel: cancels[result.locationIndex]}, result.locationIndex, nil
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package fileservice
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestHedgedRead(t *testing.T) {
+	tests := []struct {
+		name       string
+		delayA     time.Duration
+		wantOpensB []int64
+		wantMax    time.Duration
+	}{
+		{
+			name:       "fast primary isn't hedged",
+			wantOpensB: []int64{0},
+			wantMax:    time.Second,
+		},
+		{
+			name:       "replica wins over slow primary",
+			delayA:     5 * time.Second,
+			wantOpensB: []int64{0, 0},
+			wantMax:    time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileMeta, partData, data := newTestFile()
+			holder := testStorageHolder{
+				"a": {data: partData, delay: test.delayA},
+				"b": {data: partData},
+			}
+
+			startTime := time.Now()
+			read, err := readTestFile(holder, fileMeta, 0, fileMeta.ContentLength, Options{
+				ReadAttempts:    2,
+				HedgePercentile: 95,
+				HedgeMinDelay:   50 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("can't read file: %v", err)
+			}
+			if spent := time.Since(startTime); spent > test.wantMax {
+				t.Fatalf("read took %v, want at most %v", spent, test.wantMax)
+			}
+			if !bytes.Equal(read, data) {
+				t.Fatalf("read data is %q, want %q", read, data)
+			}
+			// NOTE: Part 1 is stored on b, so b is opened once more if part 0 is hedged.
+			if opens := holder["b"].openOffsets(); !equalOffsets(opens, test.wantOpensB) {
+				t.Fatalf("storage b is opened at %v, want %v", opens, test.wantOpensB)
+			}
+		})
+	}
+}
+
+func TestLatencyTrackerPercentile(t *testing.T) {
+	latency := newLatencyTracker()
+	for i := 1; i < latencyMinSamples; i++ {
+		latency.observe(time.Duration(i) * time.Millisecond)
+	}
+	if delay, ok := latency.percentile(50); ok {
+		t.Fatalf("percentile is %v before enough samples are observed", delay)
+	}
+
+	for i := latencyMinSamples; i <= 100; i++ {
+		latency.observe(time.Duration(i) * time.Millisecond)
+	}
+	if delay, ok := latency.percentile(50); !ok || delay != 50*time.Millisecond {
+		t.Fatalf("50th percentile is %v (ok %t), want 50ms", delay, ok)
+	}
+	if delay, ok := latency.percentile(100); !ok || delay != 100*time.Millisecond {
+		t.Fatalf("100th percentile is %v (ok %t), want 100ms", delay, ok)
+	}
+}
@@ -0,0 +1,55 @@
+package fileservice
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindowSize = 1024
+	latencyMinSamples = 32
+)
+
+// latencyTracker keeps the last latencies of storage reads to calculate hedging delay.
+type latencyTracker struct {
+	samples []time.Duration
+	next    int
+	mutex   sync.Mutex
+}
+
+func (m *latencyTracker) observe(latency time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.samples) < latencyWindowSize {
+		m.samples = append(m.samples, latency)
+		return
+	}
+	m.samples[m.next] = latency
+	m.next = (m.next + 1) % latencyWindowSize
+}
+
+// percentile returns false until there are enough samples.
+func (m *latencyTracker) percentile(p float64) (time.Duration, bool) {
+	m.mutex.Lock()
+	samples := append([]time.Duration(nil), m.samples...)
+	m.mutex.Unlock()
+
+	if len(samples) < latencyMinSamples {
+		return 0, false
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+
+	index := int(p / 100 * float64(len(samples)-1))
+	return samples[index], true
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{
+		samples: make([]time.Duration, 0, latencyWindowSize),
+	}
+}
@@ -0,0 +1,271 @@
+package fileservice
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"karma8"
+	"karma8/internal/compression"
+	"karma8/internal/encryption"
+	"time"
+)
+
+// multiStorageReader reads parts one by one. Failed part read is resumed from the same offset on the next
+// part location, so client doesn't get truncated body while there are attempts left.
+// Compressed parts are decompressed and encrypted ones are decrypted on the fly, offsets are always counted
+// in logical bytes. Reading starts from the part containing the requested offset, parts before it aren't opened.
+type multiStorageReader struct {
+	fileMeta *karma8.FileMeta
+	// dataKey decrypts parts, it's nil if file isn't encrypted.
+	dataKey       []byte
+	storageHolder karma8.StorageHolder
+	readAttempts  int
+	latency       *latencyTracker
+	// hedgePercentile of the first data latency is used as hedging delay, zero disables hedging.
+	hedgePercentile float64
+	hedgeMinDelay   time.Duration
+
+	currentPartIndex     int
+	currentOffset        int64
+	currentLocationIndex int
+	currentFailures      int
+	currentBody          io.ReadCloser
+	// remaining bytes of the requested range.
+	remaining int64
+
+	ctx    context.Context
+	logger *zap.Logger
+}
+
+func (m *multiStorageReader) currentPart() *karma8.FilePart {
+	return m.fileMeta.Parts[m.currentPartIndex]
+}
+
+func (m *multiStorageReader) currentLocation() string {
+	locations := m.currentPart().Locations()
+	return locations[m.currentLocationIndex%len(locations)]
+}
+
+type decodedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (m *decodedBody) Close() error {
+	_ = m.ReadCloser.Close()
+	return m.body.Close()
+}
+
+// openPart opens part on the storage at the given logical offset. Compressed data can't be read from the middle,
+// so compressed part is read from the start and decompressed data before the offset is skipped.
+// Encrypted part is read from the start of the chunk keeping the offset.
+// NOTE: Part and offset are passed explicitly, because hedged reads open parts in background.
+func (m *multiStorageReader) openPart(
+	ctx context.Context,
+	storage karma8.Storage,
+	partIndex int,
+	offset int64,
+) (io.ReadCloser, error) {
+	part := m.fileMeta.Parts[partIndex]
+
+	var skip int64
+	if part.Codec != "" {
+		offset, skip = 0, offset
+	}
+
+	var partCipher *encryption.PartCipher
+	if m.dataKey != nil {
+		var err error
+		partCipher, err = encryption.NewPartCipher(m.dataKey, partIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		var chunkSkip int64
+		offset, chunkSkip = encryption.SealedOffset(offset)
+		skip += chunkSkip
+	}
+
+	body, err := openWithFirstChunk(ctx, storage, part.Path, offset)
+	if err != nil {
+		return nil, err
+	}
+	if part.Codec == "" && partCipher == nil {
+		return body, nil
+	}
+
+	var reader io.Reader = body
+	if partCipher != nil {
+		reader = partCipher.NewReader(reader, offset)
+	}
+	decompressor, err := compression.NewReader(part.Codec, reader)
+	if err != nil {
+		_ = body.Close()
+		return nil, err
+	}
+	decoded := &decodedBody{ReadCloser: decompressor, body: body}
+
+	if _, err := io.CopyN(io.Discard, decoded, skip); err != nil {
+		_ = decoded.Close()
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return decoded, nil
+}
+
+func (m *multiStorageReader) openCurrentPart() error {
+	part := m.currentPart()
+
+	// NOTE: Hedging is used only for the first attempt, the next ones are plain failover.
+	if m.hedgePercentile > 0 && m.currentFailures == 0 && len(part.Replicas) > 0 {
+		body, locationIndex, err := m.openHedged()
+		if err == nil {
+			m.currentBody = body
+			m.currentLocationIndex = locationIndex
+			return nil
+		}
+
+		if failErr := m.fail(err); failErr != nil {
+			return failErr
+		}
+	}
+
+	for {
+		storage := m.storageHolder.GetStorage(m.currentLocation())
+		startTime := time.Now()
+		body, err := m.openPart(m.ctx, storage, m.currentPartIndex, m.currentOffset)
+		if err == nil {
+			m.latency.observe(time.Since(startTime))
+			m.currentBody = body
+			return nil
+		}
+
+		if failErr := m.fail(err); failErr != nil {
+			return failErr
+		}
+	}
+}
+
+// fail registers failed attempt and switches to the next location, error is returned when attempts are over.
+func (m *multiStorageReader) fail(err error) error {
+	if m.ctx.Err() != nil {
+		return m.ctx.Err()
+	}
+
+	m.currentFailures++
+	m.logger.Warn(
+		"can't read file part",
+		zap.String("filename", m.fileMeta.Name),
+		zap.Int("part_index", m.currentPartIndex),
+		zap.String("storage_url", m.currentLocation()),
+		zap.Int64("offset", m.currentOffset),
+		zap.Int("failures", m.currentFailures),
+		zap.Error(err),
+	)
+	if m.currentFailures >= m.readAttempts {
+		return err
+	}
+
+	m.currentLocationIndex++
+	return nil
+}
+
+func (m *multiStorageReader) Read(p []byte) (int, error) {
+	for {
+		if m.remaining == 0 || m.currentPartIndex >= len(m.fileMeta.Parts) {
+			return 0, io.EOF
+		}
+
+		part := m.currentPart()
+		if m.currentBody == nil {
+			if err := m.openCurrentPart(); err != nil {
+				return 0, err
+			}
+		}
+
+		// NOTE: Storage mustn't return more than expected, otherwise body won't match Content-Length.
+		limit := part.ContentLength - m.currentOffset
+		if limit > m.remaining {
+			limit = m.remaining
+		}
+		if int64(len(p)) > limit {
+			p = p[:limit]
+		}
+
+		n, err := m.currentBody.Read(p)
+		m.currentOffset += int64(n)
+		m.remaining -= int64(n)
+
+		if m.remaining == 0 {
+			return n, nil
+		}
+
+		if m.currentOffset == part.ContentLength {
+			_ = m.currentBody.Close()
+			m.currentBody = nil
+			m.currentPartIndex++
+			m.currentOffset = 0
+			m.currentLocationIndex = 0
+			m.currentFailures = 0
+		} else if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+
+			_ = m.currentBody.Close()
+			m.currentBody = nil
+			if failErr := m.fail(err); failErr != nil {
+				return n, failErr
+			}
+		} else {
+			return n, nil
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (m *multiStorageReader) Close() error {
+	if m.currentBody != nil {
+		return m.currentBody.Close()
+	}
+	return nil
+}
+
+func newMultiStorageReader(
+	ctx context.Context,
+	fileMeta *karma8.FileMeta,
+	dataKey []byte,
+	offset int64,
+	length int64,
+	storageHolder karma8.StorageHolder,
+	latency *latencyTracker,
+	options Options,
+	logger *zap.Logger,
+) *multiStorageReader {
+	partIndex := 0
+	for partIndex < len(fileMeta.Parts) && offset >= fileMeta.Parts[partIndex].ContentLength {
+		offset -= fileMeta.Parts[partIndex].ContentLength
+		partIndex++
+	}
+
+	return &multiStorageReader{
+		fileMeta:         fileMeta,
+		dataKey:          dataKey,
+		storageHolder:    storageHolder,
+		readAttempts:     options.ReadAttempts,
+		latency:          latency,
+		hedgePercentile:  options.HedgePercentile,
+		hedgeMinDelay:    options.HedgeMinDelay,
+		currentPartIndex: partIndex,
+		currentOffset:    offset,
+		remaining:        length,
+		ctx:              ctx,
+		logger:           logger,
+	}
+}
@@ -0,0 +1,219 @@
+package fileservice
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"karma8"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errTestRead = errors.New("storage read failed")
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errTestRead
+}
+
+// testStorage serves parts from memory, it may fail, truncate or delay reads like a broken storage.
+type testStorage struct {
+	karma8.Storage
+	data    map[string][]byte
+	openErr error
+	// truncate fails read after the given amount of bytes, zero disables it.
+	truncate int
+	// delay postpones opening until context is done.
+	delay time.Duration
+
+	opens []int64
+	mutex sync.Mutex
+}
+
+func (m *testStorage) ReadFilePart(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	m.mutex.Lock()
+	m.opens = append(m.opens, offset)
+	m.mutex.Unlock()
+
+	if m.delay > 0 {
+		timer := time.NewTimer(m.delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if m.openErr != nil {
+		return nil, m.openErr
+	}
+
+	data := m.data[path][offset:]
+	var reader io.Reader = bytes.NewReader(data)
+	if m.truncate > 0 && m.truncate < len(data) {
+		reader = io.MultiReader(bytes.NewReader(data[:m.truncate]), failingReader{})
+	}
+	return io.NopCloser(reader), nil
+}
+
+func (m *testStorage) openOffsets() []int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]int64(nil), m.opens...)
+}
+
+type testStorageHolder map[string]*testStorage
+
+func (m testStorageHolder) GetStorage(host string) karma8.Storage {
+	return m[host]
+}
+
+// newTestFile returns file of two parts stored on hosts a and b, every part has replica on the other host.
+func newTestFile() (*karma8.FileMeta, map[string][]byte, []byte) {
+	partData := map[string][]byte{
+		"part0": []byte("first part of the file|"),
+		"part1": []byte("second part of the file"),
+	}
+	fileMeta := &karma8.FileMeta{
+		Bucket: "bucket",
+		Name:   "file",
+		Parts: []*karma8.FilePart{
+			{Path: "part0", StorageURL: "a", Replicas: []string{"b"}, ContentLength: int64(len(partData["part0"]))},
+			{Path: "part1", StorageURL: "b", Replicas: []string{"a"}, ContentLength: int64(len(partData["part1"]))},
+		},
+	}
+	fileMeta.ContentLength = fileMeta.Parts[0].ContentLength + fileMeta.Parts[1].ContentLength
+	return fileMeta, partData, append(append([]byte(nil), partData["part0"]...), partData["part1"]...)
+}
+
+func readTestFile(
+	holder testStorageHolder,
+	fileMeta *karma8.FileMeta,
+	offset int64,
+	length int64,
+	options Options,
+) ([]byte, error) {
+	reader := newMultiStorageReader(
+		context.Background(),
+		fileMeta,
+		nil,
+		offset,
+		length,
+		holder,
+		newLatencyTracker(),
+		options,
+		zap.NewNop(),
+	)
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+func TestMultiStorageReaderFailover(t *testing.T) {
+	tests := []struct {
+		name         string
+		a            *testStorage
+		b            *testStorage
+		readAttempts int
+		offset       int64
+		length       int64
+		wantErr      error
+		wantOpensB   []int64
+	}{
+		{
+			name:         "healthy storages",
+			readAttempts: 2,
+			length:       -1,
+			wantOpensB:   []int64{0},
+		},
+		{
+			name:         "part is read from replica if storage fails",
+			a:            &testStorage{openErr: errTestRead},
+			readAttempts: 2,
+			length:       -1,
+			wantOpensB:   []int64{0, 0},
+		},
+		{
+			name:         "truncated read is resumed on replica from the same offset",
+			a:            &testStorage{truncate: 5},
+			readAttempts: 2,
+			length:       -1,
+			wantOpensB:   []int64{5, 0},
+		},
+		{
+			name:         "attempts are over",
+			a:            &testStorage{openErr: errTestRead},
+			b:            &testStorage{openErr: errTestRead},
+			readAttempts: 2,
+			length:       -1,
+			wantErr:      errTestRead,
+			wantOpensB:   []int64{0},
+		},
+		{
+			name:         "range starts in the second part",
+			a:            &testStorage{openErr: errTestRead},
+			readAttempts: 1,
+			offset:       30,
+			length:       10,
+			wantOpensB:   []int64{7},
+		},
+		{
+			name:         "range spans both parts",
+			readAttempts: 1,
+			offset:       20,
+			length:       10,
+			wantOpensB:   []int64{0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileMeta, partData, data := newTestFile()
+			holder := testStorageHolder{"a": test.a, "b": test.b}
+			for host, storage := range holder {
+				if storage == nil {
+					storage = &testStorage{}
+					holder[host] = storage
+				}
+				storage.data = partData
+			}
+
+			length := test.length
+			if length < 0 {
+				length = fileMeta.ContentLength
+			}
+
+			read, err := readTestFile(holder, fileMeta, test.offset, length, Options{ReadAttempts: test.readAttempts})
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("read error is %v, want %v", err, test.wantErr)
+			}
+			if opens := holder["b"].openOffsets(); !equalOffsets(opens, test.wantOpensB) {
+				t.Fatalf("storage b is opened at %v, want %v", opens, test.wantOpensB)
+			}
+			if test.wantErr != nil {
+				return
+			}
+
+			if want := data[test.offset : test.offset+length]; !bytes.Equal(read, want) {
+				t.Fatalf("read data is %q, want %q", read, want)
+			}
+		})
+	}
+}
+
+func equalOffsets(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,20 +1,63 @@
 package fileservice
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
 	"io"
 	"karma8"
+	"karma8/internal/compression"
+	"karma8/internal/encryption"
+	"karma8/internal/logging"
+	"karma8/internal/partcleaner"
+	"strconv"
+	"time"
 )
 
+// rollbackTimeout limits cleanup of failed upload, it's done with separate context because request one may be canceled.
+const rollbackTimeout = 30 * time.Second
+
+type Options struct {
+	// MinChunkSize is minimal size of the part, smaller files are split into fewer parts.
+	MinChunkSize int64
+	// HostSplitCount is maximal amount of parts of the file.
+	HostSplitCount int
+	// ReplicationFactor is amount of storages keeping every part, it's used if bucket doesn't override it.
+	ReplicationFactor int
+	// ReadAttempts limits attempts to read every part, failed read is resumed from another replica if there is any.
+	ReadAttempts int
+	// MaxBufferedPart is maximal size of the part buffered in memory during upload, bigger parts are streamed.
+	// Only buffered parts are deduplicated, because checksum must be known before upload.
+	MaxBufferedPart int64
+	// HedgePercentile of recent first data latencies is used as delay before reading replicated part from
+	// another replica, zero disables hedged reads.
+	HedgePercentile float64
+	// HedgeMinDelay is the lower bound of hedging delay, it's also used until there are enough latency samples.
+	HedgeMinDelay time.Duration
+	// DefaultTenantQuota limits bytes stored by every tenant without own quota in TenantQuotas, zero means unlimited.
+	DefaultTenantQuota int64
+	TenantQuotas       map[string]int64
+	// Encrypt makes parts of new files encrypted by data keys wrapped by the active master key of keyring.
+	// Encrypted parts aren't deduplicated, because every file has its own data key.
+	Encrypt bool
+}
+
 type fileService struct {
-	balancer        karma8.Balancer
+	balancer        karma8.FilteringBalancer
 	storageHolder   karma8.StorageHolder
 	fileMetaStorage karma8.FileMetaStorage
-	minChunkSize    int64
-	hostSplitCount  int
+	bucketStorage   karma8.BucketStorage
+	blobStorage     karma8.BlobStorage
+	cleaner         *partcleaner.Cleaner
+	keyring         *encryption.Keyring
+	options         Options
+	latency         *latencyTracker
 
 	logger *zap.Logger
 }
@@ -36,8 +79,8 @@ func (m *fileService) calculatePartsSize(total int64, splitCount int) []int64 {
 			partSize += 1
 		}
 
-		if partSize <= m.minChunkSize {
-			partSize = minInt64(remain, m.minChunkSize)
+		if partSize <= m.options.MinChunkSize {
+			partSize = minInt64(remain, m.options.MinChunkSize)
 		}
 
 		result = append(result, partSize)
@@ -49,152 +92,545 @@ func (m *fileService) calculatePartsSize(total int64, splitCount int) []int64 {
 	return result
 }
 
+func (m *fileService) replicationFactor(bucket *karma8.Bucket) int {
+	if bucket.ReplicationFactor > 0 {
+		return bucket.ReplicationFactor
+	}
+	return m.options.ReplicationFactor
+}
+
+func (m *fileService) tenantQuota(tenant string) int64 {
+	if quota, ok := m.options.TenantQuotas[tenant]; ok {
+		return quota
+	}
+	return m.options.DefaultTenantQuota
+}
+
+// checkQuota rejects upload which doesn't fit into the quota, zero quota means unlimited.
+func checkQuota(quota int64, contentLength int64, getUsage func() (int64, error), exceeded error) error {
+	if quota <= 0 {
+		return nil
+	}
+	if contentLength > quota {
+		return fmt.Errorf("%w: %s", karma8.ErrFileTooLarge, exceeded)
+	}
+
+	usage, err := getUsage()
+	if err != nil {
+		return err
+	}
+	if usage+contentLength > quota {
+		return fmt.Errorf("%w: used %d of %d bytes", exceeded, usage, quota)
+	}
+	return nil
+}
+
+// checkQuotas rejects upload which doesn't fit into bucket or tenant quota before data is sent to storages.
+// NOTE: Usage includes processing files, so concurrent uploads can't overcommit the quota much,
+// bucket and tenant quotas are enforced exactly on completion.
+func (m *fileService) checkQuotas(ctx context.Context, bucket *karma8.Bucket, fileMeta *karma8.FileMeta) error {
+	err := checkQuota(
+		bucket.QuotaBytes,
+		fileMeta.ContentLength,
+		func() (int64, error) {
+			return m.bucketStorage.GetBucketUsage(ctx, bucket.Name)
+		},
+		karma8.ErrBucketQuotaExceeded,
+	)
+	if err != nil {
+		return err
+	}
+
+	return checkQuota(
+		m.tenantQuota(fileMeta.Tenant),
+		fileMeta.ContentLength,
+		func() (int64, error) {
+			return m.fileMetaStorage.GetTenantUsage(ctx, fileMeta.Tenant)
+		},
+		karma8.ErrTenantQuotaExceeded,
+	)
+}
+
 func (m *fileService) calculateFileParts(
 	hosts []string,
+	bucket *karma8.Bucket,
 	fileMeta *karma8.FileMeta,
 	partSizes []int64,
+	replicationFactor int,
 ) []*karma8.FilePart {
+	// NOTE: Every upload has its own path, so failed or concurrent upload can't touch data of the existing file.
+	partPath := fileMeta.Bucket + "/" + fileMeta.Name + "/" + uuid.New().String()
+
 	var fileParts []*karma8.FilePart
 	for i, partSize := range partSizes {
+		path := partPath
+		// NOTE: Part may become a blob moved independently of the file, so it must not share path with other parts.
+		if bucket.Dedup {
+			path += "/" + strconv.Itoa(i)
+		}
+
+		partHosts := hosts[i*replicationFactor : (i+1)*replicationFactor]
 		fileParts = append(fileParts, &karma8.FilePart{
-			StorageURL:    hosts[i],
-			Path:          fileMeta.Name,
+			StorageURL:    partHosts[0],
+			Path:          path,
 			ContentLength: partSize,
+			Replicas:      partHosts[1:],
+			Codec:         bucket.Compression,
 		})
 	}
 	return fileParts
 }
 
-func (m *fileService) PutFile(ctx context.Context, file *karma8.File) error {
-	partSizes := m.calculatePartsSize(file.Meta.ContentLength, m.hostSplitCount)
+// uploadFilePart uploads the same data to all part locations at once and calculates part checksum.
+// Data is compressed with the part codec and then encrypted if there is part cipher,
+// checksum is calculated over data as it's stored.
+func (m *fileService) uploadFilePart(
+	ctx context.Context,
+	bucket *karma8.Bucket,
+	filePart *karma8.FilePart,
+	partCipher *encryption.PartCipher,
+	body io.Reader,
+) error {
+	if filePart.ContentLength <= m.options.MaxBufferedPart {
+		return m.uploadBufferedFilePart(ctx, bucket, filePart, partCipher, body)
+	}
+	return m.streamFilePart(ctx, filePart, partCipher, body)
+}
 
-	hosts, err := m.balancer.GetHosts(ctx, len(partSizes))
-	if err != nil {
-		m.logger.Error("can't get hosts from balancer", zap.Error(err))
-		return fmt.Errorf("get hosts error: %w", err)
+// uploadBufferedFilePart reads the whole part into memory, so storage could retry upload with seekable body.
+// In buckets with deduplication part refers to the existing blob with the same content instead of upload.
+func (m *fileService) uploadBufferedFilePart(
+	ctx context.Context,
+	bucket *karma8.Bucket,
+	filePart *karma8.FilePart,
+	partCipher *encryption.PartCipher,
+	body io.Reader,
+) error {
+	data := make([]byte, filePart.ContentLength)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return err
 	}
 
-	fileParts := m.calculateFileParts(hosts, file.Meta, partSizes)
-	file.Meta.Parts = fileParts
+	if filePart.Codec != "" {
+		compressed, err := compression.Compress(filePart.Codec, data)
+		if err != nil {
+			return fmt.Errorf("can't compress part: %w", err)
+		}
 
-	if err := m.fileMetaStorage.PutProcessingFileMeta(ctx, file.Meta); err != nil {
-		m.logger.Error("can't put processing file meta", zap.Error(err))
-		return fmt.Errorf("can't put processing file meta: %w", err)
+		// NOTE: Incompressible data is stored as is, so it doesn't grow and isn't decompressed on read.
+		if int64(len(compressed)) < filePart.ContentLength {
+			data = compressed
+			filePart.StoredLength = int64(len(compressed))
+		} else {
+			filePart.Codec = ""
+		}
 	}
 
-	for _, filePart := range fileParts {
-		body := io.LimitReader(file.Body, filePart.ContentLength)
-		storage := m.storageHolder.GetStorage(filePart.StorageURL)
-		if err := storage.UploadFilePart(ctx, filePart.Path, body); err != nil {
-			m.logger.Error("can't upload file part", zap.Error(err))
-			return fmt.Errorf("can't upload file part: %w", err)
-		}
+	if partCipher != nil {
+		data = partCipher.Seal(data)
+		filePart.StoredLength = int64(len(data))
 	}
 
-	if err := m.fileMetaStorage.CompleteFileMeta(ctx, file.Meta.Name); err != nil {
-		m.logger.Error("can't complete file meta", zap.Error(err))
-		return fmt.Errorf("can't complete file meta: %w", err)
+	checksum := sha256.Sum256(data)
+	filePart.Checksum = hex.EncodeToString(checksum[:])
+
+	// NOTE: Encrypted part can't be shared, it's readable only with data key of the file.
+	dedup := bucket.Dedup && partCipher == nil
+	if dedup && m.adoptBlob(ctx, bucket, filePart) {
+		return nil
+	}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	for _, location := range filePart.Locations() {
+		storage := m.storageHolder.GetStorage(location)
+		group.Go(func() error {
+			return storage.UploadFilePart(groupCtx, filePart.Path, bytes.NewReader(data))
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+
+	if dedup {
+		m.registerBlob(ctx, bucket, filePart)
 	}
 
 	return nil
 }
 
-type multiStorageReader struct {
-	fileMeta         *karma8.FileMeta
-	storageHolder    karma8.StorageHolder
-	currentPartIndex int
-	currentBody      io.ReadCloser
-	ctx              context.Context
+// adoptBlob makes part refer to the blob with the same checksum if there is one.
+// NOTE: Deduplication is best effort, part is uploaded as usual if blob can't be found.
+func (m *fileService) adoptBlob(ctx context.Context, bucket *karma8.Bucket, filePart *karma8.FilePart) bool {
+	blob, err := m.blobStorage.FindBlob(ctx, bucket.Name, filePart.Checksum)
+	if errors.Is(err, karma8.ErrBlobNotFound) {
+		return false
+	}
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Warn("can't find blob", zap.Error(err))
+		return false
+	}
+	if blob.Part.ContentLength != filePart.ContentLength || blob.Part.Codec != filePart.Codec {
+		return false
+	}
+
+	filePart.StorageURL = blob.Part.StorageURL
+	filePart.Path = blob.Part.Path
+	filePart.Replicas = append([]string(nil), blob.Part.Replicas...)
+	filePart.StoredLength = blob.Part.StoredLength
+	filePart.Shared = true
+	return true
+}
+
+// registerBlob makes just uploaded part a blob, so next uploads with the same content could refer to it.
+// Part stays owned by the file if another blob with the same checksum was registered meanwhile.
+func (m *fileService) registerBlob(ctx context.Context, bucket *karma8.Bucket, filePart *karma8.FilePart) {
+	blobPart := *filePart
+	blobPart.Shared = true
+
+	ok, err := m.blobStorage.PutBlob(ctx, &karma8.Blob{Bucket: bucket.Name, Part: &blobPart})
+	if err != nil {
+		logging.FromContext(ctx, m.logger).Warn("can't register blob", zap.Error(err))
+		return
+	}
+	filePart.Shared = ok
 }
 
-func (m *multiStorageReader) moveToNextStorage() error {
-	if m.currentPartIndex >= len(m.fileMeta.Parts) {
-		return io.EOF
+// streamFilePart passes data to all locations through pipes without buffering, such upload can't be retried.
+func (m *fileService) streamFilePart(
+	ctx context.Context,
+	filePart *karma8.FilePart,
+	partCipher *encryption.PartCipher,
+	body io.Reader,
+) error {
+	group, groupCtx := errgroup.WithContext(ctx)
+
+	locations := filePart.Locations()
+	writers := make([]io.Writer, 0, len(locations))
+	pipeWriters := make([]*io.PipeWriter, 0, len(locations))
+	for _, location := range locations {
+		pipeReader, pipeWriter := io.Pipe()
+		writers = append(writers, pipeWriter)
+		pipeWriters = append(pipeWriters, pipeWriter)
+
+		storage := m.storageHolder.GetStorage(location)
+		group.Go(func() error {
+			err := storage.UploadFilePart(groupCtx, filePart.Path, pipeReader)
+			// NOTE: Unblock writer in case storage stopped reading.
+			_ = pipeReader.CloseWithError(err)
+			return err
+		})
 	}
 
-	part := m.fileMeta.Parts[m.currentPartIndex]
-	storage := m.storageHolder.GetStorage(part.StorageURL)
+	hasher := sha256.New()
+	counter := &countingWriter{}
+	written, err := copyEncoded(filePart.Codec, partCipher, io.MultiWriter(append(writers, hasher, counter)...), body)
+	if err == nil && written != filePart.ContentLength {
+		err = io.ErrUnexpectedEOF
+	}
+	for _, pipeWriter := range pipeWriters {
+		_ = pipeWriter.CloseWithError(err)
+	}
 
-	body, err := storage.ReadFilePart(m.ctx, part.Path)
+	if groupErr := group.Wait(); groupErr != nil {
+		return groupErr
+	}
 	if err != nil {
-		m.currentBody = nil
 		return err
 	}
 
-	m.currentBody = body
-
-	m.currentPartIndex++
+	filePart.Checksum = hex.EncodeToString(hasher.Sum(nil))
+	if filePart.Codec != "" || partCipher != nil {
+		filePart.StoredLength = counter.written
+	}
 
 	return nil
 }
 
-func (m *multiStorageReader) Read(p []byte) (int, error) {
-	if m.currentBody == nil {
-		if err := m.moveToNextStorage(); err != nil {
-			return 0, err
-		}
-	}
+type countingWriter struct {
+	written int64
+}
 
-	n, err := m.currentBody.Read(p)
+func (m *countingWriter) Write(p []byte) (int, error) {
+	m.written += int64(len(p))
+	return len(p), nil
+}
+
+// copyEncoded compresses and encrypts data of src into dst and returns amount of bytes read from src.
+func copyEncoded(codec string, partCipher *encryption.PartCipher, dst io.Writer, src io.Reader) (int64, error) {
+	// NOTE: Writers are closed in reverse order, so compressor flushes data before the last chunk is sealed.
+	var closers []io.Closer
+	if partCipher != nil {
+		sealer := partCipher.NewWriter(dst)
+		closers = append(closers, sealer)
+		dst = sealer
+	}
+	compressor, err := compression.NewWriter(codec, dst)
 	if err != nil {
-		if !errors.Is(err, io.EOF) {
-			return n, err
+		return 0, err
+	}
+	closers = append(closers, compressor)
+
+	written, err := io.Copy(compressor, src)
+	for i := len(closers) - 1; i >= 0; i-- {
+		if closeErr := closers[i].Close(); err == nil {
+			err = closeErr
 		}
+	}
+	return written, err
+}
 
-		if err := m.currentBody.Close(); err != nil {
-			return n, err
+// newDataKey sets encryption of the uploaded file and returns its data key, nil is returned if file isn't encrypted.
+// Key provided by the client takes precedence over master key.
+func (m *fileService) newDataKey(file *karma8.File) ([]byte, error) {
+	if file.CustomerKey != nil {
+		dataKey, fileEncryption, err := encryption.NewCustomerDataKey(file.CustomerKey)
+		if err != nil {
+			return nil, err
 		}
+		file.Meta.Encryption = fileEncryption
+		return dataKey, nil
+	}
+
+	if !m.options.Encrypt {
+		return nil, nil
+	}
+	dataKey, fileEncryption, err := m.keyring.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	file.Meta.Encryption = fileEncryption
+	return dataKey, nil
+}
 
-		if err := m.moveToNextStorage(); err != nil {
-			return n, err
+// unwrapDataKey returns nil if file isn't encrypted, customer key must be provided only for files encrypted with it.
+func (m *fileService) unwrapDataKey(fileEncryption *karma8.FileEncryption, customerKey []byte) ([]byte, error) {
+	if fileEncryption == nil || fileEncryption.CustomerKeyFingerprint == "" {
+		if customerKey != nil {
+			return nil, karma8.ErrCustomerKeyMismatch
+		}
+		if fileEncryption == nil {
+			return nil, nil
 		}
+		return m.keyring.UnwrapDataKey(fileEncryption)
+	}
+
+	if customerKey == nil {
+		return nil, karma8.ErrCustomerKeyRequired
+	}
+	return encryption.UnwrapCustomerDataKey(customerKey, fileEncryption)
+}
+
+// newPartCipher returns nil if file isn't encrypted.
+func newPartCipher(dataKey []byte, partIndex int) (*encryption.PartCipher, error) {
+	if dataKey == nil {
+		return nil, nil
+	}
+	return encryption.NewPartCipher(dataKey, partIndex)
+}
+
+func (m *fileService) rollback(requestCtx context.Context, fileMeta *karma8.FileMeta) {
+	logger := logging.FromContext(requestCtx, m.logger)
 
-		return n, nil
+	ctx, cancel := context.WithTimeout(logging.WithLogger(context.Background(), logger), rollbackTimeout)
+	defer cancel()
+
+	if err := m.cleaner.CleanProcessingFile(ctx, fileMeta); err != nil {
+		logger.Error("can't rollback failed upload", zap.String("filename", fileMeta.Name), zap.Error(err))
+		return
 	}
 
-	return n, nil
+	logger.Info("failed upload rolled back", zap.String("filename", fileMeta.Name))
 }
 
-func (m *multiStorageReader) Close() error {
-	if m.currentBody != nil {
-		return m.currentBody.Close()
+func (m *fileService) PutFile(ctx context.Context, file *karma8.File) (err error) {
+	logger := logging.FromContext(ctx, m.logger)
+
+	bucket, err := m.bucketStorage.GetBucket(ctx, file.Meta.Bucket)
+	if err != nil {
+		return fmt.Errorf("can't get bucket: %w", err)
+	}
+
+	// NOTE: Files are never overwritten, so upload of the existing file is rejected before its parts are uploaded.
+	// Meta storage checks it again on completion.
+	_, err = m.fileMetaStorage.GetFileMeta(ctx, file.Meta.Bucket, file.Meta.Name)
+	if err == nil {
+		logger.Warn("upload of existing file rejected")
+		return karma8.ErrFileAlreadyExists
 	}
+	if !errors.Is(err, karma8.ErrFileNotFound) {
+		logger.Error("can't get file meta", zap.Error(err))
+		return fmt.Errorf("can't get file meta: %w", err)
+	}
+
+	if err := m.checkQuotas(ctx, bucket, file.Meta); err != nil {
+		logger.Warn("upload rejected by quota", zap.String("tenant", file.Meta.Tenant), zap.Error(err))
+		return err
+	}
+
+	partSizes := m.calculatePartsSize(file.Meta.ContentLength, m.options.HostSplitCount)
+	replicationFactor := m.replicationFactor(bucket)
+
+	hosts, err := m.balancer.GetAllowedHosts(ctx, len(partSizes)*replicationFactor, bucket.AllowedHosts)
+	if err != nil {
+		logger.Error("can't get hosts from balancer", zap.Error(err))
+		return fmt.Errorf("get hosts error: %w", err)
+	}
+
+	fileParts := m.calculateFileParts(hosts, bucket, file.Meta, partSizes, replicationFactor)
+	file.Meta.Parts = fileParts
+
+	dataKey, err := m.newDataKey(file)
+	if err != nil {
+		logger.Error("can't generate data key", zap.Error(err))
+		return fmt.Errorf("can't generate data key: %w", err)
+	}
+
+	if err := m.fileMetaStorage.PutProcessingFileMeta(ctx, file.Meta); err != nil {
+		logger.Error("can't put processing file meta", zap.Error(err))
+		return fmt.Errorf("can't put processing file meta: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			m.rollback(ctx, file.Meta)
+		}
+	}()
+
+	for i, filePart := range fileParts {
+		partCipher, err := newPartCipher(dataKey, i)
+		if err != nil {
+			return fmt.Errorf("can't create part cipher: %w", err)
+		}
+
+		body := io.LimitReader(file.Body, filePart.ContentLength)
+		if err := m.uploadFilePart(ctx, bucket, filePart, partCipher, body); err != nil {
+			logger.Error("can't upload file part", zap.Error(err))
+			return fmt.Errorf("can't upload file part: %w", err)
+		}
+	}
+
+	if err := m.fileMetaStorage.CompleteFileMeta(ctx, file.Meta, m.tenantQuota(file.Meta.Tenant)); err != nil {
+		if errors.Is(err, karma8.ErrTenantQuotaExceeded) || errors.Is(err, karma8.ErrBucketQuotaExceeded) {
+			logger.Warn("upload rejected by quota", zap.String("tenant", file.Meta.Tenant), zap.Error(err))
+			return err
+		}
+		if errors.Is(err, karma8.ErrFileAlreadyExists) {
+			logger.Warn("upload of existing file rejected")
+			return err
+		}
+		logger.Error("can't complete file meta", zap.Error(err))
+		return fmt.Errorf("can't complete file meta: %w", err)
+	}
+
 	return nil
 }
 
-func (m *fileService) GetFile(ctx context.Context, filename string) (*karma8.File, error) {
-	m.logger.Info("start get file request", zap.String("filename", filename))
+func (m *fileService) GetFile(
+	ctx context.Context,
+	bucketName string,
+	filename string,
+	customerKey []byte,
+	byteRange *karma8.ByteRange,
+) (*karma8.File, error) {
+	logger := logging.FromContext(ctx, m.logger)
+
+	logger.Info("start get file request", zap.String("bucket", bucketName), zap.String("filename", filename))
 
-	fileMeta, err := m.fileMetaStorage.GetFileMeta(ctx, filename)
+	bucket, err := m.bucketStorage.GetBucket(ctx, bucketName)
 	if err != nil {
-		m.logger.Error("can't get file meta", zap.Error(err))
+		return nil, fmt.Errorf("can't get bucket: %w", err)
+	}
+
+	fileMeta, err := m.fileMetaStorage.GetFileMeta(ctx, bucketName, filename)
+	if err != nil {
+		logger.Error("can't get file meta", zap.Error(err))
 		return nil, fmt.Errorf("can't get file meta: %w", err)
 	}
 
+	// NOTE: Expired file may be still kept until it's deleted in background.
+	if fileMeta.IsExpired(bucket, time.Now()) {
+		return nil, karma8.ErrFileNotFound
+	}
+
+	dataKey, err := m.unwrapDataKey(fileMeta.Encryption, customerKey)
+	if errors.Is(err, karma8.ErrCustomerKeyRequired) || errors.Is(err, karma8.ErrCustomerKeyMismatch) {
+		logger.Warn("get file rejected", zap.Error(err))
+		return nil, err
+	}
+	if err != nil {
+		logger.Error("can't unwrap data key", zap.Error(err))
+		return nil, fmt.Errorf("can't unwrap data key: %w", err)
+	}
+
+	offset, length := int64(0), fileMeta.ContentLength
+	if byteRange != nil {
+		offset, length, err = byteRange.Resolve(fileMeta.ContentLength)
+		if err != nil {
+			logger.Warn("get file rejected", zap.Error(err))
+			return nil, err
+		}
+	}
+
 	return &karma8.File{
 		Meta: fileMeta,
-		Body: &multiStorageReader{
-			fileMeta:      fileMeta,
-			storageHolder: m.storageHolder,
-			ctx:           ctx,
-		},
+		Body: newMultiStorageReader(
+			ctx,
+			fileMeta,
+			dataKey,
+			offset,
+			length,
+			m.storageHolder,
+			m.latency,
+			m.options,
+			logger,
+		),
+		Offset: offset,
+		Length: length,
 	}, nil
 }
 
+func (m *fileService) DeleteFile(ctx context.Context, bucketName string, filename string) error {
+	logger := logging.FromContext(ctx, m.logger)
+
+	logger.Info("start delete file request", zap.String("bucket", bucketName), zap.String("filename", filename))
+
+	// NOTE: Parts are kept, so the file could be restored until the purge job deletes them.
+	if err := m.fileMetaStorage.DeleteFileMeta(ctx, karma8.FileKey{Bucket: bucketName, Name: filename}); err != nil {
+		logger.Error("can't delete file meta", zap.Error(err))
+		return fmt.Errorf("can't delete file meta: %w", err)
+	}
+
+	return nil
+}
+
 func New(
-	balancer karma8.Balancer,
+	balancer karma8.FilteringBalancer,
 	storageHolder karma8.StorageHolder,
 	fileMetaStorage karma8.FileMetaStorage,
-	minChunkSize int64,
-	hostSplitCount int,
+	bucketStorage karma8.BucketStorage,
+	blobStorage karma8.BlobStorage,
+	cleaner *partcleaner.Cleaner,
+	keyring *encryption.Keyring,
+	options Options,
 	logger *zap.Logger,
 ) karma8.FileService {
+	if options.ReplicationFactor < 1 {
+		options.ReplicationFactor = 1
+	}
+	if options.ReadAttempts < 1 {
+		options.ReadAttempts = 1
+	}
+
 	return &fileService{
 		balancer:        balancer,
 		storageHolder:   storageHolder,
 		fileMetaStorage: fileMetaStorage,
-		minChunkSize:    minChunkSize,
-		hostSplitCount:  hostSplitCount,
+		bucketStorage:   bucketStorage,
+		blobStorage:     blobStorage,
+		cleaner:         cleaner,
+		keyring:         keyring,
+		options:         options,
+		latency:         newLatencyTracker(),
 		logger:          logger,
 	}
 }
@@ -0,0 +1,102 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"karma8"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrShuttingDown = errors.New("shutting down")
+
+type Options struct {
+	// Hosts are storages checked by readiness probe.
+	Hosts []string
+	// MinHealthyStorages is minimal amount of reachable storages required to serve requests.
+	MinHealthyStorages int
+	// CheckTimeout limits every dependency check.
+	CheckTimeout time.Duration
+}
+
+// Checker checks dependencies of the service, it reports not ready since the start of graceful shutdown,
+// so load balancers stop sending new requests before the server stops accepting them.
+type Checker struct {
+	db            *sqlx.DB
+	storageHolder karma8.StorageHolder
+	options       Options
+	shuttingDown  int32
+
+	logger *zap.Logger
+}
+
+// StartShutdown makes readiness fail until process exit.
+func (m *Checker) StartShutdown() {
+	atomic.StoreInt32(&m.shuttingDown, 1)
+}
+
+func (m *Checker) checkStorages(ctx context.Context) error {
+	var (
+		healthy int
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+	)
+	for _, host := range m.options.Hosts {
+		host := host
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := m.storageHolder.GetStorage(host).Ping(ctx); err != nil {
+				m.logger.Warn("storage is unhealthy", zap.String("storage_url", host), zap.Error(err))
+				return
+			}
+
+			mutex.Lock()
+			healthy++
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if healthy < m.options.MinHealthyStorages {
+		return fmt.Errorf("healthy storages %d, required %d", healthy, m.options.MinHealthyStorages)
+	}
+	return nil
+}
+
+func (m *Checker) CheckReadiness(ctx context.Context) error {
+	if atomic.LoadInt32(&m.shuttingDown) == 1 {
+		return ErrShuttingDown
+	}
+
+	if m.options.CheckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.options.CheckTimeout)
+		defer cancel()
+	}
+
+	if err := m.db.PingContext(ctx); err != nil {
+		m.logger.Warn("pg is unhealthy", zap.Error(err))
+		return fmt.Errorf("pg ping error: %w", err)
+	}
+
+	if err := m.checkStorages(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func NewChecker(db *sqlx.DB, storageHolder karma8.StorageHolder, options Options, logger *zap.Logger) *Checker {
+	return &Checker{
+		db:            db,
+		storageHolder: storageHolder,
+		options:       options,
+		logger:        logger,
+	}
+}
@@ -0,0 +1,257 @@
+package janitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/job"
+	"karma8/internal/partcleaner"
+	"time"
+)
+
+const jobName = "janitor"
+
+type Options struct {
+	// Interval between janitor passes.
+	Interval time.Duration
+	// GracePeriod protects recently uploaded parts, whose meta may be not written yet.
+	// Processing files older than GracePeriod are considered abandoned.
+	GracePeriod time.Duration
+	// BatchSize is amount of abandoned uploads and recorded orphans processed per pass.
+	BatchSize int
+}
+
+// Janitor deletes parts which are kept on storages, but aren't referenced by any file meta:
+// parts of abandoned uploads, blobs without references, parts recorded by failed cleanups
+// and unknown parts found in storage inventory.
+type Janitor struct {
+	hosts           []string
+	storageHolder   karma8.StorageHolder
+	fileMetaStorage karma8.FileMetaStorage
+	orphanStorage   karma8.OrphanStorage
+	blobStorage     karma8.BlobStorage
+	cleaner         *partcleaner.Cleaner
+	jobLocker       karma8.JobLocker
+	options         Options
+
+	logger *zap.Logger
+}
+
+func (m *Janitor) Run(ctx context.Context) error {
+	return job.RunExclusively(ctx, jobName, m.jobLocker, m.options.Interval, m.RunOnce, m.logger)
+}
+
+func (m *Janitor) RunOnce(ctx context.Context) error {
+	if err := m.cleanAbandonedUploads(ctx); err != nil {
+		return err
+	}
+
+	if err := m.deleteGarbageBlobs(ctx); err != nil {
+		return err
+	}
+
+	if err := m.deleteRecordedOrphans(ctx); err != nil {
+		return err
+	}
+
+	for _, host := range m.hosts {
+		if err := m.collectHost(ctx, host); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			m.logger.Error("can't collect orphan parts", zap.String("storage_url", host), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func (m *Janitor) cleanAbandonedUploads(ctx context.Context) error {
+	fileMetas, err := m.fileMetaStorage.ListStaleProcessingFileMetas(
+		ctx,
+		time.Now().Add(-m.options.GracePeriod),
+		m.options.BatchSize,
+	)
+	if err != nil {
+		return fmt.Errorf("can't list stale processing files: %w", err)
+	}
+
+	for _, fileMeta := range fileMetas {
+		if err := m.cleaner.CleanProcessingFile(ctx, fileMeta); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			m.logger.Error(
+				"can't clean abandoned upload",
+				zap.String("bucket", fileMeta.Bucket),
+				zap.String("filename", fileMeta.Name),
+				zap.Error(err),
+			)
+			continue
+		}
+		m.logger.Info(
+			"abandoned upload cleaned",
+			zap.String("bucket", fileMeta.Bucket),
+			zap.String("filename", fileMeta.Name),
+		)
+	}
+
+	return nil
+}
+
+// deleteGarbageBlobs deletes blobs which have no references for longer than GracePeriod.
+// NOTE: Blob is registered before the first file refers to it, grace period protects uploads in progress.
+func (m *Janitor) deleteGarbageBlobs(ctx context.Context) error {
+	blobs, err := m.blobStorage.ListGarbageBlobs(ctx, time.Now().Add(-m.options.GracePeriod), m.options.BatchSize)
+	if err != nil {
+		return fmt.Errorf("can't list garbage blobs: %w", err)
+	}
+
+	for _, blob := range blobs {
+		// NOTE: Meta goes first, so nobody can refer to the blob once its data is being deleted.
+		err := m.blobStorage.DeleteGarbageBlob(ctx, blob)
+		if errors.Is(err, karma8.ErrBlobNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("can't delete garbage blob: %w", err)
+		}
+
+		if err := m.cleaner.DeleteBlob(ctx, blob); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			m.logger.Error(
+				"can't delete garbage blob data",
+				zap.String("bucket", blob.Bucket),
+				zap.String("checksum", blob.Part.Checksum),
+				zap.Error(err),
+			)
+			continue
+		}
+		m.logger.Info(
+			"garbage blob deleted",
+			zap.String("bucket", blob.Bucket),
+			zap.String("checksum", blob.Part.Checksum),
+		)
+	}
+
+	return nil
+}
+
+func (m *Janitor) deleteRecordedOrphans(ctx context.Context) error {
+	orphans, err := m.orphanStorage.ListOrphanFileParts(ctx, m.options.BatchSize)
+	if err != nil {
+		return fmt.Errorf("can't list orphan file parts: %w", err)
+	}
+
+	hostToOrphans := map[string][]*karma8.OrphanFilePart{}
+	for _, orphan := range orphans {
+		hostToOrphans[orphan.StorageURL] = append(hostToOrphans[orphan.StorageURL], orphan)
+	}
+
+	for host, hostOrphans := range hostToOrphans {
+		// NOTE: Cleanup may record parts of upload which was completed after all, they must be kept.
+		referencedPaths, err := m.fileMetaStorage.GetReferencedPaths(ctx, host)
+		if err != nil {
+			return fmt.Errorf("can't get referenced paths: %w", err)
+		}
+
+		storage := m.storageHolder.GetStorage(host)
+		for _, orphan := range hostOrphans {
+			if _, ok := referencedPaths[orphan.Path]; !ok {
+				if err := storage.DeleteFilePart(ctx, orphan.Path); err != nil {
+					m.logger.Error(
+						"can't delete orphan part",
+						zap.String("storage_url", host),
+						zap.String("path", orphan.Path),
+						zap.Error(err),
+					)
+					continue
+				}
+			}
+
+			if err := m.orphanStorage.DeleteOrphanFilePart(ctx, orphan); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *Janitor) collectHost(ctx context.Context, host string) error {
+	storage := m.storageHolder.GetStorage(host)
+
+	// NOTE: Inventory must be listed before meta, so parts uploaded in between are either referenced or fresh.
+	storedParts, err := storage.ListFileParts(ctx)
+	if err != nil {
+		return fmt.Errorf("can't list file parts: %w", err)
+	}
+
+	referencedPaths, err := m.fileMetaStorage.GetReferencedPaths(ctx, host)
+	if err != nil {
+		return fmt.Errorf("can't get referenced paths: %w", err)
+	}
+
+	deadline := time.Now().Add(-m.options.GracePeriod)
+	var deleted int
+	var deletedBytes int64
+	for _, storedPart := range storedParts {
+		if _, ok := referencedPaths[storedPart.Path]; ok {
+			continue
+		}
+		if storedPart.ModifyTime.After(deadline) {
+			continue
+		}
+
+		if err := storage.DeleteFilePart(ctx, storedPart.Path); err != nil {
+			m.logger.Error(
+				"can't delete orphan part",
+				zap.String("storage_url", host),
+				zap.String("path", storedPart.Path),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		deleted++
+		deletedBytes += storedPart.Size
+	}
+
+	if deleted > 0 {
+		m.logger.Info(
+			"orphan parts deleted",
+			zap.String("storage_url", host),
+			zap.Int("count", deleted),
+			zap.Int64("bytes", deletedBytes),
+		)
+	}
+
+	return nil
+}
+
+func New(
+	hosts []string,
+	storageHolder karma8.StorageHolder,
+	fileMetaStorage karma8.FileMetaStorage,
+	orphanStorage karma8.OrphanStorage,
+	blobStorage karma8.BlobStorage,
+	cleaner *partcleaner.Cleaner,
+	jobLocker karma8.JobLocker,
+	options Options,
+	logger *zap.Logger,
+) *Janitor {
+	return &Janitor{
+		hosts:           hosts,
+		storageHolder:   storageHolder,
+		fileMetaStorage: fileMetaStorage,
+		orphanStorage:   orphanStorage,
+		blobStorage:     blobStorage,
+		cleaner:         cleaner,
+		jobLocker:       jobLocker,
+		options:         options,
+		logger:          logger.With(zap.String("job", jobName)),
+	}
+}
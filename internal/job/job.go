@@ -0,0 +1,77 @@
+package job
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"karma8"
+	"time"
+)
+
+// RunPeriodically calls run right away and then every interval until ctx is done.
+// Errors of run are logged, so one failed pass doesn't stop the job.
+func RunPeriodically(ctx context.Context, interval time.Duration, run func(ctx context.Context) error, logger *zap.Logger) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := run(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Error("job pass failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunExclusively is like RunPeriodically, but the pass is skipped while the job is run by another instance.
+func RunExclusively(
+	ctx context.Context,
+	name string,
+	locker karma8.JobLocker,
+	interval time.Duration,
+	run func(ctx context.Context) error,
+	logger *zap.Logger,
+) error {
+	return RunPeriodically(ctx, interval, func(ctx context.Context) error {
+		unlock, locked, err := locker.TryLockJob(ctx, name)
+		if err != nil {
+			return err
+		}
+		if !locked {
+			logger.Debug("job pass skipped, job is run by another instance")
+			return nil
+		}
+		defer unlock()
+
+		return run(ctx)
+	}, logger)
+}
+
+// Throttle sleeps long enough to keep processing of size bytes, which already took spent, within maxBytesPerSecond.
+// Zero maxBytesPerSecond means no limit.
+func Throttle(ctx context.Context, size int64, spent time.Duration, maxBytesPerSecond int64) error {
+	if maxBytesPerSecond <= 0 {
+		return nil
+	}
+
+	wait := time.Duration(float64(size)/float64(maxBytesPerSecond)*float64(time.Second)) - spent
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"context"
+	"go.uber.org/zap"
+)
+
+// HeaderRequestID is passed by clients and propagated to storages to correlate logs of the request.
+const HeaderRequestID = "X-Request-ID"
+
+type loggerKey struct{}
+
+type requestIDKey struct{}
+
+// WithLogger attaches request-scoped logger to the context.
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns request-scoped logger or fallback if there is no request in the context, e.g. in background jobs.
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns empty string if there is no request in the context.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"context"
+	"karma8"
+)
+
+type balancer struct {
+	balancer karma8.FilteringBalancer
+}
+
+func countSelected(hosts []string) {
+	for _, host := range hosts {
+		balancerSelectedHosts.WithLabelValues(host).Inc()
+	}
+}
+
+func (m *balancer) GetHosts(ctx context.Context, count int) ([]string, error) {
+	hosts, err := m.balancer.GetHosts(ctx, count)
+	if err != nil {
+		return nil, err
+	}
+
+	countSelected(hosts)
+	return hosts, nil
+}
+
+func (m *balancer) GetAllowedHosts(ctx context.Context, count int, allowed []string) ([]string, error) {
+	hosts, err := m.balancer.GetAllowedHosts(ctx, count, allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	countSelected(hosts)
+	return hosts, nil
+}
+
+func NewBalancer(b karma8.FilteringBalancer) karma8.FilteringBalancer {
+	return &balancer{
+		balancer: b,
+	}
+}
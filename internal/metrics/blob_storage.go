@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"context"
+	"karma8"
+	"time"
+)
+
+type blobStorage struct {
+	storage karma8.BlobStorage
+}
+
+func (m *blobStorage) FindBlob(ctx context.Context, bucket string, checksum string) (blob *karma8.Blob, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "find_blob", err)
+	}(time.Now())
+
+	return m.storage.FindBlob(ctx, bucket, checksum)
+}
+
+func (m *blobStorage) PutBlob(ctx context.Context, blob *karma8.Blob) (created bool, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "put_blob", err)
+	}(time.Now())
+
+	return m.storage.PutBlob(ctx, blob)
+}
+
+func (m *blobStorage) ListGarbageBlobs(
+	ctx context.Context,
+	before time.Time,
+	limit int,
+) (blobs []*karma8.Blob, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_garbage_blobs", err)
+	}(time.Now())
+
+	return m.storage.ListGarbageBlobs(ctx, before, limit)
+}
+
+func (m *blobStorage) DeleteGarbageBlob(ctx context.Context, blob *karma8.Blob) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "delete_garbage_blob", err)
+	}(time.Now())
+
+	return m.storage.DeleteGarbageBlob(ctx, blob)
+}
+
+func NewBlobStorage(storage karma8.BlobStorage) karma8.BlobStorage {
+	return &blobStorage{
+		storage: storage,
+	}
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"karma8"
+	"time"
+)
+
+type bucketStorage struct {
+	storage karma8.BucketStorage
+}
+
+func (m *bucketStorage) GetBucket(ctx context.Context, name string) (bucket *karma8.Bucket, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "get_bucket", err)
+	}(time.Now())
+
+	return m.storage.GetBucket(ctx, name)
+}
+
+func (m *bucketStorage) ListBuckets(ctx context.Context) (buckets []*karma8.Bucket, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_buckets", err)
+	}(time.Now())
+
+	return m.storage.ListBuckets(ctx)
+}
+
+func (m *bucketStorage) PutBucket(ctx context.Context, bucket *karma8.Bucket) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "put_bucket", err)
+	}(time.Now())
+
+	return m.storage.PutBucket(ctx, bucket)
+}
+
+func (m *bucketStorage) GetBucketUsage(ctx context.Context, name string) (usage int64, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "get_bucket_usage", err)
+	}(time.Now())
+
+	return m.storage.GetBucketUsage(ctx, name)
+}
+
+func NewBucketStorage(storage karma8.BucketStorage) karma8.BucketStorage {
+	return &bucketStorage{
+		storage: storage,
+	}
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"karma8"
+	"time"
+)
+
+type cursorStorage struct {
+	storage karma8.CursorStorage
+}
+
+func (m *cursorStorage) GetCursor(ctx context.Context, job string) (cursor string, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "get_cursor", err)
+	}(time.Now())
+
+	return m.storage.GetCursor(ctx, job)
+}
+
+func (m *cursorStorage) SaveCursor(ctx context.Context, job string, cursor string) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "save_cursor", err)
+	}(time.Now())
+
+	return m.storage.SaveCursor(ctx, job, cursor)
+}
+
+func NewCursorStorage(storage karma8.CursorStorage) karma8.CursorStorage {
+	return &cursorStorage{
+		storage: storage,
+	}
+}
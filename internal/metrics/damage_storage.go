@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"context"
+	"karma8"
+	"time"
+)
+
+type damageStorage struct {
+	storage karma8.DamageStorage
+}
+
+func (m *damageStorage) PutDamagedFilePart(ctx context.Context, part *karma8.DamagedFilePart) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "put_damaged_file_part", err)
+	}(time.Now())
+
+	return m.storage.PutDamagedFilePart(ctx, part)
+}
+
+func (m *damageStorage) ListDamagedFileParts(
+	ctx context.Context,
+	onlyActive bool,
+) (parts []*karma8.DamagedFilePart, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_damaged_file_parts", err)
+	}(time.Now())
+
+	return m.storage.ListDamagedFileParts(ctx, onlyActive)
+}
+
+func NewDamageStorage(storage karma8.DamageStorage) karma8.DamageStorage {
+	return &damageStorage{
+		storage: storage,
+	}
+}
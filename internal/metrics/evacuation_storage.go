@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"context"
+	"karma8"
+	"time"
+)
+
+type evacuationStorage struct {
+	storage karma8.EvacuationStorage
+}
+
+func (m *evacuationStorage) StartEvacuation(ctx context.Context, storageURL string) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "start_evacuation", err)
+	}(time.Now())
+
+	return m.storage.StartEvacuation(ctx, storageURL)
+}
+
+func (m *evacuationStorage) GetEvacuation(
+	ctx context.Context,
+	storageURL string,
+) (progress *karma8.EvacuationProgress, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "get_evacuation", err)
+	}(time.Now())
+
+	return m.storage.GetEvacuation(ctx, storageURL)
+}
+
+func (m *evacuationStorage) ListEvacuations(ctx context.Context) (progresses []*karma8.EvacuationProgress, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_evacuations", err)
+	}(time.Now())
+
+	return m.storage.ListEvacuations(ctx)
+}
+
+func (m *evacuationStorage) AddEvacuationMoved(ctx context.Context, storageURL string, size int64) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "add_evacuation_moved", err)
+	}(time.Now())
+
+	return m.storage.AddEvacuationMoved(ctx, storageURL, size)
+}
+
+func (m *evacuationStorage) AddEvacuationFailure(
+	ctx context.Context,
+	storageURL string,
+	failure *karma8.EvacuationFailure,
+) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "add_evacuation_failure", err)
+	}(time.Now())
+
+	return m.storage.AddEvacuationFailure(ctx, storageURL, failure)
+}
+
+func (m *evacuationStorage) FinishEvacuation(
+	ctx context.Context,
+	storageURL string,
+	state karma8.EvacuationState,
+	reason string,
+) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "finish_evacuation", err)
+	}(time.Now())
+
+	return m.storage.FinishEvacuation(ctx, storageURL, state, reason)
+}
+
+func NewEvacuationStorage(storage karma8.EvacuationStorage) karma8.EvacuationStorage {
+	return &evacuationStorage{
+		storage: storage,
+	}
+}
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"context"
+	"karma8"
+	"time"
+)
+
+type fileMetaStorage struct {
+	storage karma8.FileMetaStorage
+}
+
+func observeQuery(startTime time.Time, query string, err error) {
+	observe(fileMetaStorageDuration, startTime, query, resultOf(err))
+}
+
+func (m *fileMetaStorage) PutProcessingFileMeta(ctx context.Context, meta *karma8.FileMeta) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "put_processing_file_meta", err)
+	}(time.Now())
+
+	return m.storage.PutProcessingFileMeta(ctx, meta)
+}
+
+func (m *fileMetaStorage) CompleteFileMeta(ctx context.Context, meta *karma8.FileMeta, tenantQuota int64) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "complete_file_meta", err)
+	}(time.Now())
+
+	return m.storage.CompleteFileMeta(ctx, meta, tenantQuota)
+}
+
+func (m *fileMetaStorage) DeleteProcessingFileMeta(
+	ctx context.Context,
+	bucket string,
+	filename string,
+	createTime time.Time,
+) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "delete_processing_file_meta", err)
+	}(time.Now())
+
+	return m.storage.DeleteProcessingFileMeta(ctx, bucket, filename, createTime)
+}
+
+func (m *fileMetaStorage) ListStaleProcessingFileMetas(
+	ctx context.Context,
+	before time.Time,
+	limit int,
+) (metas []*karma8.FileMeta, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_stale_processing_file_metas", err)
+	}(time.Now())
+
+	return m.storage.ListStaleProcessingFileMetas(ctx, before, limit)
+}
+
+func (m *fileMetaStorage) GetFileMeta(
+	ctx context.Context,
+	bucket string,
+	filename string,
+) (meta *karma8.FileMeta, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "get_file_meta", err)
+	}(time.Now())
+
+	return m.storage.GetFileMeta(ctx, bucket, filename)
+}
+
+func (m *fileMetaStorage) ListFileMetas(
+	ctx context.Context,
+	after karma8.FileKey,
+	limit int,
+) (metas []*karma8.FileMeta, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_file_metas", err)
+	}(time.Now())
+
+	return m.storage.ListFileMetas(ctx, after, limit)
+}
+
+func (m *fileMetaStorage) ListFileMetasByStorage(
+	ctx context.Context,
+	storageURL string,
+	after karma8.FileKey,
+	limit int,
+) (metas []*karma8.FileMeta, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_file_metas_by_storage", err)
+	}(time.Now())
+
+	return m.storage.ListFileMetasByStorage(ctx, storageURL, after, limit)
+}
+
+func (m *fileMetaStorage) CountProcessingFilesByStorage(ctx context.Context, storageURL string) (count int, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "count_processing_files_by_storage", err)
+	}(time.Now())
+
+	return m.storage.CountProcessingFilesByStorage(ctx, storageURL)
+}
+
+func (m *fileMetaStorage) ListExpiredFileMetas(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+) (metas []*karma8.FileMeta, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_expired_file_metas", err)
+	}(time.Now())
+
+	return m.storage.ListExpiredFileMetas(ctx, now, limit)
+}
+
+func (m *fileMetaStorage) DeleteFileMeta(ctx context.Context, key karma8.FileKey) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "delete_file_meta", err)
+	}(time.Now())
+
+	return m.storage.DeleteFileMeta(ctx, key)
+}
+
+func (m *fileMetaStorage) SetFileLock(ctx context.Context, key karma8.FileKey, lock karma8.FileLock) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "set_file_lock", err)
+	}(time.Now())
+
+	return m.storage.SetFileLock(ctx, key, lock)
+}
+
+func (m *fileMetaStorage) MoveFilePart(
+	ctx context.Context,
+	key karma8.FileKey,
+	partIndex int,
+	from, to string,
+) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "move_file_part", err)
+	}(time.Now())
+
+	return m.storage.MoveFilePart(ctx, key, partIndex, from, to)
+}
+
+func (m *fileMetaStorage) GetStorageUsage(ctx context.Context) (usage map[string]int64, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "get_storage_usage", err)
+	}(time.Now())
+
+	return m.storage.GetStorageUsage(ctx)
+}
+
+func (m *fileMetaStorage) GetTenantUsage(ctx context.Context, tenant string) (usage int64, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "get_tenant_usage", err)
+	}(time.Now())
+
+	return m.storage.GetTenantUsage(ctx, tenant)
+}
+
+func (m *fileMetaStorage) GetReferencedPaths(
+	ctx context.Context,
+	storageURL string,
+) (paths map[string]struct{}, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "get_referenced_paths", err)
+	}(time.Now())
+
+	return m.storage.GetReferencedPaths(ctx, storageURL)
+}
+
+func NewFileMetaStorage(storage karma8.FileMetaStorage) karma8.FileMetaStorage {
+	return &fileMetaStorage{
+		storage: storage,
+	}
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"karma8"
+	"time"
+)
+
+type countingReadCloser struct {
+	io.ReadCloser
+	onRead func(n int)
+}
+
+func (m *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := m.ReadCloser.Read(p)
+	m.onRead(n)
+	return n, err
+}
+
+type fileService struct {
+	service karma8.FileService
+}
+
+func (m *fileService) PutFile(ctx context.Context, file *karma8.File) (err error) {
+	uploadsInFlight.Inc()
+	defer uploadsInFlight.Dec()
+
+	defer func(startTime time.Time) {
+		observe(fileServiceDuration, startTime, "put", resultOf(err))
+	}(time.Now())
+
+	file.Body = &countingReadCloser{
+		ReadCloser: file.Body,
+		onRead: func(n int) {
+			uploadedBytes.Add(float64(n))
+		},
+	}
+
+	return m.service.PutFile(ctx, file)
+}
+
+func (m *fileService) GetFile(
+	ctx context.Context,
+	bucket string,
+	filename string,
+	customerKey []byte,
+	byteRange *karma8.ByteRange,
+) (file *karma8.File, err error) {
+	defer func(startTime time.Time) {
+		observe(fileServiceDuration, startTime, "get", resultOf(err))
+	}(time.Now())
+
+	file, err = m.service.GetFile(ctx, bucket, filename, customerKey, byteRange)
+	if err != nil {
+		return nil, err
+	}
+
+	file.Body = &countingReadCloser{
+		ReadCloser: file.Body,
+		onRead: func(n int) {
+			downloadedBytes.Add(float64(n))
+		},
+	}
+
+	return file, nil
+}
+
+func (m *fileService) DeleteFile(ctx context.Context, bucket string, filename string) (err error) {
+	defer func(startTime time.Time) {
+		observe(fileServiceDuration, startTime, "delete", resultOf(err))
+	}(time.Now())
+
+	return m.service.DeleteFile(ctx, bucket, filename)
+}
+
+func NewFileService(service karma8.FileService) karma8.FileService {
+	return &fileService{
+		service: service,
+	}
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (m *statusRecorder) WriteHeader(status int) {
+	m.status = status
+	m.ResponseWriter.WriteHeader(status)
+}
+
+// NewHTTPMiddleware measures requests by route template, so filenames don't blow up label cardinality.
+func NewHTTPMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			startTime := time.Now()
+			recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+
+			next.ServeHTTP(recorder, request)
+
+			route := "unknown"
+			if current := mux.CurrentRoute(request); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+			observe(httpRequestDuration, startTime, route, request.Method, strconv.Itoa(recorder.status))
+		})
+	}
+}
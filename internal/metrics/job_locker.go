@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"context"
+	"karma8"
+	"time"
+)
+
+type jobLocker struct {
+	locker karma8.JobLocker
+}
+
+func (m *jobLocker) TryLockJob(ctx context.Context, job string) (unlock func(), locked bool, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "try_lock_job", err)
+	}(time.Now())
+
+	return m.locker.TryLockJob(ctx, job)
+}
+
+func NewJobLocker(locker karma8.JobLocker) karma8.JobLocker {
+	return &jobLocker{
+		locker: locker,
+	}
+}
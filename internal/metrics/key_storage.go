@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"karma8"
+	"time"
+)
+
+type keyStorage struct {
+	storage karma8.KeyStorage
+}
+
+func (m *keyStorage) ListStaleFileEncryptions(
+	ctx context.Context,
+	masterKeyID string,
+	limit int,
+) (encryptions []*karma8.FileEncryption, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_stale_file_encryptions", err)
+	}(time.Now())
+
+	return m.storage.ListStaleFileEncryptions(ctx, masterKeyID, limit)
+}
+
+func (m *keyStorage) ReplaceFileEncryption(
+	ctx context.Context,
+	old *karma8.FileEncryption,
+	new *karma8.FileEncryption,
+) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "replace_file_encryption", err)
+	}(time.Now())
+
+	return m.storage.ReplaceFileEncryption(ctx, old, new)
+}
+
+func NewKeyStorage(storage karma8.KeyStorage) karma8.KeyStorage {
+	return &keyStorage{
+		storage: storage,
+	}
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const (
+	namespace = "karma8"
+
+	resultOK    = "ok"
+	resultError = "error"
+)
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	fileServiceDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "file_service",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of file service operations, for downloads it's time until body is returned.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "result"})
+
+	uploadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "file_service",
+		Name:      "uploaded_bytes_total",
+		Help:      "Amount of bytes received from clients.",
+	})
+
+	downloadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "file_service",
+		Name:      "downloaded_bytes_total",
+		Help:      "Amount of bytes sent to clients.",
+	})
+
+	uploadsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "file_service",
+		Name:      "uploads_in_flight",
+		Help:      "Amount of uploads in progress.",
+	})
+
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storage",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of storage operations by host, for reads it's time until body is returned.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"storage", "operation", "result"})
+
+	balancerSelectedHosts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "balancer",
+		Name:      "selected_hosts_total",
+		Help:      "Amount of times host was selected for a new part.",
+	}, []string{"host"})
+
+	fileMetaStorageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "file_meta_storage",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of meta storage queries, including buckets, blobs, trash and other auxiliary tables.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"query", "result"})
+)
+
+func resultOf(err error) string {
+	if err != nil {
+		return resultError
+	}
+	return resultOK
+}
+
+func observe(histogram *prometheus.HistogramVec, startTime time.Time, labels ...string) {
+	histogram.WithLabelValues(labels...).Observe(time.Since(startTime).Seconds())
+}
+
+// NewHandler returns handler exposing all registered metrics.
+func NewHandler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"karma8"
+	"time"
+)
+
+type orphanStorage struct {
+	storage karma8.OrphanStorage
+}
+
+func (m *orphanStorage) PutOrphanFileParts(ctx context.Context, parts []*karma8.OrphanFilePart) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "put_orphan_file_parts", err)
+	}(time.Now())
+
+	return m.storage.PutOrphanFileParts(ctx, parts)
+}
+
+func (m *orphanStorage) ListOrphanFileParts(ctx context.Context, limit int) (parts []*karma8.OrphanFilePart, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_orphan_file_parts", err)
+	}(time.Now())
+
+	return m.storage.ListOrphanFileParts(ctx, limit)
+}
+
+func (m *orphanStorage) DeleteOrphanFilePart(ctx context.Context, part *karma8.OrphanFilePart) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "delete_orphan_file_part", err)
+	}(time.Now())
+
+	return m.storage.DeleteOrphanFilePart(ctx, part)
+}
+
+func NewOrphanStorage(storage karma8.OrphanStorage) karma8.OrphanStorage {
+	return &orphanStorage{
+		storage: storage,
+	}
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"karma8"
+	"time"
+)
+
+type storage struct {
+	storage karma8.Storage
+	host    string
+}
+
+func (m *storage) observe(startTime time.Time, operation string, err error) {
+	observe(storageDuration, startTime, m.host, operation, resultOf(err))
+}
+
+func (m *storage) UploadFilePart(ctx context.Context, path string, body io.Reader) (err error) {
+	defer func(startTime time.Time) {
+		m.observe(startTime, "upload", err)
+	}(time.Now())
+
+	return m.storage.UploadFilePart(ctx, path, body)
+}
+
+func (m *storage) ReadFilePart(ctx context.Context, path string, offset int64) (body io.ReadCloser, err error) {
+	defer func(startTime time.Time) {
+		m.observe(startTime, "read", err)
+	}(time.Now())
+
+	return m.storage.ReadFilePart(ctx, path, offset)
+}
+
+func (m *storage) DeleteFilePart(ctx context.Context, path string) (err error) {
+	defer func(startTime time.Time) {
+		m.observe(startTime, "delete", err)
+	}(time.Now())
+
+	return m.storage.DeleteFilePart(ctx, path)
+}
+
+func (m *storage) ListFileParts(ctx context.Context) (parts []*karma8.StoredFilePart, err error) {
+	defer func(startTime time.Time) {
+		m.observe(startTime, "list", err)
+	}(time.Now())
+
+	return m.storage.ListFileParts(ctx)
+}
+
+// Ping isn't measured, it's called by probes and would skew latencies of real operations.
+func (m *storage) Ping(ctx context.Context) error {
+	return m.storage.Ping(ctx)
+}
+
+func NewStorage(s karma8.Storage, host string) karma8.Storage {
+	return &storage{
+		storage: s,
+		host:    host,
+	}
+}
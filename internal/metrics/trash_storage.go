@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"karma8"
+	"time"
+)
+
+type trashStorage struct {
+	storage karma8.TrashStorage
+}
+
+func (m *trashStorage) ListDeletedFiles(
+	ctx context.Context,
+	bucket string,
+	limit int,
+) (files []*karma8.DeletedFile, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_deleted_files", err)
+	}(time.Now())
+
+	return m.storage.ListDeletedFiles(ctx, bucket, limit)
+}
+
+func (m *trashStorage) ListPurgeableDeletedFiles(
+	ctx context.Context,
+	before time.Time,
+	limit int,
+) (files []*karma8.DeletedFile, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_purgeable_deleted_files", err)
+	}(time.Now())
+
+	return m.storage.ListPurgeableDeletedFiles(ctx, before, limit)
+}
+
+func (m *trashStorage) RestoreDeletedFile(ctx context.Context, id int64) (meta *karma8.FileMeta, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "restore_deleted_file", err)
+	}(time.Now())
+
+	return m.storage.RestoreDeletedFile(ctx, id)
+}
+
+func (m *trashStorage) PurgeDeletedFile(ctx context.Context, id int64) (parts []*karma8.FilePart, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "purge_deleted_file", err)
+	}(time.Now())
+
+	return m.storage.PurgeDeletedFile(ctx, id)
+}
+
+func (m *trashStorage) ListDeletedFilesByStorage(
+	ctx context.Context,
+	storageURL string,
+	afterID int64,
+	limit int,
+) (files []*karma8.DeletedFile, err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "list_deleted_files_by_storage", err)
+	}(time.Now())
+
+	return m.storage.ListDeletedFilesByStorage(ctx, storageURL, afterID, limit)
+}
+
+func (m *trashStorage) MoveDeletedFilePart(ctx context.Context, id int64, partIndex int, from, to string) (err error) {
+	defer func(startTime time.Time) {
+		observeQuery(startTime, "move_deleted_file_part", err)
+	}(time.Now())
+
+	return m.storage.MoveDeletedFilePart(ctx, id, partIndex, from, to)
+}
+
+func NewTrashStorage(storage karma8.TrashStorage) karma8.TrashStorage {
+	return &trashStorage{
+		storage: storage,
+	}
+}
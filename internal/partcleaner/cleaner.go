@@ -0,0 +1,116 @@
+package partcleaner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"karma8"
+)
+
+// Cleaner deletes file parts from storages, parts which can't be deleted are left for the janitor.
+type Cleaner struct {
+	storageHolder   karma8.StorageHolder
+	fileMetaStorage karma8.FileMetaStorage
+	orphanStorage   karma8.OrphanStorage
+
+	logger *zap.Logger
+}
+
+// orphansOf returns all locations of the parts, shared parts are skipped, because other files may refer to them.
+func orphansOf(parts []*karma8.FilePart) []*karma8.OrphanFilePart {
+	var orphans []*karma8.OrphanFilePart
+	for _, part := range parts {
+		if part.Shared {
+			continue
+		}
+		for _, location := range part.Locations() {
+			orphans = append(orphans, &karma8.OrphanFilePart{StorageURL: location, Path: part.Path})
+		}
+	}
+	return orphans
+}
+
+// CleanProcessingFile removes unfinished upload: processing meta goes first, so parts are deleted only
+// when it's known that upload wasn't completed.
+func (m *Cleaner) CleanProcessingFile(ctx context.Context, fileMeta *karma8.FileMeta) error {
+	err := m.fileMetaStorage.DeleteProcessingFileMeta(ctx, fileMeta.Bucket, fileMeta.Name, fileMeta.CreateTime)
+	if errors.Is(err, karma8.ErrFileNotFound) {
+		m.logger.Warn(
+			"processing file meta is already gone",
+			zap.String("bucket", fileMeta.Bucket),
+			zap.String("filename", fileMeta.Name),
+		)
+		return nil
+	}
+	if err != nil {
+		// NOTE: Janitor checks references before deletion, so parts are safe if upload was completed after all.
+		m.recordOrphans(ctx, orphansOf(fileMeta.Parts))
+		return fmt.Errorf("can't delete processing file meta: %w", err)
+	}
+
+	return m.DeleteParts(ctx, fileMeta.Parts)
+}
+
+// DeleteParts deletes all locations of the parts, failed ones are recorded as orphans.
+// Shared parts are kept, blobs are deleted by the janitor when nothing refers to them.
+func (m *Cleaner) DeleteParts(ctx context.Context, parts []*karma8.FilePart) error {
+	return m.deleteOrphans(ctx, orphansOf(parts))
+}
+
+// DeleteBlob deletes all locations of the blob which isn't referenced anymore, failed ones are recorded as orphans.
+func (m *Cleaner) DeleteBlob(ctx context.Context, blob *karma8.Blob) error {
+	var orphans []*karma8.OrphanFilePart
+	for _, location := range blob.Part.Locations() {
+		orphans = append(orphans, &karma8.OrphanFilePart{StorageURL: location, Path: blob.Part.Path})
+	}
+	return m.deleteOrphans(ctx, orphans)
+}
+
+func (m *Cleaner) deleteOrphans(ctx context.Context, orphans []*karma8.OrphanFilePart) error {
+	var failed []*karma8.OrphanFilePart
+	for _, orphan := range orphans {
+		storage := m.storageHolder.GetStorage(orphan.StorageURL)
+		if err := storage.DeleteFilePart(ctx, orphan.Path); err != nil {
+			m.logger.Error(
+				"can't delete file part",
+				zap.String("storage_url", orphan.StorageURL),
+				zap.String("path", orphan.Path),
+				zap.Error(err),
+			)
+			failed = append(failed, orphan)
+		}
+	}
+
+	if len(failed) > 0 {
+		m.recordOrphans(ctx, failed)
+		return fmt.Errorf("can't delete %d file parts", len(failed))
+	}
+
+	return nil
+}
+
+func (m *Cleaner) recordOrphans(ctx context.Context, orphans []*karma8.OrphanFilePart) {
+	if len(orphans) == 0 {
+		return
+	}
+
+	if err := m.orphanStorage.PutOrphanFileParts(ctx, orphans); err != nil {
+		// NOTE: Parts will be found by the janitor inventory check anyway.
+		m.logger.Error("can't record orphan file parts", zap.Int("count", len(orphans)), zap.Error(err))
+	}
+}
+
+func New(
+	storageHolder karma8.StorageHolder,
+	fileMetaStorage karma8.FileMetaStorage,
+	orphanStorage karma8.OrphanStorage,
+	logger *zap.Logger,
+) *Cleaner {
+	return &Cleaner{
+		storageHolder:   storageHolder,
+		fileMetaStorage: fileMetaStorage,
+		orphanStorage:   orphanStorage,
+		logger:          logger,
+	}
+}
@@ -0,0 +1,161 @@
+package partmover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"karma8"
+)
+
+// Mover copies file parts between storages keeping file meta consistent.
+type Mover struct {
+	storageHolder   karma8.StorageHolder
+	fileMetaStorage karma8.FileMetaStorage
+	trashStorage    karma8.TrashStorage
+
+	logger *zap.Logger
+}
+
+// Move copies part from one of its locations to the target storage,
+// switches file meta to it and only then deletes the old copy. On success fileMeta is updated in place.
+// Parts of locked files are moved too, the data stays the same.
+func (m *Mover) Move(ctx context.Context, fileMeta *karma8.FileMeta, partIndex int, from, to string) error {
+	part := fileMeta.Parts[partIndex]
+	logger := m.partLogger(fileMeta, partIndex, from, to)
+
+	if err := m.Copy(ctx, part, from, to); err != nil {
+		logger.Error("can't copy file part", zap.Error(err))
+		return fmt.Errorf("can't copy file part: %w", err)
+	}
+
+	if err := m.fileMetaStorage.MoveFilePart(ctx, fileMeta.Key(), partIndex, from, to); err != nil {
+		if !errors.Is(err, karma8.ErrFilePartMoved) {
+			logger.Error("can't move file part in meta", zap.Error(err))
+		}
+		// NOTE: Concurrent mover may have copied the part to the same storage and already committed it,
+		// then the copy is the only one on the storage and mustn't be deleted.
+		if m.isStoredOn(ctx, fileMeta.Key(), partIndex, part.Path, to) {
+			logger.Info("copied file part is kept, it's referenced by file meta")
+		} else if deleteErr := m.storageHolder.GetStorage(to).DeleteFilePart(ctx, part.Path); deleteErr != nil {
+			logger.Error("can't delete copied file part", zap.Error(deleteErr))
+		}
+		return fmt.Errorf("can't move file part in meta: %w", err)
+	}
+
+	replaceLocation(part, from, to)
+
+	// NOTE: Meta already points to the new storage, so failure here only leaves garbage on the old storage.
+	if err := m.storageHolder.GetStorage(from).DeleteFilePart(ctx, part.Path); err != nil {
+		logger.Error("can't delete old file part", zap.Error(err))
+	}
+
+	logger.Info("file part moved")
+
+	return nil
+}
+
+// MoveDeleted works like Move for the file in trash, so the storage keeps no parts of files which could be restored.
+func (m *Mover) MoveDeleted(ctx context.Context, deletedFile *karma8.DeletedFile, partIndex int, from, to string) error {
+	part := deletedFile.Meta.Parts[partIndex]
+	logger := m.partLogger(deletedFile.Meta, partIndex, from, to).With(zap.Int64("deleted_file_id", deletedFile.ID))
+
+	if err := m.Copy(ctx, part, from, to); err != nil {
+		logger.Error("can't copy file part", zap.Error(err))
+		return fmt.Errorf("can't copy file part: %w", err)
+	}
+
+	if err := m.trashStorage.MoveDeletedFilePart(ctx, deletedFile.ID, partIndex, from, to); err != nil {
+		if !errors.Is(err, karma8.ErrFilePartMoved) {
+			logger.Error("can't move deleted file part in meta", zap.Error(err))
+		}
+		// NOTE: Shared part may be moved to the same storage by another mover, so the copy is left to the janitor,
+		// which deletes it only if nothing refers to it.
+		return fmt.Errorf("can't move deleted file part in meta: %w", err)
+	}
+
+	replaceLocation(part, from, to)
+
+	if err := m.storageHolder.GetStorage(from).DeleteFilePart(ctx, part.Path); err != nil {
+		logger.Error("can't delete old file part", zap.Error(err))
+	}
+
+	logger.Info("deleted file part moved")
+
+	return nil
+}
+
+func (m *Mover) partLogger(fileMeta *karma8.FileMeta, partIndex int, from, to string) *zap.Logger {
+	return m.logger.With(
+		zap.String("bucket", fileMeta.Bucket),
+		zap.String("filename", fileMeta.Name),
+		zap.Int("part_index", partIndex),
+		zap.String("from", from),
+		zap.String("to", to),
+	)
+}
+
+// isStoredOn reports whether the current file meta refers to the part path on the storage.
+// It returns true if meta can't be read, e.g. file is moved to trash meanwhile, so data is left to the janitor,
+// which checks references of deleted files too, instead of being lost.
+func (m *Mover) isStoredOn(ctx context.Context, key karma8.FileKey, partIndex int, path string, storageURL string) bool {
+	fileMeta, err := m.fileMetaStorage.GetFileMeta(ctx, key.Bucket, key.Name)
+	if err != nil {
+		if !errors.Is(err, karma8.ErrFileNotFound) {
+			m.logger.Error("can't get file meta", zap.String("filename", key.Name), zap.Error(err))
+		}
+		return true
+	}
+	if partIndex >= len(fileMeta.Parts) || fileMeta.Parts[partIndex].Path != path {
+		return false
+	}
+
+	for _, location := range fileMeta.Parts[partIndex].Locations() {
+		if location == storageURL {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy uploads part data from one storage to another without touching file meta.
+func (m *Mover) Copy(ctx context.Context, part *karma8.FilePart, from, to string) error {
+	body, err := m.storageHolder.GetStorage(from).ReadFilePart(ctx, part.Path, 0)
+	if err != nil {
+		return fmt.Errorf("can't read file part: %w", err)
+	}
+	defer body.Close()
+
+	if err := m.storageHolder.GetStorage(to).UploadFilePart(ctx, part.Path, body); err != nil {
+		return fmt.Errorf("can't upload file part: %w", err)
+	}
+
+	return nil
+}
+
+func replaceLocation(part *karma8.FilePart, from, to string) {
+	if part.StorageURL == from {
+		part.StorageURL = to
+		return
+	}
+	for i, replica := range part.Replicas {
+		if replica == from {
+			part.Replicas[i] = to
+			return
+		}
+	}
+}
+
+func New(
+	storageHolder karma8.StorageHolder,
+	fileMetaStorage karma8.FileMetaStorage,
+	trashStorage karma8.TrashStorage,
+	logger *zap.Logger,
+) *Mover {
+	return &Mover{
+		storageHolder:   storageHolder,
+		fileMetaStorage: fileMetaStorage,
+		trashStorage:    trashStorage,
+		logger:          logger,
+	}
+}
@@ -0,0 +1,111 @@
+package purger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/job"
+	"karma8/internal/partcleaner"
+	"time"
+)
+
+const jobName = "purger"
+
+type Options struct {
+	// Interval between purger passes.
+	Interval time.Duration
+	// RestoreWindow is how long deleted files are kept in trash, so they could be restored.
+	RestoreWindow time.Duration
+	// BatchSize is amount of deleted files listed at once, every pass purges all outdated files batch by batch.
+	BatchSize int
+}
+
+// Purger deletes parts of files which were kept in trash longer than the restore window.
+type Purger struct {
+	trashStorage karma8.TrashStorage
+	cleaner      *partcleaner.Cleaner
+	jobLocker    karma8.JobLocker
+	options      Options
+
+	logger *zap.Logger
+}
+
+func (m *Purger) Run(ctx context.Context) error {
+	return job.RunExclusively(ctx, jobName, m.jobLocker, m.options.Interval, m.RunOnce, m.logger)
+}
+
+func (m *Purger) RunOnce(ctx context.Context) error {
+	for {
+		deletedFiles, err := m.trashStorage.ListPurgeableDeletedFiles(
+			ctx,
+			time.Now().Add(-m.options.RestoreWindow),
+			m.options.BatchSize,
+		)
+		if err != nil {
+			return fmt.Errorf("can't list purgeable deleted files: %w", err)
+		}
+
+		var purged int
+		var purgedBytes int64
+		for _, deletedFile := range deletedFiles {
+			if err := m.purge(ctx, deletedFile); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				m.logger.Error(
+					"can't purge deleted file",
+					zap.Int64("id", deletedFile.ID),
+					zap.String("bucket", deletedFile.Meta.Bucket),
+					zap.String("filename", deletedFile.Meta.Name),
+					zap.Error(err),
+				)
+				continue
+			}
+			purged++
+			purgedBytes += deletedFile.Meta.ContentLength
+		}
+
+		if purged > 0 {
+			m.logger.Info("deleted files purged", zap.Int("count", purged), zap.Int64("bytes", purgedBytes))
+		}
+
+		// NOTE: Files which can't be purged are listed again, so the pass stops if nothing is purged.
+		if len(deletedFiles) < m.options.BatchSize || purged == 0 {
+			return nil
+		}
+	}
+}
+
+// purge forgets the file first, so it can't be restored once its parts are being deleted.
+func (m *Purger) purge(ctx context.Context, deletedFile *karma8.DeletedFile) error {
+	parts, err := m.trashStorage.PurgeDeletedFile(ctx, deletedFile.ID)
+	if errors.Is(err, karma8.ErrDeletedFileNotFound) {
+		// NOTE: File was restored after listing, its parts are in use again.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't purge deleted file meta: %w", err)
+	}
+
+	// NOTE: Parts of the listing may be moved meanwhile, so parts returned by the purge are deleted.
+	// Parts which can't be deleted are recorded as orphans and deleted later by the janitor.
+	return m.cleaner.DeleteParts(ctx, parts)
+}
+
+func New(
+	trashStorage karma8.TrashStorage,
+	cleaner *partcleaner.Cleaner,
+	jobLocker karma8.JobLocker,
+	options Options,
+	logger *zap.Logger,
+) *Purger {
+	return &Purger{
+		trashStorage: trashStorage,
+		cleaner:      cleaner,
+		jobLocker:    jobLocker,
+		options:      options,
+		logger:       logger.With(zap.String("job", jobName)),
+	}
+}
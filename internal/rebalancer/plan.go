@@ -0,0 +1,91 @@
+package rebalancer
+
+// loadPlan tracks storage usage during one rebalance pass.
+// Desired usage of every host is proportional to its balancer weight, hosts without weight should be empty.
+// Drained hosts are treated as hosts without weight, so parts aren't moved back onto them after evacuation.
+type loadPlan struct {
+	usage     map[string]int64
+	desired   map[string]float64
+	drained   map[string]struct{}
+	threshold float64
+}
+
+func newLoadPlan(
+	hostToWeight map[string]int,
+	drained map[string]struct{},
+	usage map[string]int64,
+	threshold float64,
+) *loadPlan {
+	var total int64
+	for _, hostUsage := range usage {
+		total += hostUsage
+	}
+
+	var totalWeight int
+	for host, weight := range hostToWeight {
+		if _, ok := drained[host]; !ok {
+			totalWeight += weight
+		}
+	}
+
+	desired := make(map[string]float64, len(hostToWeight))
+	for host, weight := range hostToWeight {
+		if _, ok := drained[host]; ok {
+			continue
+		}
+		if totalWeight > 0 {
+			desired[host] = float64(total) * float64(weight) / float64(totalWeight)
+		}
+	}
+
+	planUsage := make(map[string]int64, len(usage))
+	for host, hostUsage := range usage {
+		planUsage[host] = hostUsage
+	}
+
+	return &loadPlan{
+		usage:     planUsage,
+		desired:   desired,
+		drained:   drained,
+		threshold: threshold,
+	}
+}
+
+func (m *loadPlan) isOverloaded(host string) bool {
+	return float64(m.usage[host]) > m.desired[host]*(1+m.threshold)
+}
+
+// pickTarget returns the least loaded host which stays within desired usage after receiving size bytes,
+// target is chosen among allowed hosts if allowed isn't empty, drained hosts are never chosen.
+func (m *loadPlan) pickTarget(size int64, exclude map[string]struct{}, allowed map[string]struct{}) (string, bool) {
+	var target string
+	var targetLoad float64
+	found := false
+	for host, desired := range m.desired {
+		if _, ok := exclude[host]; ok {
+			continue
+		}
+		if _, ok := m.drained[host]; ok {
+			continue
+		}
+		if _, ok := allowed[host]; len(allowed) > 0 && !ok {
+			continue
+		}
+		if float64(m.usage[host]+size) > desired {
+			continue
+		}
+
+		load := float64(m.usage[host]) / desired
+		if !found || load < targetLoad || (load == targetLoad && host < target) {
+			target = host
+			targetLoad = load
+			found = true
+		}
+	}
+	return target, found
+}
+
+func (m *loadPlan) move(from, to string, size int64) {
+	m.usage[from] -= size
+	m.usage[to] += size
+}
@@ -0,0 +1,133 @@
+package rebalancer
+
+import (
+	"testing"
+)
+
+func hostSet(hosts ...string) map[string]struct{} {
+	set := make(map[string]struct{}, len(hosts))
+	for _, host := range hosts {
+		set[host] = struct{}{}
+	}
+	return set
+}
+
+func TestLoadPlanPickTarget(t *testing.T) {
+	tests := []struct {
+		name         string
+		hostToWeight map[string]int
+		usage        map[string]int64
+		size         int64
+		exclude      map[string]struct{}
+		allowed      map[string]struct{}
+		wantTarget   string
+		wantFound    bool
+	}{
+		{
+			name:         "least loaded host",
+			hostToWeight: map[string]int{"a": 1, "b": 1, "c": 1},
+			usage:        map[string]int64{"a": 200, "b": 40, "c": 60},
+			size:         10,
+			wantTarget:   "b",
+			wantFound:    true,
+		},
+		{
+			name:         "load is relative to weight",
+			hostToWeight: map[string]int{"a": 1, "b": 3},
+			usage:        map[string]int64{"a": 100, "b": 100, "c": 200},
+			size:         10,
+			wantTarget:   "b",
+			wantFound:    true,
+		},
+		{
+			name:         "tie is broken by host name",
+			hostToWeight: map[string]int{"a": 1, "b": 1, "c": 1},
+			usage:        map[string]int64{"a": 300, "b": 0, "c": 0},
+			size:         10,
+			wantTarget:   "b",
+			wantFound:    true,
+		},
+		{
+			name:         "host exceeding desired usage after move is skipped",
+			hostToWeight: map[string]int{"a": 1, "b": 1},
+			usage:        map[string]int64{"a": 100, "b": 0},
+			size:         60,
+			wantFound:    false,
+		},
+		{
+			name:         "excluded host is skipped",
+			hostToWeight: map[string]int{"a": 1, "b": 1, "c": 1},
+			usage:        map[string]int64{"a": 200, "b": 40, "c": 60},
+			size:         10,
+			exclude:      hostSet("b"),
+			wantTarget:   "c",
+			wantFound:    true,
+		},
+		{
+			name:         "only allowed hosts are chosen",
+			hostToWeight: map[string]int{"a": 1, "b": 1, "c": 1},
+			usage:        map[string]int64{"a": 200, "b": 40, "c": 60},
+			size:         10,
+			allowed:      hostSet("a", "c"),
+			wantTarget:   "c",
+			wantFound:    true,
+		},
+		{
+			name:         "host without weight is never chosen",
+			hostToWeight: map[string]int{"a": 1},
+			usage:        map[string]int64{"a": 100, "b": 0},
+			size:         10,
+			exclude:      hostSet("a"),
+			wantFound:    false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan := newLoadPlan(test.hostToWeight, nil, test.usage, 0)
+
+			target, found := plan.pickTarget(test.size, test.exclude, test.allowed)
+			if found != test.wantFound || target != test.wantTarget {
+				t.Fatalf("target is %q (found %t), want %q (found %t)", target, found, test.wantTarget, test.wantFound)
+			}
+		})
+	}
+}
+
+func TestLoadPlanMove(t *testing.T) {
+	plan := newLoadPlan(map[string]int{"a": 1, "b": 1}, nil, map[string]int64{"a": 100, "b": 0}, 0.1)
+
+	if !plan.isOverloaded("a") {
+		t.Fatal("host a isn't overloaded before move")
+	}
+	if target, found := plan.pickTarget(50, nil, nil); !found || target != "b" {
+		t.Fatalf("target is %q (found %t), want b", target, found)
+	}
+
+	plan.move("a", "b", 50)
+
+	if plan.isOverloaded("a") {
+		t.Fatal("host a is overloaded after move")
+	}
+	// NOTE: Usage of b reached desired 50, so nothing more fits there.
+	if target, found := plan.pickTarget(1, hostSet("a"), nil); found {
+		t.Fatalf("target %q is found after move, want none", target)
+	}
+}
+
+func TestLoadPlanDrained(t *testing.T) {
+	hostToWeight := map[string]int{"a": 1, "b": 1, "c": 1}
+	usage := map[string]int64{"a": 100, "b": 20, "c": 80}
+	plan := newLoadPlan(hostToWeight, hostSet("b"), usage, 0)
+
+	// NOTE: Drained host gets no share of usage, so the rest is split between a and c.
+	if !plan.isOverloaded("b") {
+		t.Fatal("drained host with parts isn't overloaded")
+	}
+	if target, found := plan.pickTarget(10, hostSet("a"), nil); !found || target != "c" {
+		t.Fatalf("target is %q (found %t), want c", target, found)
+	}
+	if target, found := plan.pickTarget(10, hostSet("a", "c"), nil); found {
+		t.Fatalf("target %q is found among drained hosts, want none", target)
+	}
+}
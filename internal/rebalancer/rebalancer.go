@@ -0,0 +1,172 @@
+package rebalancer
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/balancer"
+	"karma8/internal/job"
+	"karma8/internal/partmover"
+	"time"
+)
+
+const jobName = "rebalancer"
+
+type Options struct {
+	// Interval between rebalance passes.
+	Interval time.Duration
+	// BatchSize is amount of files read from meta storage at once, progress is saved after every batch.
+	BatchSize int
+	// Threshold is allowed relative deviation of host usage from desired one.
+	Threshold float64
+	// MaxBytesPerSecond throttles copying of parts, zero means no limit.
+	MaxBytesPerSecond int64
+}
+
+// Rebalancer moves file parts from overloaded storages to underloaded ones, e.g. to newly added hosts.
+type Rebalancer struct {
+	hostToWeight      map[string]int
+	balancer          *balancer.DrainingBalancer
+	fileMetaStorage   karma8.FileMetaStorage
+	bucketStorage     karma8.BucketStorage
+	cursorStorage     karma8.CursorStorage
+	evacuationStorage karma8.EvacuationStorage
+	mover             *partmover.Mover
+	jobLocker         karma8.JobLocker
+	options           Options
+
+	logger *zap.Logger
+}
+
+func (m *Rebalancer) Run(ctx context.Context) error {
+	return job.RunExclusively(ctx, jobName, m.jobLocker, m.options.Interval, m.RunOnce, m.logger)
+}
+
+// RunOnce walks over all files starting from the saved cursor and moves parts according to the load plan.
+func (m *Rebalancer) RunOnce(ctx context.Context) error {
+	usage, err := m.fileMetaStorage.GetStorageUsage(ctx)
+	if err != nil {
+		return err
+	}
+	drained, err := balancer.DrainedHosts(ctx, m.evacuationStorage)
+	if err != nil {
+		return err
+	}
+	plan := newLoadPlan(m.hostToWeight, drained, usage, m.options.Threshold)
+
+	cursor, err := m.cursorStorage.GetCursor(ctx, jobName)
+	if err != nil {
+		return err
+	}
+
+	m.logger.Info("start rebalance pass", zap.String("cursor", cursor))
+
+	for {
+		fileMetas, err := m.fileMetaStorage.ListFileMetas(ctx, karma8.ParseFileKey(cursor), m.options.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(fileMetas) == 0 {
+			m.logger.Info("rebalance pass finished")
+			return m.cursorStorage.SaveCursor(ctx, jobName, "")
+		}
+
+		for _, fileMeta := range fileMetas {
+			if err := m.rebalanceFile(ctx, plan, fileMeta); err != nil {
+				return err
+			}
+		}
+
+		cursor = fileMetas[len(fileMetas)-1].Key().String()
+		if err := m.cursorStorage.SaveCursor(ctx, jobName, cursor); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Rebalancer) rebalanceFile(ctx context.Context, plan *loadPlan, fileMeta *karma8.FileMeta) error {
+	bucket, err := m.bucketStorage.GetBucket(ctx, fileMeta.Bucket)
+	if err != nil {
+		return err
+	}
+	allowedHosts := make(map[string]struct{}, len(bucket.AllowedHosts))
+	for _, host := range bucket.AllowedHosts {
+		allowedHosts[host] = struct{}{}
+	}
+
+	// NOTE: Replicas of a part mustn't share a storage, parts of the file are kept on distinct storages too,
+	// as they're spread on upload.
+	usedHosts := make(map[string]struct{}, len(fileMeta.Parts))
+	for _, part := range fileMeta.Parts {
+		for _, location := range part.Locations() {
+			usedHosts[location] = struct{}{}
+		}
+	}
+
+	for i, part := range fileMeta.Parts {
+		for _, from := range part.Locations() {
+			if !plan.isOverloaded(from) {
+				continue
+			}
+
+			target, ok := plan.pickTarget(part.StoredSize(), usedHosts, allowedHosts)
+			if !ok {
+				continue
+			}
+
+			startTime := time.Now()
+			if err := m.mover.Move(ctx, fileMeta, i, from, target); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if !errors.Is(err, karma8.ErrFilePartMoved) {
+					m.logger.Error(
+						"can't move file part",
+						zap.String("bucket", fileMeta.Bucket),
+						zap.String("filename", fileMeta.Name),
+						zap.Error(err),
+					)
+				}
+				continue
+			}
+
+			plan.move(from, target, part.StoredSize())
+			delete(usedHosts, from)
+			usedHosts[target] = struct{}{}
+
+			if err := job.Throttle(ctx, part.StoredSize(), time.Since(startTime), m.options.MaxBytesPerSecond); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func New(
+	hostToWeight map[string]int,
+	balancer *balancer.DrainingBalancer,
+	fileMetaStorage karma8.FileMetaStorage,
+	bucketStorage karma8.BucketStorage,
+	cursorStorage karma8.CursorStorage,
+	evacuationStorage karma8.EvacuationStorage,
+	mover *partmover.Mover,
+	jobLocker karma8.JobLocker,
+	options Options,
+	logger *zap.Logger,
+) *Rebalancer {
+	return &Rebalancer{
+		hostToWeight:      hostToWeight,
+		balancer:          balancer,
+		fileMetaStorage:   fileMetaStorage,
+		bucketStorage:     bucketStorage,
+		cursorStorage:     cursorStorage,
+		evacuationStorage: evacuationStorage,
+		mover:             mover,
+		jobLocker:         jobLocker,
+		options:           options,
+		logger:            logger.With(zap.String("job", jobName)),
+	}
+}
@@ -0,0 +1,102 @@
+package rewrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"karma8"
+	"karma8/internal/encryption"
+	"karma8/internal/job"
+	"time"
+)
+
+const jobName = "rewrapper"
+
+type Options struct {
+	// Interval between rewrapper passes.
+	Interval time.Duration
+	// BatchSize is amount of stale keys listed at once, every pass rewraps all stale keys batch by batch.
+	BatchSize int
+}
+
+// Rewrapper wraps data keys of files by the active master key after master key rotation.
+// Data isn't rewritten, so the old master key can be removed from keyring as soon as the pass is done.
+type Rewrapper struct {
+	keyStorage karma8.KeyStorage
+	keyring    *encryption.Keyring
+	jobLocker  karma8.JobLocker
+	options    Options
+
+	logger *zap.Logger
+}
+
+func (m *Rewrapper) Run(ctx context.Context) error {
+	return job.RunExclusively(ctx, jobName, m.jobLocker, m.options.Interval, m.RunOnce, m.logger)
+}
+
+func (m *Rewrapper) RunOnce(ctx context.Context) error {
+	for {
+		encryptions, err := m.keyStorage.ListStaleFileEncryptions(ctx, m.keyring.ActiveKeyID(), m.options.BatchSize)
+		if err != nil {
+			return fmt.Errorf("can't list stale file encryptions: %w", err)
+		}
+
+		var rewrapped int
+		for _, staleEncryption := range encryptions {
+			if err := m.rewrap(ctx, staleEncryption); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				m.logger.Error(
+					"can't rewrap data key",
+					zap.String("master_key_id", staleEncryption.MasterKeyID),
+					zap.Error(err),
+				)
+				continue
+			}
+			rewrapped++
+		}
+
+		if rewrapped > 0 {
+			m.logger.Info("data keys rewrapped", zap.Int("count", rewrapped))
+		}
+
+		// NOTE: Keys which can't be rewrapped are listed again, so the pass stops if nothing is rewrapped.
+		if len(encryptions) < m.options.BatchSize || rewrapped == 0 {
+			return nil
+		}
+	}
+}
+
+func (m *Rewrapper) rewrap(ctx context.Context, staleEncryption *karma8.FileEncryption) error {
+	newEncryption, err := m.keyring.Rewrap(staleEncryption)
+	if err != nil {
+		return fmt.Errorf("can't rewrap data key: %w", err)
+	}
+
+	err = m.keyStorage.ReplaceFileEncryption(ctx, staleEncryption, newEncryption)
+	if errors.Is(err, karma8.ErrFileEncryptionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't replace file encryption: %w", err)
+	}
+	return nil
+}
+
+func New(
+	keyStorage karma8.KeyStorage,
+	keyring *encryption.Keyring,
+	jobLocker karma8.JobLocker,
+	options Options,
+	logger *zap.Logger,
+) *Rewrapper {
+	return &Rewrapper{
+		keyStorage: keyStorage,
+		keyring:    keyring,
+		jobLocker:  jobLocker,
+		options:    options,
+		logger:     logger.With(zap.String("job", jobName)),
+	}
+}
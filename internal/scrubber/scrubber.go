@@ -0,0 +1,240 @@
+package scrubber
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"karma8"
+	"karma8/internal/job"
+	"karma8/internal/partmover"
+	"time"
+)
+
+const jobName = "scrubber"
+
+type Options struct {
+	// Interval between scrub passes.
+	Interval time.Duration
+	// BatchSize is amount of files read from meta storage at once, progress is saved after every batch.
+	BatchSize int
+	// MaxBytesPerSecond throttles reading of parts, zero means no limit.
+	MaxBytesPerSecond int64
+	// Repair enables restoring of damaged parts from healthy replicas.
+	Repair bool
+}
+
+// Scrubber reads every stored part and compares it with file meta, damaged parts are reported and repaired.
+type Scrubber struct {
+	storageHolder   karma8.StorageHolder
+	fileMetaStorage karma8.FileMetaStorage
+	cursorStorage   karma8.CursorStorage
+	damageStorage   karma8.DamageStorage
+	mover           *partmover.Mover
+	jobLocker       karma8.JobLocker
+	options         Options
+
+	logger *zap.Logger
+}
+
+func (m *Scrubber) Run(ctx context.Context) error {
+	return job.RunExclusively(ctx, jobName, m.jobLocker, m.options.Interval, m.RunOnce, m.logger)
+}
+
+// RunOnce verifies all files starting from the saved cursor.
+func (m *Scrubber) RunOnce(ctx context.Context) error {
+	cursor, err := m.cursorStorage.GetCursor(ctx, jobName)
+	if err != nil {
+		return err
+	}
+
+	m.logger.Info("start scrub pass", zap.String("cursor", cursor))
+
+	for {
+		fileMetas, err := m.fileMetaStorage.ListFileMetas(ctx, karma8.ParseFileKey(cursor), m.options.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(fileMetas) == 0 {
+			m.logger.Info("scrub pass finished")
+			return m.cursorStorage.SaveCursor(ctx, jobName, "")
+		}
+
+		for _, fileMeta := range fileMetas {
+			for i, part := range fileMeta.Parts {
+				if err := m.scrubFilePart(ctx, fileMeta, i, part); err != nil {
+					return err
+				}
+			}
+		}
+
+		cursor = fileMetas[len(fileMetas)-1].Key().String()
+		if err := m.cursorStorage.SaveCursor(ctx, jobName, cursor); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Scrubber) scrubFilePart(ctx context.Context, fileMeta *karma8.FileMeta, partIndex int, part *karma8.FilePart) error {
+	logger := m.logger.With(
+		zap.String("bucket", fileMeta.Bucket),
+		zap.String("filename", fileMeta.Name),
+		zap.Int("part_index", partIndex),
+	)
+
+	var healthy []string
+	var damaged []*karma8.DamagedFilePart
+	for _, location := range part.Locations() {
+		startTime := time.Now()
+		reason, err := m.verify(ctx, location, part)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// NOTE: Storage may be temporary unavailable, part will be checked again during the next pass.
+			logger.Warn("can't verify file part", zap.String("storage_url", location), zap.Error(err))
+			continue
+		}
+
+		if err := job.Throttle(ctx, part.StoredSize(), time.Since(startTime), m.options.MaxBytesPerSecond); err != nil {
+			return err
+		}
+
+		if reason == "" {
+			healthy = append(healthy, location)
+			continue
+		}
+
+		logger.Warn("damaged file part found", zap.String("storage_url", location), zap.String("reason", reason))
+		damaged = append(damaged, &karma8.DamagedFilePart{
+			Bucket:     fileMeta.Bucket,
+			Filename:   fileMeta.Name,
+			PartIndex:  partIndex,
+			StorageURL: location,
+			Reason:     reason,
+		})
+	}
+
+	if len(damaged) == 0 {
+		return nil
+	}
+
+	// NOTE: Part may be moved or file deleted since listing, then the old location isn't damaged, it's just unused.
+	locations, err := m.currentLocations(ctx, fileMeta.Key(), partIndex, part.Path)
+	if err != nil {
+		return err
+	}
+	healthy = filterLocations(healthy, locations)
+
+	for _, damagedPart := range damaged {
+		if _, ok := locations[damagedPart.StorageURL]; !ok {
+			logger.Info("file part isn't referenced on storage anymore", zap.String("storage_url", damagedPart.StorageURL))
+			continue
+		}
+
+		if m.options.Repair && len(healthy) > 0 {
+			if err := m.mover.Copy(ctx, part, healthy[0], damagedPart.StorageURL); err != nil {
+				logger.Error("can't repair file part", zap.String("storage_url", damagedPart.StorageURL), zap.Error(err))
+			} else {
+				logger.Info("file part repaired", zap.String("storage_url", damagedPart.StorageURL))
+				damagedPart.Repaired = true
+			}
+		}
+
+		if err := m.damageStorage.PutDamagedFilePart(ctx, damagedPart); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// currentLocations returns storages which keep the part according to the latest file meta,
+// it's empty if file is deleted or the part is replaced meanwhile.
+func (m *Scrubber) currentLocations(
+	ctx context.Context,
+	key karma8.FileKey,
+	partIndex int,
+	path string,
+) (map[string]struct{}, error) {
+	fileMeta, err := m.fileMetaStorage.GetFileMeta(ctx, key.Bucket, key.Name)
+	if errors.Is(err, karma8.ErrFileNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if partIndex >= len(fileMeta.Parts) || fileMeta.Parts[partIndex].Path != path {
+		return nil, nil
+	}
+
+	locations := map[string]struct{}{}
+	for _, location := range fileMeta.Parts[partIndex].Locations() {
+		locations[location] = struct{}{}
+	}
+	return locations, nil
+}
+
+func filterLocations(locations []string, allowed map[string]struct{}) []string {
+	var result []string
+	for _, location := range locations {
+		if _, ok := allowed[location]; ok {
+			result = append(result, location)
+		}
+	}
+	return result
+}
+
+// verify returns reason of the part damage or empty string if part is healthy.
+func (m *Scrubber) verify(ctx context.Context, storageURL string, part *karma8.FilePart) (string, error) {
+	body, err := m.storageHolder.GetStorage(storageURL).ReadFilePart(ctx, part.Path, 0)
+	if errors.Is(err, karma8.ErrFilePartNotFound) {
+		return "missing", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, body)
+	if err != nil {
+		return "", err
+	}
+
+	if n != part.StoredSize() {
+		return fmt.Sprintf("unexpected length %d, expected %d", n, part.StoredSize()), nil
+	}
+
+	if part.Checksum != "" && hex.EncodeToString(hasher.Sum(nil)) != part.Checksum {
+		return "checksum mismatch", nil
+	}
+
+	return "", nil
+}
+
+func New(
+	storageHolder karma8.StorageHolder,
+	fileMetaStorage karma8.FileMetaStorage,
+	cursorStorage karma8.CursorStorage,
+	damageStorage karma8.DamageStorage,
+	mover *partmover.Mover,
+	jobLocker karma8.JobLocker,
+	options Options,
+	logger *zap.Logger,
+) *Scrubber {
+	return &Scrubber{
+		storageHolder:   storageHolder,
+		fileMetaStorage: fileMetaStorage,
+		cursorStorage:   cursorStorage,
+		damageStorage:   damageStorage,
+		mover:           mover,
+		jobLocker:       jobLocker,
+		options:         options,
+		logger:          logger.With(zap.String("job", jobName)),
+	}
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"karma8"
+	"karma8/internal/logging"
+	"karma8/internal/tracing"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// httpStorage is a client of storage node. Parts are kept under /parts/{path}, where path is a single escaped segment:
+//   - PUT uploads part, GET returns it (Range header is used for offset), DELETE removes it;
+//   - GET /parts returns JSON inventory of the node;
+//   - GET /healthz returns 200 when node is able to serve requests.
+type httpStorage struct {
+	client  *http.Client
+	baseURL string
+}
+
+type httpStoredFilePart struct {
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	ModifyTime time.Time `json:"modify_time"`
+}
+
+func (m *httpStorage) partURL(path string) string {
+	return m.baseURL + "/parts/" + url.PathEscape(path)
+}
+
+// lengthReader reports amount of unread bytes like bytes.Reader.
+type lengthReader interface {
+	io.Reader
+	Len() int
+}
+
+func (m *httpStorage) do(
+	ctx context.Context,
+	method string,
+	target string,
+	body io.Reader,
+	header http.Header,
+) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	// NOTE: Length of wrapped body is unknown to http.NewRequestWithContext, so it would be sent chunked.
+	if sized, ok := body.(lengthReader); ok && request.ContentLength == 0 && request.Body != http.NoBody {
+		request.ContentLength = int64(sized.Len())
+		if request.ContentLength == 0 {
+			request.Body = http.NoBody
+		}
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	tracing.InjectHTTPHeaders(request)
+	if requestID := logging.RequestIDFromContext(ctx); requestID != "" {
+		request.Header.Set(logging.HeaderRequestID, requestID)
+	}
+
+	return m.client.Do(request)
+}
+
+func unexpectedStatus(response *http.Response) error {
+	return fmt.Errorf("unexpected status code: %d", response.StatusCode)
+}
+
+func (m *httpStorage) UploadFilePart(ctx context.Context, path string, body io.Reader) error {
+	response, err := m.do(ctx, http.MethodPut, m.partURL(path), body, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return unexpectedStatus(response)
+	}
+	return nil
+}
+
+func (m *httpStorage) ReadFilePart(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	response, err := m.do(ctx, http.MethodGet, m.partURL(path), nil, header)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case response.StatusCode == http.StatusOK && offset == 0, response.StatusCode == http.StatusPartialContent:
+		return response.Body, nil
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// NOTE: Offset points to the end of the part.
+		_ = response.Body.Close()
+		return io.NopCloser(strings.NewReader("")), nil
+	case response.StatusCode == http.StatusNotFound:
+		_ = response.Body.Close()
+		return nil, karma8.ErrFilePartNotFound
+	default:
+		_ = response.Body.Close()
+		return nil, unexpectedStatus(response)
+	}
+}
+
+func (m *httpStorage) DeleteFilePart(ctx context.Context, path string) error {
+	response, err := m.do(ctx, http.MethodDelete, m.partURL(path), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 && response.StatusCode != http.StatusNotFound {
+		return unexpectedStatus(response)
+	}
+	return nil
+}
+
+func (m *httpStorage) ListFileParts(ctx context.Context) ([]*karma8.StoredFilePart, error) {
+	response, err := m.do(ctx, http.MethodGet, m.baseURL+"/parts", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, unexpectedStatus(response)
+	}
+
+	var parts []*httpStoredFilePart
+	if err := json.NewDecoder(response.Body).Decode(&parts); err != nil {
+		return nil, fmt.Errorf("can't decode inventory: %w", err)
+	}
+
+	result := make([]*karma8.StoredFilePart, 0, len(parts))
+	for _, part := range parts {
+		result = append(result, &karma8.StoredFilePart{
+			Path:       part.Path,
+			Size:       part.Size,
+			ModifyTime: part.ModifyTime,
+		})
+	}
+	return result, nil
+}
+
+func (m *httpStorage) Ping(ctx context.Context) error {
+	response, err := m.do(ctx, http.MethodGet, m.baseURL+"/healthz", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return unexpectedStatus(response)
+	}
+	return nil
+}
+
+// NewHTTP returns client of storage node, http scheme is used when storageURL doesn't have one.
+func NewHTTP(client *http.Client, storageURL string) karma8.Storage {
+	if !strings.Contains(storageURL, "://") {
+		storageURL = "http://" + storageURL
+	}
+
+	return &httpStorage{
+		client:  client,
+		baseURL: strings.TrimSuffix(storageURL, "/"),
+	}
+}
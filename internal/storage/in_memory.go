@@ -6,10 +6,16 @@ import (
 	"io"
 	"karma8"
 	"sync"
+	"time"
 )
 
+type inMemoryFilePart struct {
+	data       []byte
+	modifyTime time.Time
+}
+
 type inMemory struct {
-	pathToData map[string][]byte
+	pathToPart map[string]*inMemoryFilePart
 	mutex      sync.RWMutex
 }
 
@@ -22,29 +28,61 @@ func (m *inMemory) UploadFilePart(ctx context.Context, path string, body io.Read
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	m.pathToData[path] = data
+	m.pathToPart[path] = &inMemoryFilePart{
+		data:       data,
+		modifyTime: time.Now(),
+	}
 
 	return nil
 }
 
-func (m *inMemory) ReadFilePart(ctx context.Context, path string) (io.ReadCloser, error) {
+func (m *inMemory) ReadFilePart(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	return io.NopCloser(bytes.NewReader(m.pathToData[path])), nil
+	part, ok := m.pathToPart[path]
+	if !ok {
+		return nil, karma8.ErrFilePartNotFound
+	}
+
+	if offset > int64(len(part.data)) {
+		offset = int64(len(part.data))
+	}
+
+	return io.NopCloser(bytes.NewReader(part.data[offset:])), nil
 }
 
 func (m *inMemory) DeleteFilePart(ctx context.Context, path string) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	delete(m.pathToData, path)
+	delete(m.pathToPart, path)
+
+	return nil
+}
+
+func (m *inMemory) ListFileParts(ctx context.Context) ([]*karma8.StoredFilePart, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	result := make([]*karma8.StoredFilePart, 0, len(m.pathToPart))
+	for path, part := range m.pathToPart {
+		result = append(result, &karma8.StoredFilePart{
+			Path:       path,
+			Size:       int64(len(part.data)),
+			ModifyTime: part.modifyTime,
+		})
+	}
+
+	return result, nil
+}
 
+func (m *inMemory) Ping(ctx context.Context) error {
 	return nil
 }
 
 func NewInMemory() karma8.Storage {
 	return &inMemory{
-		pathToData: map[string][]byte{},
+		pathToPart: map[string]*inMemoryFilePart{},
 	}
 }
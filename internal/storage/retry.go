@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"karma8"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type RetryPolicy struct {
+	// MaxAttempts is total amount of attempts including the first one.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	// MaxBackoff caps exponential backoff, zero means no cap.
+	MaxBackoff time.Duration
+	// AttemptTimeout limits every attempt, for reads it's applied until body is returned,
+	// for uploads it limits time without progress, so big parts aren't limited by their size.
+	AttemptTimeout time.Duration
+	// BudgetRatio is amount of retries earned by every request, e.g. 0.1 allows to retry every tenth request.
+	BudgetRatio float64
+	// BudgetCapacity is maximal amount of retries accumulated by the budget, budget starts full.
+	BudgetCapacity float64
+}
+
+// retryBudget prevents retry storms when storage is down: every request earns a share of retry.
+type retryBudget struct {
+	tokens   float64
+	ratio    float64
+	capacity float64
+	mutex    sync.Mutex
+}
+
+func (m *retryBudget) deposit() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.tokens += m.ratio
+	if m.tokens > m.capacity {
+		m.tokens = m.capacity
+	}
+}
+
+func (m *retryBudget) withdraw() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.tokens < 1 {
+		return false
+	}
+	m.tokens--
+	return true
+}
+
+type retrying struct {
+	storage karma8.Storage
+	policy  RetryPolicy
+	budget  *retryBudget
+
+	logger *zap.Logger
+}
+
+func isRetryable(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !errors.Is(err, karma8.ErrFilePartNotFound)
+}
+
+func (m *retrying) backoff(ctx context.Context, attempt int) error {
+	delay := m.policy.InitialBackoff << uint(attempt)
+	if delay>>uint(attempt) != m.policy.InitialBackoff {
+		// NOTE: Shift overflowed, the delay is as long as possible.
+		delay = math.MaxInt64 - 1
+	}
+	if m.policy.MaxBackoff > 0 && delay > m.policy.MaxBackoff {
+		delay = m.policy.MaxBackoff
+	}
+
+	// NOTE: Full jitter spreads retries of concurrent requests.
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(delay) + 1)))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (m *retrying) withAttemptTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.policy.AttemptTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, m.policy.AttemptTimeout)
+}
+
+// do calls attempt until it succeeds or retries are over, rewind is called before every retry.
+func (m *retrying) do(ctx context.Context, operation string, attempt func() error, rewind func() error) error {
+	m.budget.deposit()
+
+	for i := 0; ; i++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+
+		if i+1 >= m.policy.MaxAttempts || !isRetryable(ctx, err) {
+			return err
+		}
+		if !m.budget.withdraw() {
+			m.logger.Warn("retry budget exhausted", zap.String("operation", operation), zap.Error(err))
+			return err
+		}
+
+		m.logger.Warn("retry storage operation", zap.String("operation", operation), zap.Int("attempt", i+1), zap.Error(err))
+
+		if backoffErr := m.backoff(ctx, i); backoffErr != nil {
+			return err
+		}
+		if rewind != nil {
+			if rewindErr := rewind(); rewindErr != nil {
+				return err
+			}
+		}
+	}
+}
+
+// progressReader postpones attempt timeout on every read of the body.
+type progressReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (m *progressReader) Read(p []byte) (int, error) {
+	n, err := m.reader.Read(p)
+	if n > 0 {
+		m.timer.Reset(m.timeout)
+	}
+	return n, err
+}
+
+// sizedProgressReader keeps length of the body known, so upload isn't sent chunked.
+type sizedProgressReader struct {
+	*progressReader
+	sized lengthReader
+}
+
+func (m *sizedProgressReader) Len() int {
+	return m.sized.Len()
+}
+
+// uploadAttempt cancels upload if body isn't read during attempt timeout, e.g. storage hangs.
+// Timeout keeps running after the whole body is sent, so storage not responding at the end is noticed too.
+func (m *retrying) uploadAttempt(ctx context.Context, path string, body io.Reader) error {
+	if m.policy.AttemptTimeout <= 0 {
+		return m.storage.UploadFilePart(ctx, path, body)
+	}
+
+	attemptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timer := time.AfterFunc(m.policy.AttemptTimeout, cancel)
+	defer timer.Stop()
+
+	progress := &progressReader{reader: body, timer: timer, timeout: m.policy.AttemptTimeout}
+	var attemptBody io.Reader = progress
+	if sized, ok := body.(lengthReader); ok {
+		attemptBody = &sizedProgressReader{progressReader: progress, sized: sized}
+	}
+
+	return m.storage.UploadFilePart(attemptCtx, path, attemptBody)
+}
+
+func (m *retrying) UploadFilePart(ctx context.Context, path string, body io.Reader) error {
+	// NOTE: Only seekable body could be sent again.
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return m.uploadAttempt(ctx, path, body)
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return m.uploadAttempt(ctx, path, body)
+	}
+
+	return m.do(
+		ctx,
+		"upload",
+		func() error {
+			return m.uploadAttempt(ctx, path, body)
+		},
+		func() error {
+			_, err := seeker.Seek(start, io.SeekStart)
+			return err
+		},
+	)
+}
+
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (m *cancelOnCloseBody) Close() error {
+	defer m.cancel()
+	return m.ReadCloser.Close()
+}
+
+func (m *retrying) ReadFilePart(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	err := m.do(
+		ctx,
+		"read",
+		func() error {
+			attemptCtx, cancel := context.WithCancel(ctx)
+			var timer *time.Timer
+			if m.policy.AttemptTimeout > 0 {
+				timer = time.AfterFunc(m.policy.AttemptTimeout, cancel)
+			}
+
+			attemptBody, err := m.storage.ReadFilePart(attemptCtx, path, offset)
+			if timer != nil && !timer.Stop() && err == nil {
+				_ = attemptBody.Close()
+				err = context.DeadlineExceeded
+			}
+			if err != nil {
+				cancel()
+				return err
+			}
+
+			body = &cancelOnCloseBody{ReadCloser: attemptBody, cancel: cancel}
+			return nil
+		},
+		nil,
+	)
+	return body, err
+}
+
+func (m *retrying) DeleteFilePart(ctx context.Context, path string) error {
+	return m.do(
+		ctx,
+		"delete",
+		func() error {
+			attemptCtx, cancel := m.withAttemptTimeout(ctx)
+			defer cancel()
+			return m.storage.DeleteFilePart(attemptCtx, path)
+		},
+		nil,
+	)
+}
+
+func (m *retrying) ListFileParts(ctx context.Context) ([]*karma8.StoredFilePart, error) {
+	var parts []*karma8.StoredFilePart
+	err := m.do(
+		ctx,
+		"list",
+		func() error {
+			attemptCtx, cancel := m.withAttemptTimeout(ctx)
+			defer cancel()
+
+			var err error
+			parts, err = m.storage.ListFileParts(attemptCtx)
+			return err
+		},
+		nil,
+	)
+	return parts, err
+}
+
+// Ping isn't retried, it should report the current state of the storage.
+func (m *retrying) Ping(ctx context.Context) error {
+	return m.storage.Ping(ctx)
+}
+
+// NewRetrying wraps storage with retries of idempotent operations, uploads are retried only for seekable body.
+func NewRetrying(storage karma8.Storage, policy RetryPolicy, logger *zap.Logger) karma8.Storage {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+
+	return &retrying{
+		storage: storage,
+		policy:  policy,
+		budget: &retryBudget{
+			tokens:   policy.BudgetCapacity,
+			ratio:    policy.BudgetRatio,
+			capacity: policy.BudgetCapacity,
+		},
+		logger: logger,
+	}
+}
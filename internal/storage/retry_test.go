@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"karma8"
+	"testing"
+	"time"
+)
+
+var errTestUnavailable = errors.New("storage is unavailable")
+
+// flakyStorage fails first uploads after reading a few bytes of the body, so retries have to rewind it.
+type flakyStorage struct {
+	karma8.Storage
+	failures int
+	attempts int
+	lengths  []int
+}
+
+func (m *flakyStorage) UploadFilePart(ctx context.Context, path string, body io.Reader) error {
+	m.attempts++
+	if sized, ok := body.(lengthReader); ok {
+		m.lengths = append(m.lengths, sized.Len())
+	} else {
+		m.lengths = append(m.lengths, -1)
+	}
+
+	if m.attempts <= m.failures {
+		_, _ = body.Read(make([]byte, 3))
+		return errTestUnavailable
+	}
+	return m.Storage.UploadFilePart(ctx, path, body)
+}
+
+func (m *flakyStorage) ReadFilePart(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	m.attempts++
+	return m.Storage.ReadFilePart(ctx, path, offset)
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := &retryBudget{tokens: 1, ratio: 0.5, capacity: 2}
+
+	if !budget.withdraw() {
+		t.Fatal("full budget doesn't allow retry")
+	}
+	if budget.withdraw() {
+		t.Fatal("empty budget allows retry")
+	}
+
+	budget.deposit()
+	if budget.withdraw() {
+		t.Fatal("half of token allows retry")
+	}
+	budget.deposit()
+	if !budget.withdraw() {
+		t.Fatal("two deposits don't allow retry")
+	}
+
+	for i := 0; i < 10; i++ {
+		budget.deposit()
+	}
+	if budget.tokens != budget.capacity {
+		t.Fatalf("budget has %v tokens, want capacity %v", budget.tokens, budget.capacity)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	const ms = time.Millisecond
+
+	tests := []struct {
+		name           string
+		initialBackoff time.Duration
+		maxBackoff     time.Duration
+		attempt        int
+		wantMax        time.Duration
+	}{
+		{name: "first attempt", initialBackoff: 10 * ms, maxBackoff: time.Second, attempt: 0, wantMax: 10 * ms},
+		{name: "exponential", initialBackoff: 10 * ms, maxBackoff: time.Second, attempt: 2, wantMax: 40 * ms},
+		{name: "capped", initialBackoff: 10 * ms, maxBackoff: 15 * ms, attempt: 2, wantMax: 15 * ms},
+		{name: "capped after overflow", initialBackoff: 10 * ms, maxBackoff: 15 * ms, attempt: 70, wantMax: 15 * ms},
+		{name: "zero initial", initialBackoff: 0, maxBackoff: time.Second, attempt: 3, wantMax: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &retrying{policy: RetryPolicy{InitialBackoff: test.initialBackoff, MaxBackoff: test.maxBackoff}}
+
+			// NOTE: Delay is jittered, so only its upper bound is checked over several runs.
+			for i := 0; i < 5; i++ {
+				startTime := time.Now()
+				if err := m.backoff(context.Background(), test.attempt); err != nil {
+					t.Fatalf("backoff failed: %v", err)
+				}
+				if spent := time.Since(startTime); spent > test.wantMax+20*ms {
+					t.Fatalf("backoff took %v, want at most %v", spent, test.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryBackoffWithoutCap(t *testing.T) {
+	m := &retrying{policy: RetryPolicy{InitialBackoff: time.Hour}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// NOTE: Zero MaxBackoff means no cap, so long backoff is interrupted only by context.
+	if err := m.backoff(ctx, 70); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("backoff error is %v, want deadline exceeded", err)
+	}
+}
+
+func TestRetryingUpload(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		maxAttempts  int
+		budget       float64
+		wantErr      error
+		wantAttempts int
+	}{
+		{name: "first attempt succeeds", failures: 0, maxAttempts: 3, budget: 10, wantAttempts: 1},
+		{name: "retry succeeds", failures: 2, maxAttempts: 3, budget: 10, wantAttempts: 3},
+		{name: "attempts are over", failures: 3, maxAttempts: 3, budget: 10, wantErr: errTestUnavailable, wantAttempts: 3},
+		{name: "budget is exhausted", failures: 3, maxAttempts: 3, budget: 1, wantErr: errTestUnavailable, wantAttempts: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flaky := &flakyStorage{Storage: NewInMemory(), failures: test.failures}
+			storage := NewRetrying(flaky, RetryPolicy{
+				MaxAttempts:    test.maxAttempts,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+				AttemptTimeout: time.Second,
+				BudgetCapacity: test.budget,
+			}, zap.NewNop())
+
+			data := []byte("part data")
+			err := storage.UploadFilePart(context.Background(), "part", bytes.NewReader(data))
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("upload error is %v, want %v", err, test.wantErr)
+			}
+			if flaky.attempts != test.wantAttempts {
+				t.Fatalf("upload is attempted %d times, want %d", flaky.attempts, test.wantAttempts)
+			}
+			// NOTE: Body is rewound before every retry, so its length is known to every attempt.
+			for i, length := range flaky.lengths {
+				if length != len(data) {
+					t.Fatalf("body length of attempt %d is %d, want %d", i+1, length, len(data))
+				}
+			}
+			if test.wantErr != nil {
+				return
+			}
+
+			body, err := flaky.Storage.ReadFilePart(context.Background(), "part", 0)
+			if err != nil {
+				t.Fatalf("can't read part: %v", err)
+			}
+			defer body.Close()
+			stored, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("can't read part: %v", err)
+			}
+			if !bytes.Equal(stored, data) {
+				t.Fatalf("stored data is %q, want %q", stored, data)
+			}
+		})
+	}
+}
+
+func TestRetryingReadNotFound(t *testing.T) {
+	flaky := &flakyStorage{Storage: NewInMemory()}
+	storage := NewRetrying(flaky, RetryPolicy{MaxAttempts: 3, BudgetCapacity: 10}, zap.NewNop())
+
+	// NOTE: Missing part won't appear on retry, so it isn't retried.
+	_, err := storage.ReadFilePart(context.Background(), "missing", 0)
+	if !errors.Is(err, karma8.ErrFilePartNotFound) {
+		t.Fatalf("read error is %v, want %v", err, karma8.ErrFilePartNotFound)
+	}
+	if flaky.attempts != 1 {
+		t.Fatalf("read is attempted %d times, want 1", flaky.attempts)
+	}
+}
@@ -2,12 +2,12 @@ package storageholder
 
 import (
 	"karma8"
-	"karma8/internal/storage"
 	"sync"
 )
 
 type storageHolder struct {
 	hostToStorage map[string]karma8.Storage
+	newStorage    func(host string) karma8.Storage
 	lock          sync.Mutex
 }
 
@@ -17,14 +17,16 @@ func (m *storageHolder) GetStorage(host string) karma8.Storage {
 
 	s, ok := m.hostToStorage[host]
 	if !ok {
-		s = storage.NewInMemory()
+		s = m.newStorage(host)
 		m.hostToStorage[host] = s
 	}
 	return s
 }
 
-func New() karma8.StorageHolder {
+// New returns holder which lazily creates storage for every host with newStorage.
+func New(newStorage func(host string) karma8.Storage) karma8.StorageHolder {
 	return &storageHolder{
 		hostToStorage: map[string]karma8.Storage{},
+		newStorage:    newStorage,
 	}
 }
@@ -0,0 +1,227 @@
+package tlsreload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"karma8/internal/job"
+	"os"
+	"sync"
+	"time"
+)
+
+const jobName = "tls_reloader"
+
+var (
+	errNoCertificate  = errors.New("certificate isn't configured")
+	errNoCACerts      = errors.New("no certificates found in CA file")
+	errNoPeerCerts    = errors.New("peer didn't present certificate")
+	errCertWithoutKey = errors.New("certificate and key files must be set together")
+)
+
+type Options struct {
+	// CertFile and KeyFile are PEM encoded certificate and its key, they're optional for clients.
+	CertFile string
+	KeyFile  string
+	// CAFile is PEM encoded bundle verifying peers, system roots verify servers if it's empty.
+	CAFile string
+	// Interval between checks of file modification times.
+	Interval time.Duration
+}
+
+// Reloader keeps certificate and CA pool loaded from files and reloads them when files are modified,
+// so certificates are rotated without restart. Every handshake uses the latest loaded files,
+// established connections keep certificates they were made with.
+type Reloader struct {
+	options Options
+
+	certificate *tls.Certificate
+	caPool      *x509.CertPool
+	modTimes    map[string]time.Time
+	mutex       sync.RWMutex
+
+	logger *zap.Logger
+}
+
+func (m *Reloader) files() []string {
+	var files []string
+	for _, file := range []string{m.options.CertFile, m.options.KeyFile, m.options.CAFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (m *Reloader) load() error {
+	modTimes := make(map[string]time.Time, 3)
+	for _, file := range m.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	var certificate *tls.Certificate
+	if m.options.CertFile != "" {
+		loaded, err := tls.LoadX509KeyPair(m.options.CertFile, m.options.KeyFile)
+		if err != nil {
+			return fmt.Errorf("can't load certificate: %w", err)
+		}
+		certificate = &loaded
+	}
+
+	var caPool *x509.CertPool
+	if m.options.CAFile != "" {
+		caPEM, err := os.ReadFile(m.options.CAFile)
+		if err != nil {
+			return fmt.Errorf("can't read CA file: %w", err)
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(caPEM) {
+			return errNoCACerts
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.certificate = certificate
+	m.caPool = caPool
+	m.modTimes = modTimes
+	return nil
+}
+
+func (m *Reloader) modified() (bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, file := range m.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		if !info.ModTime().Equal(m.modTimes[file]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.certificate, m.caPool
+}
+
+func (m *Reloader) Run(ctx context.Context) error {
+	return job.RunPeriodically(ctx, m.options.Interval, m.RunOnce, m.logger)
+}
+
+// RunOnce reloads files if any of them is modified, previous files are kept in use if new ones are broken.
+func (m *Reloader) RunOnce(_ context.Context) error {
+	modified, err := m.modified()
+	if err != nil {
+		return fmt.Errorf("can't check files: %w", err)
+	}
+	if !modified {
+		return nil
+	}
+
+	if err := m.load(); err != nil {
+		return fmt.Errorf("can't reload files: %w", err)
+	}
+
+	m.logger.Info("tls files reloaded")
+	return nil
+}
+
+func (m *Reloader) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certificate, _ := m.current()
+	if certificate == nil {
+		return nil, errNoCertificate
+	}
+	return certificate, nil
+}
+
+// ServerConfig returns config of the listener, client certificates are required and verified if CA is configured.
+func (m *Reloader) ServerConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.getCertificate,
+	}
+	if m.options.CAFile == "" {
+		return config
+	}
+
+	// NOTE: ClientCAs can't be replaced in the config used by listener, so config is built for every handshake.
+	config.GetConfigForClient = func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+		_, caPool := m.current()
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: m.getCertificate,
+			ClientCAs:      caPool,
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			NextProtos:     []string{"h2", "http/1.1"},
+		}, nil
+	}
+	return config
+}
+
+// ClientConfig returns config presenting the certificate to servers which request it,
+// servers are verified by CA if it's configured.
+func (m *Reloader) ClientConfig() *tls.Config {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if m.options.CertFile != "" {
+		config.GetClientCertificate = func(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return m.getCertificate(nil)
+		}
+	}
+	if m.options.CAFile == "" {
+		return config
+	}
+
+	// NOTE: RootCAs can't be replaced in the config shared by connections, so server certificate is verified
+	// against the latest CA pool manually.
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errNoPeerCerts
+		}
+
+		_, caPool := m.current()
+		options := x509.VerifyOptions{
+			DNSName:       state.ServerName,
+			Roots:         caPool,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, certificate := range state.PeerCertificates[1:] {
+			options.Intermediates.AddCert(certificate)
+		}
+
+		_, err := state.PeerCertificates[0].Verify(options)
+		return err
+	}
+	return config
+}
+
+// New loads files right away, so misconfiguration is noticed on start.
+func New(options Options, logger *zap.Logger) (*Reloader, error) {
+	if (options.CertFile == "") != (options.KeyFile == "") {
+		return nil, errCertWithoutKey
+	}
+
+	reloader := &Reloader{
+		options: options,
+		logger:  logger.With(zap.String("job", jobName)),
+	}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
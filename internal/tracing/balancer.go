@@ -0,0 +1,39 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"karma8"
+)
+
+type balancer struct {
+	balancer karma8.FilteringBalancer
+}
+
+func (m *balancer) GetHosts(ctx context.Context, count int) (hosts []string, err error) {
+	ctx, span := tracer().Start(ctx, "Balancer.GetHosts")
+	span.SetAttributes(attribute.Int("balancer.count", count))
+	defer func() {
+		span.SetAttributes(attribute.StringSlice("balancer.hosts", hosts))
+		end(span, err)
+	}()
+
+	return m.balancer.GetHosts(ctx, count)
+}
+
+func (m *balancer) GetAllowedHosts(ctx context.Context, count int, allowed []string) (hosts []string, err error) {
+	ctx, span := tracer().Start(ctx, "Balancer.GetAllowedHosts")
+	span.SetAttributes(attribute.Int("balancer.count", count), attribute.StringSlice("balancer.allowed", allowed))
+	defer func() {
+		span.SetAttributes(attribute.StringSlice("balancer.hosts", hosts))
+		end(span, err)
+	}()
+
+	return m.balancer.GetAllowedHosts(ctx, count, allowed)
+}
+
+func NewBalancer(b karma8.FilteringBalancer) karma8.FilteringBalancer {
+	return &balancer{
+		balancer: b,
+	}
+}
@@ -0,0 +1,200 @@
+package tracing
+
+import (
+	"context"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"karma8"
+	"time"
+)
+
+type fileMetaStorage struct {
+	storage karma8.FileMetaStorage
+}
+
+func startQuery(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracer().Start(
+		ctx,
+		"FileMetaStorage."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationKey.String(operation),
+		),
+	)
+}
+
+func (m *fileMetaStorage) PutProcessingFileMeta(ctx context.Context, meta *karma8.FileMeta) (err error) {
+	ctx, span := startQuery(ctx, "PutProcessingFileMeta")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.PutProcessingFileMeta(ctx, meta)
+}
+
+func (m *fileMetaStorage) CompleteFileMeta(ctx context.Context, meta *karma8.FileMeta, tenantQuota int64) (err error) {
+	ctx, span := startQuery(ctx, "CompleteFileMeta")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.CompleteFileMeta(ctx, meta, tenantQuota)
+}
+
+func (m *fileMetaStorage) DeleteProcessingFileMeta(
+	ctx context.Context,
+	bucket string,
+	filename string,
+	createTime time.Time,
+) (err error) {
+	ctx, span := startQuery(ctx, "DeleteProcessingFileMeta")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.DeleteProcessingFileMeta(ctx, bucket, filename, createTime)
+}
+
+func (m *fileMetaStorage) ListStaleProcessingFileMetas(
+	ctx context.Context,
+	before time.Time,
+	limit int,
+) (metas []*karma8.FileMeta, err error) {
+	ctx, span := startQuery(ctx, "ListStaleProcessingFileMetas")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.ListStaleProcessingFileMetas(ctx, before, limit)
+}
+
+func (m *fileMetaStorage) GetFileMeta(
+	ctx context.Context,
+	bucket string,
+	filename string,
+) (meta *karma8.FileMeta, err error) {
+	ctx, span := startQuery(ctx, "GetFileMeta")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.GetFileMeta(ctx, bucket, filename)
+}
+
+func (m *fileMetaStorage) ListFileMetas(
+	ctx context.Context,
+	after karma8.FileKey,
+	limit int,
+) (metas []*karma8.FileMeta, err error) {
+	ctx, span := startQuery(ctx, "ListFileMetas")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.ListFileMetas(ctx, after, limit)
+}
+
+func (m *fileMetaStorage) ListFileMetasByStorage(
+	ctx context.Context,
+	storageURL string,
+	after karma8.FileKey,
+	limit int,
+) (metas []*karma8.FileMeta, err error) {
+	ctx, span := startQuery(ctx, "ListFileMetasByStorage")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.ListFileMetasByStorage(ctx, storageURL, after, limit)
+}
+
+func (m *fileMetaStorage) CountProcessingFilesByStorage(ctx context.Context, storageURL string) (count int, err error) {
+	ctx, span := startQuery(ctx, "CountProcessingFilesByStorage")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.CountProcessingFilesByStorage(ctx, storageURL)
+}
+
+func (m *fileMetaStorage) ListExpiredFileMetas(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+) (metas []*karma8.FileMeta, err error) {
+	ctx, span := startQuery(ctx, "ListExpiredFileMetas")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.ListExpiredFileMetas(ctx, now, limit)
+}
+
+func (m *fileMetaStorage) DeleteFileMeta(ctx context.Context, key karma8.FileKey) (err error) {
+	ctx, span := startQuery(ctx, "DeleteFileMeta")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.DeleteFileMeta(ctx, key)
+}
+
+func (m *fileMetaStorage) SetFileLock(ctx context.Context, key karma8.FileKey, lock karma8.FileLock) (err error) {
+	ctx, span := startQuery(ctx, "SetFileLock")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.SetFileLock(ctx, key, lock)
+}
+
+func (m *fileMetaStorage) MoveFilePart(
+	ctx context.Context,
+	key karma8.FileKey,
+	partIndex int,
+	from, to string,
+) (err error) {
+	ctx, span := startQuery(ctx, "MoveFilePart")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.MoveFilePart(ctx, key, partIndex, from, to)
+}
+
+func (m *fileMetaStorage) GetStorageUsage(ctx context.Context) (usage map[string]int64, err error) {
+	ctx, span := startQuery(ctx, "GetStorageUsage")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.GetStorageUsage(ctx)
+}
+
+func (m *fileMetaStorage) GetTenantUsage(ctx context.Context, tenant string) (usage int64, err error) {
+	ctx, span := startQuery(ctx, "GetTenantUsage")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.GetTenantUsage(ctx, tenant)
+}
+
+func (m *fileMetaStorage) GetReferencedPaths(
+	ctx context.Context,
+	storageURL string,
+) (paths map[string]struct{}, err error) {
+	ctx, span := startQuery(ctx, "GetReferencedPaths")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.GetReferencedPaths(ctx, storageURL)
+}
+
+func NewFileMetaStorage(storage karma8.FileMetaStorage) karma8.FileMetaStorage {
+	return &fileMetaStorage{
+		storage: storage,
+	}
+}
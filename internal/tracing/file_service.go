@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"karma8"
+)
+
+const (
+	attributeBucket        = attribute.Key("file.bucket")
+	attributeFilename      = attribute.Key("file.name")
+	attributeContentLength = attribute.Key("file.content_length")
+)
+
+type fileService struct {
+	service karma8.FileService
+}
+
+func (m *fileService) PutFile(ctx context.Context, file *karma8.File) (err error) {
+	ctx, span := tracer().Start(ctx, "FileService.PutFile")
+	span.SetAttributes(
+		attributeBucket.String(file.Meta.Bucket),
+		attributeFilename.String(file.Meta.Name),
+		attributeContentLength.Int64(file.Meta.ContentLength),
+	)
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.service.PutFile(ctx, file)
+}
+
+// GetFile span covers only meta lookup, body is read by the caller later.
+func (m *fileService) GetFile(
+	ctx context.Context,
+	bucket string,
+	filename string,
+	customerKey []byte,
+	byteRange *karma8.ByteRange,
+) (file *karma8.File, err error) {
+	ctx, span := tracer().Start(ctx, "FileService.GetFile")
+	span.SetAttributes(attributeBucket.String(bucket), attributeFilename.String(filename))
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.service.GetFile(ctx, bucket, filename, customerKey, byteRange)
+}
+
+func (m *fileService) DeleteFile(ctx context.Context, bucket string, filename string) (err error) {
+	ctx, span := tracer().Start(ctx, "FileService.DeleteFile")
+	span.SetAttributes(attributeBucket.String(bucket), attributeFilename.String(filename))
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.service.DeleteFile(ctx, bucket, filename)
+}
+
+func NewFileService(service karma8.FileService) karma8.FileService {
+	return &fileService{
+		service: service,
+	}
+}
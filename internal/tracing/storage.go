@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"karma8"
+)
+
+const (
+	attributeStorageHost = attribute.Key("storage.host")
+	attributePartPath    = attribute.Key("part.path")
+	attributePartOffset  = attribute.Key("part.offset")
+)
+
+type storage struct {
+	storage karma8.Storage
+	host    string
+}
+
+func (m *storage) start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(
+		ctx,
+		name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attributes, attributeStorageHost.String(m.host))...),
+	)
+}
+
+func (m *storage) UploadFilePart(ctx context.Context, path string, body io.Reader) (err error) {
+	ctx, span := m.start(ctx, "Storage.UploadFilePart", attributePartPath.String(path))
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.UploadFilePart(ctx, path, body)
+}
+
+// ReadFilePart span covers only opening of the part, body is read by the caller later.
+func (m *storage) ReadFilePart(ctx context.Context, path string, offset int64) (body io.ReadCloser, err error) {
+	ctx, span := m.start(ctx, "Storage.ReadFilePart", attributePartPath.String(path), attributePartOffset.Int64(offset))
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.ReadFilePart(ctx, path, offset)
+}
+
+func (m *storage) DeleteFilePart(ctx context.Context, path string) (err error) {
+	ctx, span := m.start(ctx, "Storage.DeleteFilePart", attributePartPath.String(path))
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.DeleteFilePart(ctx, path)
+}
+
+func (m *storage) ListFileParts(ctx context.Context) (parts []*karma8.StoredFilePart, err error) {
+	ctx, span := m.start(ctx, "Storage.ListFileParts")
+	defer func() {
+		end(span, err)
+	}()
+
+	return m.storage.ListFileParts(ctx)
+}
+
+// Ping isn't traced, otherwise every readiness probe produces a trace.
+func (m *storage) Ping(ctx context.Context) error {
+	return m.storage.Ping(ctx)
+}
+
+func NewStorage(s karma8.Storage, host string) karma8.Storage {
+	return &storage{
+		storage: s,
+		host:    host,
+	}
+}
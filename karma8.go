@@ -3,6 +3,8 @@ package karma8
 import (
 	"context"
 	"io"
+	"strings"
+	"time"
 )
 
 // StorageHolder required to keep clients to storage. It would be useful to preserve keep-alive requests to storage.
@@ -12,39 +14,419 @@ type StorageHolder interface {
 
 type Storage interface {
 	UploadFilePart(ctx context.Context, path string, body io.Reader) error
-	ReadFilePart(ctx context.Context, path string) (io.ReadCloser, error)
+	// ReadFilePart returns part data starting from the given offset.
+	ReadFilePart(ctx context.Context, path string, offset int64) (io.ReadCloser, error)
 	DeleteFilePart(ctx context.Context, path string) error
+	// ListFileParts returns inventory of the storage.
+	ListFileParts(ctx context.Context) ([]*StoredFilePart, error)
+	// Ping checks that storage is reachable.
+	Ping(ctx context.Context) error
+}
+
+type StoredFilePart struct {
+	Path       string
+	Size       int64
+	ModifyTime time.Time
 }
 
 type FilePart struct {
 	StorageURL    string
 	Path          string
 	ContentLength int64
+	// Checksum is hex encoded sha256 of the part data as it's stored, so compressed data is hashed.
+	Checksum string
+	// Replicas are additional storages which keep the same data as StorageURL.
+	Replicas []string
+	// Shared part is a blob referenced by all files with the same part content, it's deleted only by blob GC.
+	Shared bool
+	// Codec is compression of the part data on storage, empty codec means data is stored as is.
+	Codec string
+	// StoredLength is size of the data on storage, it's set only for compressed or encrypted parts.
+	StoredLength int64
+}
+
+// StoredSize returns amount of bytes the part takes on every storage.
+func (m *FilePart) StoredSize() int64 {
+	if m.StoredLength > 0 {
+		return m.StoredLength
+	}
+	return m.ContentLength
+}
+
+// Locations returns all storages which keep the part, primary storage goes first.
+func (m *FilePart) Locations() []string {
+	return append([]string{m.StorageURL}, m.Replicas...)
 }
 
 type FileMetaStorage interface {
 	// PutProcessingFileMeta saves data before upload, required to clean up storage in case of failures during upload.
+	// CreateTime of meta is set, together with the key it identifies the upload.
+	// It fails with ErrFileAlreadyExists if another upload of the same file is in progress.
 	PutProcessingFileMeta(ctx context.Context, meta *FileMeta) error
-	CompleteFileMeta(ctx context.Context, filename string) error
-	GetFileMeta(ctx context.Context, filename string) (*FileMeta, error)
+	// CompleteFileMeta makes file visible, parts are replaced with the given ones to keep data known after upload.
+	// Locations of shared parts are taken from their blobs, since blobs may be moved during upload, meta is updated.
+	// References to blobs of shared parts are counted, it fails with ErrBlobNotFound if blob is already deleted
+	// and with ErrUploadAborted if the upload is already cleaned up. Files are never overwritten, it fails with
+	// ErrFileAlreadyExists if the file was completed by another upload meanwhile. Tenant and bucket quotas are checked
+	// again atomically, so concurrent uploads can't exceed them together, it fails with ErrTenantQuotaExceeded or
+	// ErrBucketQuotaExceeded, zero quota means unlimited.
+	CompleteFileMeta(ctx context.Context, meta *FileMeta, tenantQuota int64) error
+	// DeleteProcessingFileMeta deletes meta of the upload started at createTime, so a newer upload of the same file
+	// isn't touched. It fails with ErrFileNotFound if upload is already completed or cleaned up.
+	DeleteProcessingFileMeta(ctx context.Context, bucket string, filename string, createTime time.Time) error
+	// ListStaleProcessingFileMetas returns processing files created before the given time.
+	ListStaleProcessingFileMetas(ctx context.Context, before time.Time, limit int) ([]*FileMeta, error)
+	GetFileMeta(ctx context.Context, bucket string, filename string) (*FileMeta, error)
+	// ListFileMetas returns completed files ordered by key, starting right after the given key.
+	ListFileMetas(ctx context.Context, after FileKey, limit int) ([]*FileMeta, error)
+	// ListFileMetasByStorage works like ListFileMetas, but returns only files with parts on the given storage.
+	ListFileMetasByStorage(ctx context.Context, storageURL string, after FileKey, limit int) ([]*FileMeta, error)
+	// CountProcessingFilesByStorage returns amount of uploads in progress with parts on the given storage.
+	CountProcessingFilesByStorage(ctx context.Context, storageURL string) (int, error)
+	// ListExpiredFileMetas returns completed files which outlived their TTL or retention of the bucket by now,
+	// locked files are skipped.
+	ListExpiredFileMetas(ctx context.Context, now time.Time, limit int) ([]*FileMeta, error)
+	// DeleteFileMeta moves completed file to trash, its parts are kept until the file is purged.
+	// It fails with ErrFileNotFound if there is no such file and with ErrFileLocked if file is locked.
+	DeleteFileMeta(ctx context.Context, key FileKey) error
+	// SetFileLock replaces lock of the file, it fails with ErrRetentionShortened if active retention is shortened.
+	SetFileLock(ctx context.Context, key FileKey, lock FileLock) error
+	// MoveFilePart atomically replaces one of the part locations, shared part is moved in all files referring to the blob.
+	// Parts of locked files are moved too, WORM lock protects data from deletion, not its location.
+	// It fails with ErrFilePartMoved if part isn't stored on from anymore.
+	MoveFilePart(ctx context.Context, key FileKey, partIndex int, from, to string) error
+	// GetStorageUsage returns amount of bytes referenced by completed files for every storage, blobs are counted once.
+	GetStorageUsage(ctx context.Context) (map[string]int64, error)
+	// GetTenantUsage returns amount of bytes of completed and processing files of the tenant.
+	GetTenantUsage(ctx context.Context, tenant string) (int64, error)
+	// GetReferencedPaths returns paths of all parts on the storage referenced by completed, processing or deleted files
+	// and paths of blobs.
+	GetReferencedPaths(ctx context.Context, storageURL string) (map[string]struct{}, error)
+}
+
+// Blob is a content-addressed part of the bucket with deduplication, identical parts of files refer to it.
+type Blob struct {
+	Bucket string
+	// Part keeps location of the blob data, its checksum identifies the blob within the bucket.
+	Part *FilePart
+	// RefCount is amount of parts of completed and deleted files referring to the blob.
+	RefCount int64
+}
+
+// BlobStorage keeps blobs, references are counted by FileMetaStorage when files are completed and purged.
+type BlobStorage interface {
+	// FindBlob returns referenced blob with the given checksum, it fails with ErrBlobNotFound if there is no such one.
+	FindBlob(ctx context.Context, bucket string, checksum string) (*Blob, error)
+	// PutBlob registers just uploaded part as a blob without references,
+	// it returns false if there is already a blob with the same checksum.
+	PutBlob(ctx context.Context, blob *Blob) (bool, error)
+	// ListGarbageBlobs returns blobs without references which weren't referenced since the given time.
+	ListGarbageBlobs(ctx context.Context, before time.Time, limit int) ([]*Blob, error)
+	// DeleteGarbageBlob forgets blob, it fails with ErrBlobNotFound if blob is referenced again or already deleted.
+	DeleteGarbageBlob(ctx context.Context, blob *Blob) error
+}
+
+// KeyStorage keeps wrapped data keys of encrypted files, so they could be rewrapped by another master key.
+type KeyStorage interface {
+	// ListStaleFileEncryptions returns data keys wrapped by master keys other than the given one,
+	// keys of processing and deleted files are included.
+	ListStaleFileEncryptions(ctx context.Context, masterKeyID string, limit int) ([]*FileEncryption, error)
+	// ReplaceFileEncryption replaces wrapped data key, it fails with ErrFileEncryptionNotFound if the key isn't used
+	// by any file anymore, e.g. file is purged meanwhile.
+	ReplaceFileEncryption(ctx context.Context, old *FileEncryption, new *FileEncryption) error
+}
+
+// CursorStorage keeps progress of long-running background jobs, so they could be resumed after restart.
+type CursorStorage interface {
+	GetCursor(ctx context.Context, job string) (string, error)
+	SaveCursor(ctx context.Context, job string, cursor string) error
+}
+
+// JobLocker makes passes of background jobs exclusive across instances, since jobs share cursors and files.
+type JobLocker interface {
+	// TryLockJob returns false if the job is locked by another instance, otherwise unlock must be called after the pass.
+	TryLockJob(ctx context.Context, job string) (unlock func(), locked bool, err error)
+}
+
+// OrphanFilePart is a part which wasn't deleted from storage during cleanup.
+type OrphanFilePart struct {
+	StorageURL string
+	Path       string
+}
+
+// OrphanStorage keeps parts left after failed cleanups, so the janitor could delete them later.
+type OrphanStorage interface {
+	PutOrphanFileParts(ctx context.Context, parts []*OrphanFilePart) error
+	ListOrphanFileParts(ctx context.Context, limit int) ([]*OrphanFilePart, error)
+	DeleteOrphanFilePart(ctx context.Context, part *OrphanFilePart) error
+}
+
+type DamagedFilePart struct {
+	Bucket     string    `json:"bucket"`
+	Filename   string    `json:"filename"`
+	PartIndex  int       `json:"part_index"`
+	StorageURL string    `json:"storage_url"`
+	Reason     string    `json:"reason"`
+	Repaired   bool      `json:"repaired"`
+	DetectTime time.Time `json:"detect_time"`
+}
+
+// DamageStorage keeps parts found missing or corrupted by the scrubber.
+type DamageStorage interface {
+	PutDamagedFilePart(ctx context.Context, part *DamagedFilePart) error
+	// ListDamagedFileParts returns damaged parts ordered by detect time, repaired ones are skipped if onlyActive.
+	ListDamagedFileParts(ctx context.Context, onlyActive bool) ([]*DamagedFilePart, error)
+}
+
+// DeletedFile is a file moved to trash, it can be restored until it's purged.
+type DeletedFile struct {
+	ID         int64
+	Meta       *FileMeta
+	DeleteTime time.Time
+}
+
+// TrashStorage keeps deleted files, their parts stay on storages until the purge job deletes them.
+type TrashStorage interface {
+	// ListDeletedFiles returns deleted files of the bucket, recently deleted ones go first.
+	ListDeletedFiles(ctx context.Context, bucket string, limit int) ([]*DeletedFile, error)
+	// ListPurgeableDeletedFiles returns files deleted before the given time.
+	ListPurgeableDeletedFiles(ctx context.Context, before time.Time, limit int) ([]*DeletedFile, error)
+	// RestoreDeletedFile moves file back from trash, TTL of the file is kept, so file which outlived it is expired again.
+	// Tenant quota isn't checked, restore is an admin operation returning the file accounted before deletion.
+	// It fails with ErrDeletedFileNotFound if file is already purged or restored
+	// and with ErrFileAlreadyExists if another file with the same key was uploaded meanwhile.
+	RestoreDeletedFile(ctx context.Context, id int64) (*FileMeta, error)
+	// PurgeDeletedFile forgets deleted file and releases its blob references, it returns parts of the file as they
+	// were at the moment of purge, because parts may be moved since listing.
+	// It fails with ErrDeletedFileNotFound if file is already restored.
+	PurgeDeletedFile(ctx context.Context, id int64) ([]*FilePart, error)
+	// ListDeletedFilesByStorage returns deleted files with parts on the given storage ordered by id.
+	ListDeletedFilesByStorage(ctx context.Context, storageURL string, afterID int64, limit int) ([]*DeletedFile, error)
+	// MoveDeletedFilePart works like FileMetaStorage.MoveFilePart for the deleted file,
+	// it fails with ErrFilePartMoved if the file is purged or restored meanwhile.
+	MoveDeletedFilePart(ctx context.Context, id int64, partIndex int, from, to string) error
+}
+
+// ReadinessChecker reports whether the service is able to serve requests.
+type ReadinessChecker interface {
+	CheckReadiness(ctx context.Context) error
 }
 
 type Balancer interface {
 	GetHosts(ctx context.Context, count int) ([]string, error)
 }
 
+// FilteringBalancer is able to choose hosts among the allowed ones, e.g. restricted by bucket settings.
+type FilteringBalancer interface {
+	Balancer
+	// GetAllowedHosts works like GetHosts, but returns only hosts from allowed, all hosts are allowed if it's empty.
+	GetAllowedHosts(ctx context.Context, count int, allowed []string) ([]string, error)
+}
+
+// Bucket is a namespace of files with its own settings, zero values mean defaults of the service.
+type Bucket struct {
+	Name              string
+	ReplicationFactor int
+	// QuotaBytes limits total size of files in the bucket, zero means unlimited.
+	QuotaBytes int64
+	// Retention is lifetime of files, zero keeps files forever.
+	Retention    time.Duration
+	AllowedHosts []string
+	// Dedup makes identical parts of files refer to the same blob, so they are stored once.
+	Dedup bool
+	// Compression is codec applied to parts of new files, empty value disables compression.
+	Compression string
+}
+
+// BucketStorage keeps buckets and their settings.
+type BucketStorage interface {
+	// GetBucket fails with ErrBucketNotFound if there is no such bucket.
+	GetBucket(ctx context.Context, name string) (*Bucket, error)
+	ListBuckets(ctx context.Context) ([]*Bucket, error)
+	// PutBucket creates bucket or replaces settings of the existing one.
+	PutBucket(ctx context.Context, bucket *Bucket) error
+	// GetBucketUsage returns total size of completed and processing files of the bucket,
+	// size of completed files is counted on completion and deletion of files.
+	GetBucketUsage(ctx context.Context, name string) (int64, error)
+}
+
+// FileKey identifies file, files are ordered by bucket and then by name.
+type FileKey struct {
+	Bucket string
+	Name   string
+}
+
+// String is used as cursor of background jobs, bucket names can't contain slash, so it's unambiguous.
+func (m FileKey) String() string {
+	if m.Bucket == "" && m.Name == "" {
+		return ""
+	}
+	return m.Bucket + "/" + m.Name
+}
+
+// ParseFileKey is reverse of FileKey.String, empty string gives key before all files.
+func ParseFileKey(raw string) FileKey {
+	parts := strings.SplitN(raw, "/", 2)
+	if len(parts) != 2 {
+		return FileKey{}
+	}
+	return FileKey{Bucket: parts[0], Name: parts[1]}
+}
+
+// FileLock protects file from deletion, files are never overwritten anyway. Zero value means no lock.
+type FileLock struct {
+	// LegalHold protects file until it's released explicitly.
+	LegalHold bool
+	// RetainUntil protects file until the given time, it can be extended, but not shortened.
+	RetainUntil *time.Time
+}
+
+func (m *FileLock) IsLocked(now time.Time) bool {
+	return m.LegalHold || (m.RetainUntil != nil && now.Before(*m.RetainUntil))
+}
+
 type FileMeta struct {
-	Name          string
+	Bucket string
+	Name   string
+	// Tenant is owner of the file, its size is accounted in tenant usage.
+	Tenant        string
 	Parts         []*FilePart
 	ContentLength int64
+	CreateTime    time.Time
+	// ExpireTime is end of file TTL, nil keeps the file until retention of the bucket.
+	ExpireTime *time.Time
+	Lock       FileLock
+	// Encryption is nil if parts of the file are stored in plaintext.
+	Encryption *FileEncryption
+}
+
+func (m *FileMeta) Key() FileKey {
+	return FileKey{Bucket: m.Bucket, Name: m.Name}
+}
+
+// IsExpired reports whether the file outlived its TTL or retention of the bucket.
+func (m *FileMeta) IsExpired(bucket *Bucket, now time.Time) bool {
+	if m.ExpireTime != nil && now.After(*m.ExpireTime) {
+		return true
+	}
+	return bucket.Retention > 0 && now.Sub(m.CreateTime) > bucket.Retention
+}
+
+// FileEncryption is data key of encrypted file wrapped by the master key, plaintext data key is never stored.
+type FileEncryption struct {
+	MasterKeyID string
+	WrappedKey  []byte
+	// CustomerKeyFingerprint is set if data key is wrapped by the key provided by the client instead of master key,
+	// the client key itself is never stored.
+	CustomerKeyFingerprint string
 }
 
 type File struct {
 	Meta *FileMeta
 	Body io.ReadCloser
+	// CustomerKey encrypts uploaded file instead of master key, it's nil if the client doesn't provide a key.
+	CustomerKey []byte
+	// Offset and Length of the content in Body, they're set by GetFile only.
+	Offset int64
+	Length int64
+}
+
+// ByteRange is a single range of the Range header. Last is inclusive and -1 for open range,
+// SuffixLength requests the last bytes of the file instead of offsets.
+type ByteRange struct {
+	First        int64
+	Last         int64
+	SuffixLength int64
+}
+
+// Resolve returns offset and length of the range within content of the given length,
+// it fails with ErrRangeNotSatisfiable if the range starts after the content.
+func (m *ByteRange) Resolve(contentLength int64) (int64, int64, error) {
+	if m.SuffixLength > 0 {
+		if contentLength == 0 {
+			return 0, 0, ErrRangeNotSatisfiable
+		}
+		length := m.SuffixLength
+		if length > contentLength {
+			length = contentLength
+		}
+		return contentLength - length, length, nil
+	}
+
+	if m.First >= contentLength {
+		return 0, 0, ErrRangeNotSatisfiable
+	}
+	last := m.Last
+	if last < 0 || last >= contentLength {
+		last = contentLength - 1
+	}
+	return m.First, last - m.First + 1, nil
 }
 
 type FileService interface {
+	// PutFile fails with ErrFileAlreadyExists if the file exists, files are never overwritten.
 	PutFile(ctx context.Context, file *File) error
-	GetFile(ctx context.Context, filename string) (*File, error)
+	// GetFile requires customerKey if file is encrypted with the key provided by the client,
+	// it fails with ErrCustomerKeyRequired if key is missing and with ErrCustomerKeyMismatch if key is wrong.
+	// Body contains only byteRange if it isn't nil, it fails with ErrRangeNotSatisfiable if range is out of the file.
+	GetFile(
+		ctx context.Context,
+		bucket string,
+		filename string,
+		customerKey []byte,
+		byteRange *ByteRange,
+	) (*File, error)
+	// DeleteFile moves file to trash, it fails with ErrFileNotFound if there is no such file.
+	DeleteFile(ctx context.Context, bucket string, filename string) error
+}
+
+type EvacuationState string
+
+const (
+	EvacuationStateRunning EvacuationState = "running"
+	EvacuationStateDone    EvacuationState = "done"
+	EvacuationStateFailed  EvacuationState = "failed"
+)
+
+type EvacuationFailure struct {
+	Bucket   string `json:"bucket"`
+	Filename string `json:"filename"`
+	// DeletedFileID is set if the part belongs to the file in trash.
+	DeletedFileID int64  `json:"deleted_file_id,omitempty"`
+	PartIndex     int    `json:"part_index"`
+	Error         string `json:"error"`
+}
+
+type EvacuationProgress struct {
+	StorageURL string               `json:"storage_url"`
+	State      EvacuationState      `json:"state"`
+	MovedParts int                  `json:"moved_parts"`
+	MovedBytes int64                `json:"moved_bytes"`
+	Failures   []*EvacuationFailure `json:"failures"`
+	Error      string               `json:"error,omitempty"`
+	StartTime  time.Time            `json:"start_time"`
+	FinishTime *time.Time           `json:"finish_time,omitempty"`
+}
+
+// Evacuator moves all parts off the storage before its decommissioning.
+type Evacuator interface {
+	// StartEvacuation drains the storage and starts moving its parts in background.
+	StartEvacuation(ctx context.Context, storageURL string) error
+	GetEvacuationProgress(ctx context.Context, storageURL string) (*EvacuationProgress, error)
+}
+
+// EvacuationStorage keeps evacuations, so they are shared by all instances and survive restarts.
+// Storage is drained on all instances since its evacuation is started.
+type EvacuationStorage interface {
+	// StartEvacuation creates running evacuation or restarts the finished one with empty progress,
+	// it fails with ErrEvacuationInProgress if the evacuation is already running.
+	StartEvacuation(ctx context.Context, storageURL string) error
+	// GetEvacuation fails with ErrEvacuationNotFound if evacuation of the storage was never started.
+	GetEvacuation(ctx context.Context, storageURL string) (*EvacuationProgress, error)
+	// ListEvacuations returns evacuations of all states without their failures.
+	ListEvacuations(ctx context.Context) ([]*EvacuationProgress, error)
+	AddEvacuationMoved(ctx context.Context, storageURL string, size int64) error
+	// AddEvacuationFailure replaces the previous failure of the same part, so resumed evacuation doesn't repeat it.
+	AddEvacuationFailure(ctx context.Context, storageURL string, failure *EvacuationFailure) error
+	FinishEvacuation(ctx context.Context, storageURL string, state EvacuationState, reason string) error
 }
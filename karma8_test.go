@@ -0,0 +1,83 @@
+package karma8
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestByteRangeResolve(t *testing.T) {
+	tests := []struct {
+		name          string
+		byteRange     ByteRange
+		contentLength int64
+		wantOffset    int64
+		wantLength    int64
+		wantErr       error
+	}{
+		{
+			name:          "closed range",
+			byteRange:     ByteRange{First: 10, Last: 19},
+			contentLength: 100,
+			wantOffset:    10,
+			wantLength:    10,
+		},
+		{
+			name:          "open range",
+			byteRange:     ByteRange{First: 10, Last: -1},
+			contentLength: 100,
+			wantOffset:    10,
+			wantLength:    90,
+		},
+		{
+			name:          "last is after content",
+			byteRange:     ByteRange{First: 90, Last: 199},
+			contentLength: 100,
+			wantOffset:    90,
+			wantLength:    10,
+		},
+		{
+			name:          "first is after content",
+			byteRange:     ByteRange{First: 100, Last: -1},
+			contentLength: 100,
+			wantErr:       ErrRangeNotSatisfiable,
+		},
+		{
+			name:          "suffix",
+			byteRange:     ByteRange{SuffixLength: 30},
+			contentLength: 100,
+			wantOffset:    70,
+			wantLength:    30,
+		},
+		{
+			name:          "suffix is longer than content",
+			byteRange:     ByteRange{SuffixLength: 300},
+			contentLength: 100,
+			wantOffset:    0,
+			wantLength:    100,
+		},
+		{
+			name:          "suffix of empty content",
+			byteRange:     ByteRange{SuffixLength: 10},
+			contentLength: 0,
+			wantErr:       ErrRangeNotSatisfiable,
+		},
+		{
+			name:          "range of empty content",
+			byteRange:     ByteRange{First: 0, Last: -1},
+			contentLength: 0,
+			wantErr:       ErrRangeNotSatisfiable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			offset, length, err := test.byteRange.Resolve(test.contentLength)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("resolve error is %v, want %v", err, test.wantErr)
+			}
+			if offset != test.wantOffset || length != test.wantLength {
+				t.Fatalf("range is %d+%d, want %d+%d", offset, length, test.wantOffset, test.wantLength)
+			}
+		})
+	}
+}